@@ -81,6 +81,15 @@ var OidcUserinfoEndpoint = ""
 var MessagePusherAddress = ""
 var MessagePusherToken = ""
 
+var SlackWebhookURL = ""
+var FeishuWebhookURL = ""
+var FeishuWebhookSecret = ""
+var DingTalkWebhookURL = ""
+var DingTalkWebhookSecret = ""
+var WeComWebhookURL = ""
+var TelegramBotToken = ""
+var TelegramChatId = ""
+
 
 var QuotaForNewUser int64 = 0
 var QuotaForInviter int64 = 0
@@ -89,10 +98,25 @@ var ChannelDisableThreshold = 5.0
 var AutomaticDisableChannelEnabled = false
 var AutomaticEnableChannelEnabled = false
 var QuotaRemindThreshold int64 = 1000
+
+// ChannelBalanceThreshold is the balance in USD below which a channel.balance_low webhook event and notification are sent, 0 disables it
+var ChannelBalanceThreshold = 0.0
 var PreConsumedQuota int64 = 500
 var ApproximateTokenEnabled = false
 var RetryTimes = 0
 
+// SessionAffinityEnabled routes the requests of a session (X-Session-Id header or user field) to the same channel
+var SessionAffinityEnabled = false
+
+// ChannelSelectionStrategy decides how a channel is chosen within a priority tier: random or adaptive
+var ChannelSelectionStrategy = "random"
+
+// BatchChannelId is the OpenAI-compatible channel that serves the Files and Batch APIs
+var BatchChannelId = 0
+
+// BatchDiscountRatio is applied on top of the usual ratios when billing batch results
+var BatchDiscountRatio = 0.5
+
 var RootUserEmail = ""
 
 var IsMasterNode = os.Getenv("NODE_TYPE") != "slave"
@@ -107,6 +131,8 @@ var BatchUpdateInterval = env.Int("BATCH_UPDATE_INTERVAL", 5)
 
 var RelayTimeout = env.Int("RELAY_TIMEOUT", 0) // unit is second
 
+var BatchSettleFrequency = env.Int("BATCH_SETTLE_FREQUENCY", 10) // unit is minute
+
 var GeminiSafetySetting = env.String("GEMINI_SAFETY_SETTING", "BLOCK_NONE")
 
 var Theme = env.String("THEME", "default")
@@ -143,6 +169,27 @@ var MetricSuccessRateThreshold = env.Float64("METRIC_SUCCESS_RATE_THRESHOLD", 0.
 var MetricSuccessChanSize = env.Int("METRIC_SUCCESS_CHAN_SIZE", 1024)
 var MetricFailChanSize = env.Int("METRIC_FAIL_CHAN_SIZE", 128)
 
+// SessionAffinityTTL is how many seconds a session stays on its channel after its last request
+var SessionAffinityTTL = env.Int("SESSION_AFFINITY_TTL", 3600)
+
+// CircuitBreakerThreshold is the number of consecutive 5xx errors that open a channel's circuit breaker, 0 disables it
+var CircuitBreakerThreshold = env.Int("CIRCUIT_BREAKER_THRESHOLD", 0)
+
+// CircuitBreakerCooldown is how many seconds an open circuit breaker waits before probing the channel again
+var CircuitBreakerCooldown = env.Int("CIRCUIT_BREAKER_COOLDOWN", 30)
+
+// ConcurrencyQueueTimeout is how many seconds a request waits for a concurrency slot of its token or group before it is rejected
+var ConcurrencyQueueTimeout = env.Int("CONCURRENCY_QUEUE_TIMEOUT", 30)
+
+// ConcurrencyQueueSize is how many requests may wait for the concurrency slots of a token or group
+var ConcurrencyQueueSize = env.Int("CONCURRENCY_QUEUE_SIZE", 64)
+
+// WebhookRetryTimes is how many times a failed webhook delivery is retried, with exponential backoff
+var WebhookRetryTimes = env.Int("WEBHOOK_RETRY_TIMES", 3)
+
+// WebhookDeliveryRetentionDays is how long webhook deliveries are kept, 0 keeps them forever
+var WebhookDeliveryRetentionDays = env.Int("WEBHOOK_DELIVERY_RETENTION_DAYS", 30)
+
 var InitialRootToken = os.Getenv("INITIAL_ROOT_TOKEN")
 
 var InitialRootAccessToken = os.Getenv("INITIAL_ROOT_ACCESS_TOKEN")
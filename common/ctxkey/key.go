@@ -1,24 +1,35 @@
 package ctxkey
 
 const (
-	Config            = "config"
-	Id                = "id"
-	Username          = "username"
-	Role              = "role"
-	Status            = "status"
-	Channel           = "channel"
-	ChannelId         = "channel_id"
-	SpecificChannelId = "specific_channel_id"
-	RequestModel      = "request_model"
-	ConvertedRequest  = "converted_request"
-	OriginalModel     = "original_model"
-	Group             = "group"
-	ModelMapping      = "model_mapping"
-	ChannelName       = "channel_name"
-	TokenId           = "token_id"
-	TokenName         = "token_name"
-	BaseURL           = "base_url"
-	AvailableModels   = "available_models"
-	KeyRequestBody    = "key_request_body"
-	SystemPrompt      = "system_prompt"
+	Config             = "config"
+	Id                 = "id"
+	Username           = "username"
+	Role               = "role"
+	Status             = "status"
+	Channel            = "channel"
+	ChannelId          = "channel_id"
+	SpecificChannelId  = "specific_channel_id"
+	SpecificChannelKey = "specific_channel_key"
+	RequestModel       = "request_model"
+	ConvertedRequest   = "converted_request"
+	OriginalModel      = "original_model"
+	Group              = "group"
+	ModelMapping       = "model_mapping"
+	ChannelName        = "channel_name"
+	ChannelKey         = "channel_key"
+	TokenId            = "token_id"
+	TokenName          = "token_name"
+	BaseURL            = "base_url"
+	AvailableModels    = "available_models"
+	KeyRequestBody     = "key_request_body"
+	SystemPrompt       = "system_prompt"
+	FallbackFrom       = "fallback_from"
+	UpstreamContext    = "upstream_context"
+	FirstByteLatency   = "first_byte_latency"
+	SessionKey         = "session_key"
+	ClientAborted      = "client_aborted"
+	TokenRPM           = "token_rpm"
+	TokenTPM           = "token_tpm"
+	RateLimitTPM       = "rate_limit_tpm"
+	TokenConcurrency   = "token_concurrency"
 )
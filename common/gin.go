@@ -51,3 +51,37 @@ func SetEventStreamHeaders(c *gin.Context) {
 	c.Writer.Header().Set("Transfer-Encoding", "chunked")
 	c.Writer.Header().Set("X-Accel-Buffering", "no")
 }
+
+// WatchClientAbort closes the upstream body as soon as the client goes away,
+// which unblocks a stream handler waiting on the upstream. The returned
+// function stops watching and reports whether the client went away, in which
+// case the context is marked with ctxkey.ClientAborted.
+func WatchClientAbort(c *gin.Context, body io.Closer) func() bool {
+	finished := make(chan struct{})
+	aborted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-c.Request.Context().Done():
+			// select picks at random when the stream finished as well, a
+			// finished stream is not an abort
+			select {
+			case <-finished:
+				aborted <- false
+				return
+			default:
+			}
+			_ = body.Close()
+			aborted <- true
+		case <-finished:
+			aborted <- false
+		}
+	}()
+	return func() bool {
+		close(finished)
+		if <-aborted {
+			c.Set(ctxkey.ClientAborted, true)
+			return true
+		}
+		return false
+	}
+}
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+)
+
+type closeCounter struct {
+	closed int32
+}
+
+func (c *closeCounter) Close() error {
+	atomic.AddInt32(&c.closed, 1)
+	return nil
+}
+
+func newAbortContext() (*gin.Context, context.CancelFunc) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx, cancel := context.WithCancel(context.Background())
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", nil).WithContext(ctx)
+	return c, cancel
+}
+
+func TestWatchClientAbort(t *testing.T) {
+	t.Run("finished stream", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			c, cancel := newAbortContext()
+			body := &closeCounter{}
+			stop := WatchClientAbort(c, body)
+			assert.False(t, stop())
+			cancel()
+			assert.Zero(t, atomic.LoadInt32(&body.closed))
+			assert.False(t, c.GetBool(ctxkey.ClientAborted))
+		}
+	})
+
+	t.Run("client gone while streaming", func(t *testing.T) {
+		c, cancel := newAbortContext()
+		body := &closeCounter{}
+		stop := WatchClientAbort(c, body)
+		cancel()
+		assert.Eventually(t, func() bool { return atomic.LoadInt32(&body.closed) == 1 }, time.Second, time.Millisecond)
+		assert.True(t, stop())
+		assert.True(t, c.GetBool(ctxkey.ClientAborted))
+	})
+}
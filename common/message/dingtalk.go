@@ -0,0 +1,68 @@
+package message
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+type dingTalkNotifier struct{}
+
+// dingTalkResponse is also the response of WeCom group bots.
+type dingTalkResponse struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+func (dingTalkNotifier) Enabled() bool {
+	return config.DingTalkWebhookURL != ""
+}
+
+// signDingTalk returns the signature of a DingTalk robot request, the
+// HMAC-SHA256 of the timestamp in milliseconds, a newline and the secret,
+// keyed by the secret.
+func signDingTalk(timestamp string, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Send posts to a DingTalk custom robot, signed if a secret is set.
+func (dingTalkNotifier) Send(title string, description string, content string) error {
+	if config.DingTalkWebhookURL == "" {
+		return errors.New("dingtalk webhook url is not set")
+	}
+	webhookURL := config.DingTalkWebhookURL
+	if config.DingTalkWebhookSecret != "" {
+		u, err := url.Parse(webhookURL)
+		if err != nil {
+			return err
+		}
+		timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		query := u.Query()
+		query.Set("timestamp", timestamp)
+		query.Set("sign", signDingTalk(timestamp, config.DingTalkWebhookSecret))
+		u.RawQuery = query.Encode()
+		webhookURL = u.String()
+	}
+	var res dingTalkResponse
+	err := postJSON(webhookURL, map[string]any{
+		"msgtype": "text",
+		"text": map[string]string{
+			"content": plainText(title, description),
+		},
+	}, &res)
+	if err != nil {
+		return err
+	}
+	if res.ErrCode != 0 {
+		return errors.New(res.ErrMsg)
+	}
+	return nil
+}
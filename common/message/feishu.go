@@ -0,0 +1,57 @@
+package message
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+type feishuNotifier struct{}
+
+type feishuResponse struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+func (feishuNotifier) Enabled() bool {
+	return config.FeishuWebhookURL != ""
+}
+
+// signFeishu returns the signature of a Feishu/Lark bot request, the HMAC-SHA256
+// of nothing keyed by the timestamp, a newline and the secret.
+func signFeishu(timestamp string, secret string) string {
+	mac := hmac.New(sha256.New, []byte(timestamp+"\n"+secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Send posts to a Feishu or Lark custom bot, signed if a secret is set.
+func (feishuNotifier) Send(title string, description string, content string) error {
+	if config.FeishuWebhookURL == "" {
+		return errors.New("feishu webhook url is not set")
+	}
+	req := map[string]any{
+		"msg_type": "text",
+		"content": map[string]string{
+			"text": plainText(title, description),
+		},
+	}
+	if config.FeishuWebhookSecret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req["timestamp"] = timestamp
+		req["sign"] = signFeishu(timestamp, config.FeishuWebhookSecret)
+	}
+	var res feishuResponse
+	err := postJSON(config.FeishuWebhookURL, req, &res)
+	if err != nil {
+		return err
+	}
+	if res.Code != 0 {
+		return errors.New(res.Msg)
+	}
+	return nil
+}
@@ -1,22 +1,39 @@
 package message
 
 import (
+	"errors"
 	"fmt"
-	"github.com/songquanpeng/one-api/common/config"
 )
 
 const (
 	ByAll           = "all"
 	ByEmail         = "email"
 	ByMessagePusher = "message_pusher"
+	BySlack         = "slack"
+	ByFeishu        = "feishu"
+	ByDingTalk      = "dingtalk"
+	ByWeCom         = "wecom"
+	ByTelegram      = "telegram"
 )
 
+// Notify sends a notification by the notifier named by, or by all the
+// configured notifiers.
 func Notify(by string, title string, description string, content string) error {
-	if by == ByEmail {
-		return SendEmail(title, config.RootUserEmail, content)
+	if by == ByAll {
+		var errs []error
+		for _, name := range enabledNotifiers() {
+			if err := getNotifier(name).Send(title, description, content); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+		return errors.Join(errs...)
 	}
-	if by == ByMessagePusher {
-		return SendMessage(title, description, content)
+	notifier := getNotifier(by)
+	if notifier == nil {
+		return fmt.Errorf("unknown notify method: %s", by)
 	}
-	return fmt.Errorf("unknown notify method: %s", by)
+	if err := notifier.Send(title, description, content); err != nil {
+		return fmt.Errorf("%s: %w", by, err)
+	}
+	return nil
 }
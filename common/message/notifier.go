@@ -0,0 +1,193 @@
+package message
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// Notifier sends a notification to the administrators, the description is
+// plain text and the content HTML, each notifier uses what it can render.
+type Notifier interface {
+	// Enabled reports whether the notifier has been configured
+	Enabled() bool
+	Send(title string, description string, content string) error
+}
+
+const (
+	EventChannelDisabled    = "channel.disabled"
+	EventChannelKeyDisabled = "channel.key_disabled"
+	EventChannelEnabled     = "channel.enabled"
+	EventChannelBalanceLow  = "channel.balance_low"
+	EventChannelTest        = "channel.test"
+)
+
+var notifiersLock sync.RWMutex
+var notifiers = map[string]Notifier{
+	ByEmail:         emailNotifier{},
+	ByMessagePusher: messagePusherNotifier{},
+	BySlack:         slackNotifier{},
+	ByFeishu:        feishuNotifier{},
+	ByDingTalk:      dingTalkNotifier{},
+	ByWeCom:         weComNotifier{},
+	ByTelegram:      telegramNotifier{},
+}
+
+// RegisterNotifier adds a notifier, or replaces the one with the same name.
+func RegisterNotifier(name string, notifier Notifier) {
+	notifiersLock.Lock()
+	defer notifiersLock.Unlock()
+	notifiers[name] = notifier
+}
+
+func getNotifier(name string) Notifier {
+	notifiersLock.RLock()
+	defer notifiersLock.RUnlock()
+	return notifiers[name]
+}
+
+// enabledNotifiers returns the names of the configured notifiers.
+func enabledNotifiers() []string {
+	notifiersLock.RLock()
+	defer notifiersLock.RUnlock()
+	var names []string
+	for name, notifier := range notifiers {
+		if notifier.Enabled() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+type emailNotifier struct{}
+
+func (emailNotifier) Enabled() bool {
+	return config.SMTPServer != "" && config.RootUserEmail != ""
+}
+
+func (emailNotifier) Send(title string, description string, content string) error {
+	return SendEmail(title, config.RootUserEmail, content)
+}
+
+type messagePusherNotifier struct{}
+
+func (messagePusherNotifier) Enabled() bool {
+	return config.MessagePusherAddress != ""
+}
+
+func (messagePusherNotifier) Send(title string, description string, content string) error {
+	return SendMessage(title, description, content)
+}
+
+var notifyMethodsLock sync.RWMutex
+
+// NotifyMethods is the notifiers each event is sent to, "*" matches the
+// events not listed, e.g. {"channel.disabled": ["slack", "email"], "*": ["feishu"]}.
+// The events matching none are sent by Message Pusher, or email if it fails.
+var NotifyMethods = map[string][]string{}
+
+func NotifyMethods2JSONString() string {
+	notifyMethodsLock.RLock()
+	defer notifyMethodsLock.RUnlock()
+	jsonBytes, err := json.Marshal(NotifyMethods)
+	if err != nil {
+		logger.SysError("error marshalling notify methods: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateNotifyMethodsByJSONString(jsonStr string) error {
+	notifyMethods := make(map[string][]string)
+	err := json.Unmarshal([]byte(jsonStr), &notifyMethods)
+	if err != nil {
+		return err
+	}
+	for _, methods := range notifyMethods {
+		for _, method := range methods {
+			if method != ByAll && getNotifier(method) == nil {
+				return fmt.Errorf("unknown notify method: %s", method)
+			}
+		}
+	}
+	notifyMethodsLock.Lock()
+	defer notifyMethodsLock.Unlock()
+	NotifyMethods = notifyMethods
+	return nil
+}
+
+// GetNotifyMethods returns the notifiers an event is sent to, nil if the
+// event is not routed.
+func GetNotifyMethods(event string) []string {
+	notifyMethodsLock.RLock()
+	defer notifyMethodsLock.RUnlock()
+	if methods, ok := NotifyMethods[event]; ok {
+		return methods
+	}
+	return NotifyMethods["*"]
+}
+
+// NotifyEvent sends a notification to the notifiers the event is routed to.
+func NotifyEvent(event string, title string, description string, content string) error {
+	methods := GetNotifyMethods(event)
+	if methods == nil {
+		if config.MessagePusherAddress != "" {
+			err := SendMessage(title, description, content)
+			if err == nil {
+				return nil
+			}
+			logger.SysError(fmt.Sprintf("failed to send message: %s", err.Error()))
+		}
+		return SendEmail(title, config.RootUserEmail, content)
+	}
+	var errs []error
+	for _, method := range methods {
+		if err := Notify(method, title, description, content); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var notifierHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// postJSON posts body to url and decodes the response into v.
+func postJSON(url string, body any, v any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := notifierHTTPClient.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code %d: %s", resp.StatusCode, string(responseBody))
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(responseBody, v)
+}
+
+// plainText joins the title and description of a chat message.
+func plainText(title string, description string) string {
+	if description == "" {
+		return title
+	}
+	return title + "\n" + description
+}
@@ -0,0 +1,67 @@
+package message
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestNotifyEvent(t *testing.T) {
+	var requests []map[string]any
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, body)
+		queries = append(queries, r.URL.RawQuery)
+		switch r.URL.Path {
+		case "/slack":
+			_, _ = w.Write([]byte("ok"))
+		case "/feishu":
+			_, _ = w.Write([]byte(`{"code":19021,"msg":"sign match fail or timestamp is not within one hour from current time"}`))
+		default:
+			_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+		}
+	}))
+	defer server.Close()
+
+	defer func() {
+		config.SlackWebhookURL = ""
+		config.FeishuWebhookURL = ""
+		config.DingTalkWebhookURL = ""
+		config.DingTalkWebhookSecret = ""
+		require.NoError(t, UpdateNotifyMethodsByJSONString("{}"))
+	}()
+	config.SlackWebhookURL = server.URL + "/slack"
+	config.FeishuWebhookURL = server.URL + "/feishu"
+	config.DingTalkWebhookURL = server.URL + "/dingtalk?access_token=token"
+	config.DingTalkWebhookSecret = "secret"
+
+	assert.Error(t, UpdateNotifyMethodsByJSONString(`{"*": ["pager"]}`))
+	require.NoError(t, UpdateNotifyMethodsByJSONString(`{"channel.disabled": ["slack", "dingtalk"], "channel.enabled": [], "*": ["feishu"]}`))
+
+	err := NotifyEvent(EventChannelDisabled, "Channel disabled", "Channel #1 has been disabled", "<p>html</p>")
+	require.NoError(t, err)
+	require.Len(t, requests, 2)
+	assert.Equal(t, "*Channel disabled*\nChannel #1 has been disabled", requests[0]["text"])
+	assert.Equal(t, map[string]any{"content": "Channel disabled\nChannel #1 has been disabled"}, requests[1]["text"])
+	assert.Contains(t, queries[1], "access_token=token")
+	assert.Contains(t, queries[1], "sign=")
+
+	// an event routed to nothing is not sent
+	requests = nil
+	assert.NoError(t, NotifyEvent(EventChannelEnabled, "Channel enabled", "", ""))
+	assert.Empty(t, requests)
+
+	// the other events go to "*", and a bot error is returned
+	err = NotifyEvent(EventChannelBalanceLow, "Balance low", "", "")
+	assert.ErrorContains(t, err, "sign match fail")
+	require.Len(t, requests, 1)
+	assert.Equal(t, "text", requests[0]["msg_type"])
+}
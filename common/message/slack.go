@@ -0,0 +1,23 @@
+package message
+
+import (
+	"errors"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+type slackNotifier struct{}
+
+func (slackNotifier) Enabled() bool {
+	return config.SlackWebhookURL != ""
+}
+
+// Send posts to a Slack incoming webhook, which answers with a plain "ok".
+func (slackNotifier) Send(title string, description string, content string) error {
+	if config.SlackWebhookURL == "" {
+		return errors.New("slack webhook url is not set")
+	}
+	return postJSON(config.SlackWebhookURL, map[string]string{
+		"text": plainText("*"+title+"*", description),
+	}, nil)
+}
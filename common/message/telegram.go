@@ -0,0 +1,40 @@
+package message
+
+import (
+	"errors"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+// telegramAPIBaseURL is replaced in tests.
+var telegramAPIBaseURL = "https://api.telegram.org"
+
+type telegramNotifier struct{}
+
+type telegramResponse struct {
+	Ok          bool   `json:"ok"`
+	Description string `json:"description"`
+}
+
+func (telegramNotifier) Enabled() bool {
+	return config.TelegramBotToken != "" && config.TelegramChatId != ""
+}
+
+// Send sends a message by a Telegram bot to a chat.
+func (telegramNotifier) Send(title string, description string, content string) error {
+	if config.TelegramBotToken == "" || config.TelegramChatId == "" {
+		return errors.New("telegram bot token or chat id is not set")
+	}
+	var res telegramResponse
+	err := postJSON(telegramAPIBaseURL+"/bot"+config.TelegramBotToken+"/sendMessage", map[string]string{
+		"chat_id": config.TelegramChatId,
+		"text":    plainText(title, description),
+	}, &res)
+	if err != nil {
+		return err
+	}
+	if !res.Ok {
+		return errors.New(res.Description)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package message
+
+import (
+	"errors"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+type weComNotifier struct{}
+
+func (weComNotifier) Enabled() bool {
+	return config.WeComWebhookURL != ""
+}
+
+// Send posts to a WeCom group bot, which answers like a DingTalk robot.
+func (weComNotifier) Send(title string, description string, content string) error {
+	if config.WeComWebhookURL == "" {
+		return errors.New("wecom webhook url is not set")
+	}
+	var res dingTalkResponse
+	err := postJSON(config.WeComWebhookURL, map[string]any{
+		"msgtype": "text",
+		"text": map[string]string{
+			"content": plainText(title, description),
+		},
+	}, &res)
+	if err != nil {
+		return err
+	}
+	if res.ErrCode != 0 {
+		return errors.New(res.ErrMsg)
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package common
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+)
+
+var (
+	ErrSemaphoreQueueFull = errors.New("semaphore queue is full")
+	ErrSemaphoreTimeout   = errors.New("timed out waiting for semaphore")
+)
+
+// semaphoreLease is how long a slot held in Redis survives the node holding
+// it, the lease is renewed while the slot is held.
+const semaphoreLease = time.Minute
+
+// semaphorePollInterval is how often a waiter checks the Redis queue.
+const semaphorePollInterval = 100 * time.Millisecond
+
+// semaphoreWaiterTTL is how long a waiter keeps its place in the Redis queue
+// without polling, e.g. once its node is gone.
+const semaphoreWaiterTTL = 5 * semaphorePollInterval
+
+type semaphoreWaiter struct {
+	ready chan struct{}
+}
+
+type semaphore struct {
+	active  int
+	waiters *list.List
+}
+
+// InMemorySemaphore limits concurrency per key within this node, waiters are
+// served first come, first served.
+type InMemorySemaphore struct {
+	store map[string]*semaphore
+	mutex sync.Mutex
+}
+
+// Acquire takes one of the limit slots of key, waiting up to timeout behind at
+// most maxQueue other waiters. The returned function gives the slot back.
+func (s *InMemorySemaphore) Acquire(ctx context.Context, key string, limit int, timeout time.Duration, maxQueue int) (func(), error) {
+	s.mutex.Lock()
+	if s.store == nil {
+		s.store = make(map[string]*semaphore)
+	}
+	sem, ok := s.store[key]
+	if !ok {
+		sem = &semaphore{waiters: list.New()}
+		s.store[key] = sem
+	}
+	release := func() { s.release(key) }
+	if sem.active < limit && sem.waiters.Len() == 0 {
+		sem.active++
+		s.mutex.Unlock()
+		return release, nil
+	}
+	if sem.waiters.Len() >= maxQueue {
+		s.mutex.Unlock()
+		return nil, ErrSemaphoreQueueFull
+	}
+	waiter := &semaphoreWaiter{ready: make(chan struct{})}
+	element := sem.waiters.PushBack(waiter)
+	s.mutex.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-waiter.ready:
+		return release, nil
+	case <-timer.C:
+		err = ErrSemaphoreTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	s.mutex.Lock()
+	select {
+	case <-waiter.ready:
+		// the slot was handed over while giving up, pass it on
+		s.mutex.Unlock()
+		release()
+		return nil, err
+	default:
+	}
+	sem.waiters.Remove(element)
+	s.mutex.Unlock()
+	return nil, err
+}
+
+// release hands the slot to the first waiter, if any, or frees it.
+func (s *InMemorySemaphore) release(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	sem := s.store[key]
+	if front := sem.waiters.Front(); front != nil {
+		sem.waiters.Remove(front)
+		close(front.Value.(*semaphoreWaiter).ready)
+		return
+	}
+	sem.active--
+	if sem.active <= 0 {
+		delete(s.store, key)
+	}
+}
+
+// semaphoreAcquireScript takes a slot of the holders sorted set, scored by
+// lease expiry, for ARGV[2] if fewer waiters are queued before it than there
+// are free slots. Otherwise it queues ARGV[2] in the queue sorted set, scored
+// by arrival, unless the queue is full. The waiters sorted set, scored by the
+// last poll, drops the waiters that stopped polling from the queue. It returns
+// 1 once the slot is taken, 0 while waiting and -1 if the queue is full.
+var semaphoreAcquireScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local id = ARGV[2]
+local lease = tonumber(ARGV[3])
+local timeout = tonumber(ARGV[4])
+local maxQueue = tonumber(ARGV[5])
+local waiterTTL = tonumber(ARGV[6])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', now - timeout - lease)
+local stale = redis.call('ZRANGEBYSCORE', KEYS[3], '-inf', now - waiterTTL)
+for _, waiter in ipairs(stale) do
+	redis.call('ZREM', KEYS[2], waiter)
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[3], '-inf', now - waiterTTL)
+local ahead = redis.call('ZRANK', KEYS[2], id)
+local queued = ahead ~= false
+if not queued then
+	ahead = redis.call('ZCARD', KEYS[2])
+end
+local result = 0
+if ahead < limit - redis.call('ZCARD', KEYS[1]) then
+	redis.call('ZADD', KEYS[1], now + lease, id)
+	redis.call('ZREM', KEYS[2], id)
+	redis.call('ZREM', KEYS[3], id)
+	result = 1
+else
+	if not queued then
+		if ahead >= maxQueue then
+			return -1
+		end
+		redis.call('ZADD', KEYS[2], now, id)
+	end
+	redis.call('ZADD', KEYS[3], now, id)
+end
+redis.call('PEXPIRE', KEYS[1], lease)
+redis.call('PEXPIRE', KEYS[2], timeout + lease)
+redis.call('PEXPIRE', KEYS[3], timeout + lease)
+return result
+`)
+
+// semaphoreRenewScript extends the lease of a slot that is still held.
+var semaphoreRenewScript = redis.NewScript(`
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+redis.call('ZADD', KEYS[1], 'XX', now + tonumber(ARGV[2]), ARGV[1])
+redis.call('PEXPIRE', KEYS[1], tonumber(ARGV[2]))
+return 1
+`)
+
+func redisAcquireSemaphore(ctx context.Context, key string, limit int, timeout time.Duration, maxQueue int) (func(), error) {
+	holdersKey := "semaphore:" + key
+	queueKey := "semaphore:queue:" + key
+	waitersKey := "semaphore:waiters:" + key
+	id := random.GetUUID()
+	keys := []string{holdersKey, queueKey, waitersKey}
+	lease := semaphoreLease.Milliseconds()
+	deadline := time.Now().Add(timeout)
+	for {
+		result, err := semaphoreAcquireScript.Run(ctx, RDB, keys, limit, id, lease, timeout.Milliseconds(), maxQueue, semaphoreWaiterTTL.Milliseconds()).Int()
+		if err == nil && result == -1 {
+			err = ErrSemaphoreQueueFull
+		}
+		if err == nil && result == 0 && !time.Now().Before(deadline) {
+			err = ErrSemaphoreTimeout
+		}
+		if err == nil && result == 0 {
+			select {
+			case <-time.After(semaphorePollInterval):
+				continue
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+		}
+		if err != nil {
+			RDB.ZRem(context.Background(), queueKey, id)
+			RDB.ZRem(context.Background(), waitersKey, id)
+			return nil, err
+		}
+		break
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(semaphoreLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := semaphoreRenewScript.Run(context.Background(), RDB, []string{holdersKey}, id, lease).Err()
+				if err != nil {
+					logger.SysError("failed to renew semaphore lease: " + err.Error())
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			RDB.ZRem(context.Background(), holdersKey, id)
+		})
+	}, nil
+}
+
+var inMemorySemaphore InMemorySemaphore
+
+// AcquireSemaphore takes one of the limit slots of key, shared by all
+// instances through Redis or kept in memory if Redis is not enabled. See
+// InMemorySemaphore.Acquire for the parameters.
+func AcquireSemaphore(ctx context.Context, key string, limit int, timeout time.Duration, maxQueue int) (func(), error) {
+	if RedisEnabled {
+		return redisAcquireSemaphore(ctx, key, limit, timeout, maxQueue)
+	}
+	return inMemorySemaphore.Acquire(ctx, key, limit, timeout, maxQueue)
+}
@@ -0,0 +1,44 @@
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInMemorySemaphore(t *testing.T) {
+	var s InMemorySemaphore
+	ctx := context.Background()
+
+	release, err := s.Acquire(ctx, "key", 1, time.Second, 2)
+	assert.NoError(t, err)
+
+	// waiters are served in order
+	order := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func(i int) {
+			release, err := s.Acquire(ctx, "key", 1, time.Second, 2)
+			if assert.NoError(t, err) {
+				order <- i
+				release()
+			}
+		}(i)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	_, err = s.Acquire(ctx, "key", 1, time.Second, 2)
+	assert.ErrorIs(t, err, ErrSemaphoreQueueFull)
+
+	release()
+	assert.Equal(t, 0, <-order)
+	assert.Equal(t, 1, <-order)
+
+	release, err = s.Acquire(ctx, "key", 1, time.Second, 2)
+	assert.NoError(t, err)
+	_, err = s.Acquire(ctx, "key", 1, 10*time.Millisecond, 2)
+	assert.ErrorIs(t, err, ErrSemaphoreTimeout)
+	release()
+	assert.Empty(t, s.store)
+}
@@ -0,0 +1,162 @@
+package common
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// TokenBucketResult is the state of a bucket after taking from it.
+type TokenBucketResult struct {
+	Allowed bool
+	// Tokens left in the bucket, negative when it is in debt
+	Tokens float64
+}
+
+// RetryAfter returns the time until the bucket holds need tokens again.
+func (r *TokenBucketResult) RetryAfter(perMinute int64, need int64) time.Duration {
+	return bucketRefillTime(perMinute, float64(need)-r.Tokens)
+}
+
+// ResetAfter returns the time until the bucket is full again.
+func (r *TokenBucketResult) ResetAfter(perMinute int64) time.Duration {
+	return bucketRefillTime(perMinute, float64(perMinute)-r.Tokens)
+}
+
+func (r *TokenBucketResult) Remaining() int64 {
+	if r.Tokens <= 0 {
+		return 0
+	}
+	return int64(r.Tokens)
+}
+
+func bucketRefillTime(perMinute int64, missing float64) time.Duration {
+	if missing <= 0 || perMinute <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(missing * float64(time.Minute) / float64(perMinute)))
+}
+
+// tokenBucketScript refills the bucket by the time passed since the last take,
+// then takes cost tokens if it holds at least need of them, or regardless if
+// need is not positive. The time comes from Redis so that every instance
+// agrees on it.
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local need = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local rate = capacity / 60000
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+if need <= 0 or tokens >= need then
+	tokens = tokens - cost
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((capacity - tokens) / rate) + 60000)
+return {allowed, tostring(tokens)}
+`)
+
+func redisTakeTokenBucket(ctx context.Context, key string, perMinute int64, need int64, cost int64) (*TokenBucketResult, error) {
+	values, err := tokenBucketScript.Run(ctx, RDB, []string{key}, perMinute, need, cost).Slice()
+	if err != nil {
+		return nil, err
+	}
+	allowed, _ := values[0].(int64)
+	tokensStr, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenBucketResult{Allowed: allowed == 1, Tokens: tokens}, nil
+}
+
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// InMemoryTokenBucketLimiter keeps token buckets in memory, for when Redis is
+// not enabled.
+type InMemoryTokenBucketLimiter struct {
+	store map[string]*tokenBucket
+	mutex sync.Mutex
+}
+
+func (l *InMemoryTokenBucketLimiter) Init(expirationDuration time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.store == nil {
+		l.store = make(map[string]*tokenBucket)
+		if expirationDuration > 0 {
+			go l.clearExpiredItems(expirationDuration)
+		}
+	}
+}
+
+func (l *InMemoryTokenBucketLimiter) clearExpiredItems(expirationDuration time.Duration) {
+	for {
+		time.Sleep(expirationDuration)
+		l.mutex.Lock()
+		for key, bucket := range l.store {
+			// a bucket untouched for a minute is full again and can be dropped
+			if time.Since(bucket.updatedAt) > expirationDuration+time.Minute && bucket.tokens >= 0 {
+				delete(l.store, key)
+			}
+		}
+		l.mutex.Unlock()
+	}
+}
+
+// Take refills the bucket of key, which holds up to perMinute tokens and
+// refills at perMinute tokens a minute, then takes cost tokens from it if it
+// holds at least need of them, or regardless if need is not positive.
+func (l *InMemoryTokenBucketLimiter) Take(key string, perMinute int64, need int64, cost int64) *TokenBucketResult {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+	capacity := float64(perMinute)
+	bucket, ok := l.store[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: capacity, updatedAt: now}
+		l.store[key] = bucket
+	}
+	elapsed := now.Sub(bucket.updatedAt)
+	if elapsed > 0 {
+		bucket.tokens = math.Min(capacity, bucket.tokens+capacity*elapsed.Minutes())
+	}
+	bucket.updatedAt = now
+	result := &TokenBucketResult{}
+	if need <= 0 || bucket.tokens >= float64(need) {
+		bucket.tokens -= float64(cost)
+		result.Allowed = true
+	}
+	result.Tokens = bucket.tokens
+	return result
+}
+
+var inMemoryTokenBucketLimiter InMemoryTokenBucketLimiter
+
+// TakeTokenBucket takes from a token bucket shared by all instances through
+// Redis, or kept in memory if Redis is not enabled. See
+// InMemoryTokenBucketLimiter.Take for the parameters.
+func TakeTokenBucket(ctx context.Context, key string, perMinute int64, need int64, cost int64) (*TokenBucketResult, error) {
+	if RedisEnabled {
+		return redisTakeTokenBucket(ctx, key, perMinute, need, cost)
+	}
+	inMemoryTokenBucketLimiter.Init(time.Minute)
+	return inMemoryTokenBucketLimiter.Take(key, perMinute, need, cost), nil
+}
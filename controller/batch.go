@@ -0,0 +1,18 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/controller"
+)
+
+func AutomaticallySettleBatches(frequency int) {
+	ctx := context.Background()
+	for {
+		time.Sleep(time.Duration(frequency) * time.Minute)
+		logger.SysLog("settling finished batches")
+		controller.SettlePendingBatches(ctx)
+	}
+}
@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
@@ -14,6 +16,7 @@ func GetSubscription(c *gin.Context) {
 	var err error
 	var token *model.Token
 	var expiredTime int64
+	var budget *model.BudgetStatus
 	if config.DisplayTokenStatEnabled {
 		tokenId := c.GetInt(ctxkey.TokenId)
 		token, err = model.GetTokenById(tokenId)
@@ -21,6 +24,7 @@ func GetSubscription(c *gin.Context) {
 			expiredTime = token.ExpiredTime
 			remainQuota = token.RemainQuota
 			usedQuota = token.UsedQuota
+			budget = token.Budget.Status(time.Now())
 		}
 	} else {
 		userId := c.GetInt(ctxkey.Id)
@@ -28,6 +32,9 @@ func GetSubscription(c *gin.Context) {
 		if err != nil {
 			usedQuota, err = model.GetUserUsedQuota(userId)
 		}
+		if err == nil {
+			budget, err = model.GetUserBudgetStatus(userId)
+		}
 	}
 	if expiredTime <= 0 {
 		expiredTime = 0
@@ -58,6 +65,9 @@ func GetSubscription(c *gin.Context) {
 		SystemHardLimitUSD: amount,
 		AccessUntil:        expiredTime,
 	}
+	if budget.DailyBudget > 0 || budget.MonthlyBudget > 0 {
+		subscription.Budget = budget
+	}
 	c.JSON(200, subscription)
 	return
 }
@@ -28,6 +28,8 @@ type OpenAISubscriptionResponse struct {
 	HardLimitUSD       float64 `json:"hard_limit_usd"`
 	SystemHardLimitUSD float64 `json:"system_hard_limit_usd"`
 	AccessUntil        int64   `json:"access_until"`
+	// Budget is the daily and monthly budget of the token or user, if any
+	Budget *model.BudgetStatus `json:"budget,omitempty"`
 }
 
 type OpenAIUsageDailyCost struct {
@@ -309,6 +311,10 @@ func updateChannelOpenRouterBalance(channel *model.Channel) (float64, error) {
 }
 
 func updateChannelBalance(channel *model.Channel) (float64, error) {
+	// a multi-key channel reports the balance of its first enabled key
+	if keys := channel.GetKeys(); len(keys) > 0 {
+		channel.Key = keys[0]
+	}
 	baseURL := channeltype.ChannelBaseURLs[channel.Type]
 	if channel.GetBaseURL() == "" {
 		channel.BaseURL = &baseURL
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -75,7 +76,6 @@ func testChannel(ctx context.Context, channel *model.Channel, request *relaymode
 		Body:   nil,
 		Header: make(http.Header),
 	}
-	c.Request.Header.Set("Authorization", "Bearer "+channel.Key)
 	c.Request.Header.Set("Content-Type", "application/json")
 	c.Set(ctxkey.Channel, channel.Type)
 	c.Set(ctxkey.BaseURL, channel.GetBaseURL())
@@ -248,7 +248,16 @@ func testChannels(ctx context.Context, notify bool, scope string) error {
 				if config.AutomaticDisableChannelEnabled {
 					monitor.DisableChannel(channel.Id, channel.Name, err.Error())
 				} else {
-					_ = message.Notify(message.ByAll, fmt.Sprintf("Channel %s (%d) test timeout", channel.Name, channel.Id), "", err.Error())
+					subject := fmt.Sprintf("Channel %s (%d) test timeout", channel.Name, channel.Id)
+					content := message.EmailTemplate(
+						subject,
+						fmt.Sprintf(`
+							<p>Hello!</p>
+							<p>Channel「<strong>%s</strong>」（#%d）test timed out.</p>
+							<p style="background-color: #f8f8f8; padding: 10px; border-radius: 4px;">%s</p>
+						`, html.EscapeString(channel.Name), channel.Id, html.EscapeString(err.Error())),
+					)
+					monitor.NotifyRootUser(message.EventChannelTest, subject, err.Error(), content)
 				}
 			}
 			if isChannelEnabled && monitor.ShouldDisableChannel(openaiErr, -1) {
@@ -264,10 +273,10 @@ func testChannels(ctx context.Context, notify bool, scope string) error {
 		testAllChannelsRunning = false
 		testAllChannelsLock.Unlock()
 		if notify {
-			err := message.Notify(message.ByAll, "Channel test completed", "", "Channel test completed, if no disable notification is received, all channels are normal")
-			if err != nil {
-				logger.SysError(fmt.Sprintf("failed to send email: %s", err.Error()))
-			}
+			subject := "Channel test completed"
+			description := "Channel test completed, if no disable notification is received, all channels are normal"
+			content := message.EmailTemplate(subject, "<p>Hello!</p><p>"+description+"</p>")
+			monitor.NotifyRootUser(message.EventChannelTest, subject, description, content)
 		}
 	}()
 	return nil
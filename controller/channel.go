@@ -86,6 +86,9 @@ func AddChannel(c *gin.Context) {
 	}
 	channel.CreatedTime = helper.GetTimestamp()
 	keys := strings.Split(channel.Key, "\n")
+	if cfg, _ := channel.LoadConfig(); cfg.MultiKey {
+		keys = []string{channel.Key}
+	}
 	channels := make([]model.Channel, 0, len(keys))
 	for _, key := range keys {
 		if key == "" {
@@ -17,7 +17,8 @@ func GetOptions(c *gin.Context) {
 	var options []*model.Option
 	config.OptionMapRWMutex.Lock()
 	for k, v := range config.OptionMap {
-		if strings.HasSuffix(k, "Token") || strings.HasSuffix(k, "Secret") {
+		// the chat bot webhook urls carry their credentials
+		if strings.HasSuffix(k, "Token") || strings.HasSuffix(k, "Secret") || strings.HasSuffix(k, "WebhookURL") {
 			continue
 		}
 		options = append(options, &model.Option{
@@ -53,6 +54,14 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "ChannelSelectionStrategy":
+		if !model.IsChannelSelectorRegistered(option.Value) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "Invalid channel selection strategy",
+			})
+			return
+		}
 	case "GitHubOAuthEnabled":
 		if option.Value == "true" && config.GitHubClientId == "" {
 			c.JSON(http.StatusOK, gin.H{
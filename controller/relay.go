@@ -2,10 +2,12 @@ package controller
 
 import (
 	"bytes"
-	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common"
@@ -16,7 +18,9 @@ import (
 	"github.com/songquanpeng/one-api/middleware"
 	dbmodel "github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay/adaptor/gemini"
 	"github.com/songquanpeng/one-api/relay/controller"
+	"github.com/songquanpeng/one-api/relay/fallback"
 	"github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/relaymode"
 )
@@ -26,7 +30,7 @@ import (
 func relayHelper(c *gin.Context, relayMode int) *model.ErrorWithStatusCode {
 	var err *model.ErrorWithStatusCode
 	switch relayMode {
-	case relaymode.ImagesGenerations:
+	case relaymode.ImagesGenerations, relaymode.ImagesEdits, relaymode.ImagesVariations:
 		err = controller.RelayImageHelper(c, relayMode)
 	case relaymode.AudioSpeech:
 		fallthrough
@@ -36,6 +40,18 @@ func relayHelper(c *gin.Context, relayMode int) *model.ErrorWithStatusCode {
 		err = controller.RelayAudioHelper(c, relayMode)
 	case relaymode.Proxy:
 		err = controller.RelayProxyHelper(c, relayMode)
+	case relaymode.ClaudeMessages:
+		err = controller.RelayClaudeMessagesHelper(c)
+	case relaymode.GeminiGenerateContent:
+		err = controller.RelayGeminiHelper(c)
+	case relaymode.Responses:
+		err = controller.RelayResponsesHelper(c)
+	case relaymode.Realtime:
+		err = controller.RelayRealtimeHelper(c)
+	case relaymode.Rerank:
+		err = controller.RelayRerankHelper(c)
+	case relaymode.Files, relaymode.Batches:
+		err = controller.RelayBatchHelper(c, relayMode)
 	default:
 		err = controller.RelayTextHelper(c)
 	}
@@ -53,41 +69,38 @@ func Relay(c *gin.Context) {
 	userId := c.GetInt(ctxkey.Id)
 	bizErr := relayHelper(c, relayMode)
 	if bizErr == nil {
-		monitor.Emit(channelId, true)
+		recordRelaySuccess(c)
 		return
 	}
-	lastFailedChannelId := channelId
 	channelName := c.GetString(ctxkey.ChannelName)
-	group := c.GetString(ctxkey.Group)
 	originalModel := c.GetString(ctxkey.OriginalModel)
-	go processChannelRelayError(ctx, userId, channelId, channelName, *bizErr)
+	go monitor.ProcessRelayError(ctx, userId, channelId, channelName, c.GetString(ctxkey.ChannelKey), relayLatency(c), *bizErr)
 	requestId := c.GetString(helper.RequestIdKey)
 	retryTimes := config.RetryTimes
 	if !shouldRetry(c, bizErr.StatusCode) {
 		logger.Errorf(ctx, "relay error happen, status code is %d, won't retry in this case", bizErr.StatusCode)
 		retryTimes = 0
 	}
-	for i := retryTimes; i > 0; i-- {
-		channel, err := dbmodel.CacheGetRandomSatisfiedChannel(group, originalModel, i != retryTimes)
-		if err != nil {
-			logger.Errorf(ctx, "CacheGetRandomSatisfiedChannel failed: %+v", err)
-			break
-		}
-		logger.Infof(ctx, "using channel #%d to retry (remain times %d)", channel.Id, i)
-		if channel.Id == lastFailedChannelId {
-			continue
+	bizErr = relayWithRetries(c, relayMode, originalModel, retryTimes, channelId, bizErr)
+	if bizErr != nil && shouldRetry(c, bizErr.StatusCode) && shouldFallback(c, relayMode) {
+		for _, fallbackModel := range fallback.GetModelFallbacks(originalModel) {
+			if !isModelAvailable(c, fallbackModel) {
+				continue
+			}
+			err := setRequestModel(c, fallbackModel)
+			if err != nil {
+				logger.Errorf(ctx, "setRequestModel failed: %+v", err)
+				break
+			}
+			logger.Infof(ctx, "falling back from model %s to %s", originalModel, fallbackModel)
+			c.Set(ctxkey.FallbackFrom, originalModel)
+			c.Set(ctxkey.RequestModel, fallbackModel)
+			// a fallback model gets as many attempts as the requested one
+			bizErr = relayWithRetries(c, relayMode, fallbackModel, retryTimes+1, 0, bizErr)
+			if bizErr == nil || !shouldRetry(c, bizErr.StatusCode) {
+				break
+			}
 		}
-		middleware.SetupContextForSelectedChannel(c, channel, originalModel)
-		requestBody, err := common.GetRequestBody(c)
-		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
-		bizErr = relayHelper(c, relayMode)
-		if bizErr == nil {
-			return
-		}
-		channelId := c.GetInt(ctxkey.ChannelId)
-		lastFailedChannelId = channelId
-		channelName := c.GetString(ctxkey.ChannelName)
-		go processChannelRelayError(ctx, userId, channelId, channelName, *bizErr)
 	}
 	if bizErr != nil {
 		if bizErr.StatusCode == http.StatusTooManyRequests {
@@ -96,12 +109,79 @@ func Relay(c *gin.Context) {
 
 		// BUG: bizErr is in race condition
 		bizErr.Error.Message = helper.MessageWithRequestId(bizErr.Error.Message, requestId)
+		if relayMode == relaymode.ClaudeMessages {
+			// Anthropic SDKs expect their own error envelope
+			c.JSON(bizErr.StatusCode, gin.H{
+				"type": "error",
+				"error": gin.H{
+					"type":    bizErr.Error.Type,
+					"message": bizErr.Error.Message,
+				},
+			})
+			return
+		}
+		if relayMode == relaymode.GeminiGenerateContent {
+			// Gemini SDKs expect their own error envelope
+			c.JSON(bizErr.StatusCode, gemini.ErrorResponse(bizErr.StatusCode, bizErr.Error.Message))
+			return
+		}
 		c.JSON(bizErr.StatusCode, gin.H{
 			"error": bizErr.Error,
 		})
 	}
 }
 
+// relayWithRetries relays the request to up to attempts channels of the
+// model, never twice in a row to the same channel. The session moves to the
+// channel that serves it. It returns nil on success and the last error
+// otherwise, bizErr if no channel could be tried.
+func relayWithRetries(c *gin.Context, relayMode int, modelName string, attempts int, lastFailedChannelId int, bizErr *model.ErrorWithStatusCode) *model.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	group := c.GetString(ctxkey.Group)
+	userId := c.GetInt(ctxkey.Id)
+	for i := attempts; i > 0; i-- {
+		channel, err := dbmodel.CacheGetRandomSatisfiedChannel(group, modelName, i != attempts)
+		if err != nil {
+			logger.Errorf(ctx, "CacheGetRandomSatisfiedChannel failed: %+v", err)
+			break
+		}
+		logger.Infof(ctx, "using channel #%d for model %s (remain times %d)", channel.Id, modelName, i)
+		if channel.Id == lastFailedChannelId {
+			continue
+		}
+		middleware.SetupContextForSelectedChannel(c, channel, modelName)
+		requestBody, _ := common.GetRequestBody(c)
+		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+		bizErr = relayHelper(c, relayMode)
+		if bizErr == nil {
+			recordRelaySuccess(c)
+			if sessionKey := c.GetString(ctxkey.SessionKey); sessionKey != "" {
+				// the session moves to the channel that served it
+				dbmodel.CacheSetSessionChannel(sessionKey, c.GetInt(ctxkey.ChannelId), c.GetString(ctxkey.ChannelKey))
+			}
+			return nil
+		}
+		lastFailedChannelId = c.GetInt(ctxkey.ChannelId)
+		go monitor.ProcessRelayError(ctx, userId, lastFailedChannelId, c.GetString(ctxkey.ChannelName), c.GetString(ctxkey.ChannelKey), relayLatency(c), *bizErr)
+	}
+	return bizErr
+}
+
+// recordRelaySuccess credits the channel that served the request, which is
+// not the selected one when a hedged request won.
+func recordRelaySuccess(c *gin.Context) {
+	channelId := c.GetInt(ctxkey.ChannelId)
+	monitor.Emit(channelId, true, relayLatency(c))
+	dbmodel.RecordChannelKeyResult(channelId, c.GetString(ctxkey.ChannelKey), true)
+}
+
+// relayLatency is the latency reported to the channel stats: the time to the
+// first byte of the upstream response, 0 if there was no response. Counting
+// the whole relay would penalize long completions and Realtime sessions.
+func relayLatency(c *gin.Context) time.Duration {
+	return c.GetDuration(ctxkey.FirstByteLatency)
+}
+
 func shouldRetry(c *gin.Context, statusCode int) bool {
 	if _, ok := c.Get(ctxkey.SpecificChannelId); ok {
 		return false
@@ -121,14 +201,49 @@ func shouldRetry(c *gin.Context, statusCode int) bool {
 	return true
 }
 
-func processChannelRelayError(ctx context.Context, userId int, channelId int, channelName string, err model.ErrorWithStatusCode) {
-	logger.Errorf(ctx, "relay error (channel id %d, user id: %d): %s", channelId, userId, err.Message)
-	// https://platform.openai.com/docs/guides/error-codes/api-errors
-	if monitor.ShouldDisableChannel(&err.Error, err.StatusCode) {
-		monitor.DisableChannel(channelId, channelName, err.Message)
-	} else {
-		monitor.Emit(channelId, false)
+// shouldFallback reports whether the request can be sent to another model:
+// the model must be in a JSON body, which is rewritten for the fallback model.
+func shouldFallback(c *gin.Context, relayMode int) bool {
+	switch relayMode {
+	case relaymode.ChatCompletions, relaymode.Completions, relaymode.Embeddings,
+		relaymode.ClaudeMessages, relaymode.Responses:
+	default:
+		return false
+	}
+	return strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json")
+}
+
+func isModelAvailable(c *gin.Context, modelName string) bool {
+	availableModels := c.GetString(ctxkey.AvailableModels)
+	if availableModels == "" {
+		return true
+	}
+	for _, availableModel := range strings.Split(availableModels, ",") {
+		if availableModel == modelName {
+			return true
+		}
+	}
+	return false
+}
+
+// setRequestModel replaces the model of the cached request body.
+func setRequestModel(c *gin.Context, modelName string) error {
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return err
+	}
+	var request map[string]any
+	err = json.Unmarshal(requestBody, &request)
+	if err != nil {
+		return err
+	}
+	request["model"] = modelName
+	requestBody, err = json.Marshal(request)
+	if err != nil {
+		return err
 	}
+	c.Set(ctxkey.KeyRequestBody, requestBody)
+	return nil
 }
 
 func RelayNotImplemented(c *gin.Context) {
@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/middleware"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/fallback"
+)
+
+type fallbackUpstream struct {
+	*httptest.Server
+	channel  *dbmodel.Channel
+	requests int32
+	models   chan string
+}
+
+func newFallbackUpstream(t *testing.T, id int, modelName string, priority int64, status int) *fallbackUpstream {
+	upstream := &fallbackUpstream{models: make(chan string, 4)}
+	upstream.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstream.requests, 1)
+		var request struct {
+			Model string `json:"model"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		upstream.models <- request.Model
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			_, _ = fmt.Fprintf(w, `{"id":"chatcmpl-1","object":"chat.completion","model":%q,"choices":[{"index":0,"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`, request.Model)
+		} else {
+			_, _ = w.Write([]byte(`{"error":{"message":"upstream failed","type":"server_error"}}`))
+		}
+	}))
+	t.Cleanup(upstream.Close)
+	baseURL := upstream.URL
+	upstream.channel = &dbmodel.Channel{
+		Id:       id,
+		Type:     channeltype.OpenAI,
+		Key:      "sk-test",
+		Status:   dbmodel.ChannelStatusEnabled,
+		Name:     fmt.Sprintf("channel-%d", id),
+		Group:    "default",
+		Models:   modelName,
+		BaseURL:  &baseURL,
+		Priority: &priority,
+	}
+	return upstream
+}
+
+func setupFallback(t *testing.T, upstreams ...*fallbackUpstream) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	redisEnabled, memoryCacheEnabled, retryTimes := common.RedisEnabled, config.MemoryCacheEnabled, config.RetryTimes
+	approximateTokenEnabled, sessionAffinityEnabled := config.ApproximateTokenEnabled, config.SessionAffinityEnabled
+	common.RedisEnabled, config.MemoryCacheEnabled, config.RetryTimes = false, false, 2
+	// the tokenizer is not loaded in tests
+	config.ApproximateTokenEnabled, config.SessionAffinityEnabled = true, true
+	t.Cleanup(func() {
+		common.RedisEnabled, config.MemoryCacheEnabled, config.RetryTimes = redisEnabled, memoryCacheEnabled, retryTimes
+		config.ApproximateTokenEnabled, config.SessionAffinityEnabled = approximateTokenEnabled, sessionAffinityEnabled
+		_ = fallback.UpdateModelFallbackByJSONString(`{}`)
+	})
+	dbmodel.DB, dbmodel.LOG_DB = db, db
+	require.NoError(t, db.AutoMigrate(&dbmodel.User{}, &dbmodel.Token{}, &dbmodel.Channel{}, &dbmodel.Ability{}, &dbmodel.Log{}, &dbmodel.LedgerEntry{}))
+	require.NoError(t, db.Create(&dbmodel.User{Id: 1, Username: "user", Group: "default", Quota: 1 << 40}).Error)
+	require.NoError(t, db.Create(&dbmodel.Token{Id: 1, UserId: 1, Key: "token", Status: dbmodel.TokenStatusEnabled, UnlimitedQuota: true}).Error)
+	for _, upstream := range upstreams {
+		require.NoError(t, db.Create(upstream.channel).Error)
+		require.NoError(t, db.Create(&dbmodel.Ability{Group: "default", Model: upstream.channel.Models, ChannelId: upstream.channel.Id, Enabled: true, Priority: upstream.channel.Priority}).Error)
+	}
+	require.NoError(t, fallback.UpdateModelFallbackByJSONString(`{"gpt-4o": ["gpt-4o-mini"]}`))
+}
+
+func TestRelayFallback(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	client.Init()
+	// within a model, the first try goes to the top tier and the retries below it
+	primary := newFallbackUpstream(t, 4001, "gpt-4o", 10, http.StatusInternalServerError)
+	retried := newFallbackUpstream(t, 4002, "gpt-4o", 0, http.StatusInternalServerError)
+	fallbackFailed := newFallbackUpstream(t, 4003, "gpt-4o-mini", 10, http.StatusInternalServerError)
+	fallbackServed := newFallbackUpstream(t, 4004, "gpt-4o-mini", 0, http.StatusOK)
+	setupFallback(t, primary, retried, fallbackFailed, fallbackServed)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set(ctxkey.Id, 1)
+	c.Set(ctxkey.TokenId, 1)
+	c.Set(ctxkey.Group, "default")
+	c.Set(ctxkey.RequestModel, "gpt-4o")
+	c.Set(ctxkey.SessionKey, "1:gpt-4o:conversation")
+	middleware.SetupContextForSelectedChannel(c, primary.channel, "gpt-4o")
+	Relay(c)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"model":"gpt-4o-mini"`)
+	for _, upstream := range []*fallbackUpstream{primary, retried, fallbackFailed, fallbackServed} {
+		assert.Equal(t, int32(1), atomic.LoadInt32(&upstream.requests), upstream.channel.Name)
+	}
+	assert.Equal(t, "gpt-4o", <-retried.models)
+	assert.Equal(t, "gpt-4o-mini", <-fallbackFailed.models)
+	assert.Equal(t, "gpt-4o-mini", <-fallbackServed.models)
+	assert.Equal(t, "gpt-4o", c.GetString(ctxkey.FallbackFrom))
+	assert.Equal(t, fallbackServed.channel.Id, c.GetInt(ctxkey.ChannelId))
+	channelId, _ := dbmodel.CacheGetSessionChannel("1:gpt-4o:conversation")
+	assert.Equal(t, fallbackServed.channel.Id, channelId)
+
+	// billing finishes in the background, on the channel and model that served
+	require.Eventually(t, func() bool {
+		channel, err := dbmodel.GetChannelById(fallbackServed.channel.Id, true)
+		return err == nil && channel.UsedQuota > 0
+	}, time.Second, 10*time.Millisecond)
+	var log dbmodel.Log
+	require.NoError(t, dbmodel.LOG_DB.Where("channel_id = ?", fallbackServed.channel.Id).First(&log).Error)
+	assert.Equal(t, "gpt-4o-mini", log.ModelName)
+	assert.Contains(t, log.Content, "gpt-4o → gpt-4o-mini")
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/songquanpeng/one-api/model"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 func GetAllTokens(c *gin.Context) {
@@ -104,6 +105,7 @@ func GetTokenStatus(c *gin.Context) {
 		"total_used":      0, // not supported currently
 		"total_available": token.RemainQuota,
 		"expires_at":      expiredAt * 1000,
+		"budget":          token.Budget.Status(time.Now()),
 	})
 }
 
@@ -111,6 +113,12 @@ func validateToken(c *gin.Context, token model.Token) error {
 	if len(token.Name) > 30 {
 		return fmt.Errorf("Token name too long")
 	}
+	if token.RPM < 0 || token.TPM < 0 || token.MaxConcurrency < 0 {
+		return fmt.Errorf("Rate limit cannot be negative")
+	}
+	if token.DailyBudget < 0 || token.MonthlyBudget < 0 {
+		return fmt.Errorf("Budget cannot be negative")
+	}
 	if token.Subnet != nil && *token.Subnet != "" {
 		err := network.IsValidSubnets(*token.Subnet)
 		if err != nil {
@@ -150,6 +158,13 @@ func AddToken(c *gin.Context) {
 		UnlimitedQuota: token.UnlimitedQuota,
 		Models:         token.Models,
 		Subnet:         token.Subnet,
+		RPM:            token.RPM,
+		TPM:            token.TPM,
+		MaxConcurrency: token.MaxConcurrency,
+		Budget: model.Budget{
+			DailyBudget:   token.DailyBudget,
+			MonthlyBudget: token.MonthlyBudget,
+		},
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -239,6 +254,11 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.UnlimitedQuota = token.UnlimitedQuota
 		cleanToken.Models = token.Models
 		cleanToken.Subnet = token.Subnet
+		cleanToken.RPM = token.RPM
+		cleanToken.TPM = token.TPM
+		cleanToken.MaxConcurrency = token.MaxConcurrency
+		cleanToken.DailyBudget = token.DailyBudget
+		cleanToken.MonthlyBudget = token.MonthlyBudget
 	}
 	err = cleanToken.Update()
 	if err != nil {
@@ -14,6 +14,7 @@ import (
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/i18n"
+	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/common/random"
 	"github.com/songquanpeng/one-api/model"
 )
@@ -379,10 +380,16 @@ func GetUserDashboard(c *gin.Context) {
 		})
 		return
 	}
+	// the statistics are still shown without the budget
+	budget, err := model.GetUserBudgetStatus(id)
+	if err != nil {
+		logger.Errorf(c.Request.Context(), "failed to get budget of user %d: %s", id, err.Error())
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
 		"data":    dashboards,
+		"budget":  budget,
 	})
 	return
 }
@@ -513,6 +520,13 @@ func UpdateUser(c *gin.Context) {
 		})
 		return
 	}
+	if updatedUser.DailyBudget < 0 || updatedUser.MonthlyBudget < 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Budget cannot be negative",
+		})
+		return
+	}
 	if updatedUser.Password == "$I_LOVE_U" {
 		updatedUser.Password = "" // rollback to what it should be
 	}
@@ -524,6 +538,13 @@ func UpdateUser(c *gin.Context) {
 		})
 		return
 	}
+	if err := updatedUser.UpdateBudget(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	if originUser.Quota != updatedUser.Quota {
 		model.RecordLog(ctx, originUser.Id, model.LogTypeManage, fmt.Sprintf("Administrator changed user quota from %s to %s", common.LogQuota(originUser.Quota), common.LogQuota(updatedUser.Quota)))
 	}
@@ -901,7 +922,7 @@ func AdminTopUp(c *gin.Context) {
 		})
 		return
 	}
-	err = model.IncreaseUserQuota(req.UserId, int64(req.Quota))
+	err = model.IncreaseUserQuota(ctx, req.UserId, int64(req.Quota), model.LedgerTypeTopup)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// getWebhookOwnerId returns 0, the owner of the system webhooks, when an
+// administrator asks for scope=system, or the id of the current user.
+func getWebhookOwnerId(c *gin.Context) int {
+	if c.Query("scope") == "system" && c.GetInt(ctxkey.Role) >= model.RoleAdminUser {
+		return 0
+	}
+	return c.GetInt(ctxkey.Id)
+}
+
+func GetWebhooks(c *gin.Context) {
+	webhooks, err := model.GetWebhooks(getWebhookOwnerId(c))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    webhooks,
+	})
+}
+
+func AddWebhook(c *gin.Context) {
+	webhook := model.Webhook{}
+	err := c.ShouldBindJSON(&webhook)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanWebhook := model.Webhook{
+		UserId: getWebhookOwnerId(c),
+		Name:   webhook.Name,
+		URL:    webhook.URL,
+		Secret: webhook.Secret,
+		Events: webhook.Events,
+		Status: model.WebhookStatusEnabled,
+	}
+	if err = cleanWebhook.Validate(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err = cleanWebhook.Insert(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanWebhook,
+	})
+}
+
+func UpdateWebhook(c *gin.Context) {
+	webhook := model.Webhook{}
+	err := c.ShouldBindJSON(&webhook)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanWebhook, err := model.GetWebhookById(webhook.Id, getWebhookOwnerId(c))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanWebhook.Name = webhook.Name
+	cleanWebhook.URL = webhook.URL
+	cleanWebhook.Events = webhook.Events
+	if webhook.Secret != "" {
+		cleanWebhook.Secret = webhook.Secret
+	}
+	if webhook.Status == model.WebhookStatusEnabled || webhook.Status == model.WebhookStatusDisabled {
+		cleanWebhook.Status = webhook.Status
+	}
+	if err = cleanWebhook.Validate(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err = cleanWebhook.Update(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanWebhook,
+	})
+}
+
+func DeleteWebhook(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	err := model.DeleteWebhookById(id, getWebhookOwnerId(c))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func GetWebhookDeliveries(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	webhookId, _ := strconv.Atoi(c.Query("webhook_id"))
+	deliveries, err := model.GetWebhookDeliveries(getWebhookOwnerId(c), webhookId, p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	// the responses are only shown to administrators, so webhooks can not be
+	// used to read from where the server can reach
+	if c.GetInt(ctxkey.Role) < model.RoleAdminUser {
+		for _, delivery := range deliveries {
+			delivery.Response = ""
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    deliveries,
+	})
+}
@@ -83,6 +83,10 @@ func main() {
 		}
 		go controller.AutomaticallyTestChannels(frequency)
 	}
+	if config.IsMasterNode {
+		go controller.AutomaticallySettleBatches(config.BatchSettleFrequency)
+		model.StartWebhookDeliveryCleanupRoutine()
+	}
 	if os.Getenv("BATCH_UPDATE_ENABLED") == "true" {
 		config.BatchUpdateEnabled = true
 		logger.SysLog("batch update enabled with interval " + strconv.Itoa(config.BatchUpdateInterval) + "s")
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	"github.com/songquanpeng/one-api/common/blacklist"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/network"
@@ -92,6 +93,27 @@ func TokenAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
 		key := c.Request.Header.Get("Authorization")
+		if key == "" {
+			// Anthropic SDKs send the key in x-api-key
+			key = c.Request.Header.Get("x-api-key")
+		}
+		if key == "" {
+			// Gemini SDKs send the key in x-goog-api-key or the key query parameter
+			key = c.Request.Header.Get("x-goog-api-key")
+		}
+		if key == "" && isGeminiRequest(c) {
+			// only the native Gemini API takes the key from the query, which
+			// ends up in access logs
+			key = c.Query("key")
+		}
+		if key == "" {
+			// browsers pass the key of a realtime session as a WebSocket subprotocol
+			for _, protocol := range websocket.Subprotocols(c.Request) {
+				if strings.HasPrefix(protocol, "openai-insecure-api-key.") {
+					key = strings.TrimPrefix(protocol, "openai-insecure-api-key.")
+				}
+			}
+		}
 		key = strings.TrimPrefix(key, "Bearer ")
 		key = strings.TrimPrefix(key, "sk-")
 		parts := strings.Split(key, "-")
@@ -132,6 +154,9 @@ func TokenAuth() func(c *gin.Context) {
 		c.Set(ctxkey.Id, token.UserId)
 		c.Set(ctxkey.TokenId, token.Id)
 		c.Set(ctxkey.TokenName, token.Name)
+		c.Set(ctxkey.TokenRPM, token.RPM)
+		c.Set(ctxkey.TokenTPM, token.TPM)
+		c.Set(ctxkey.TokenConcurrency, token.MaxConcurrency)
 		if len(parts) > 1 {
 			if model.IsAdmin(token.UserId) {
 				c.Set(ctxkey.SpecificChannelId, parts[1])
@@ -163,5 +188,20 @@ func shouldCheckModel(c *gin.Context) bool {
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/audio") {
 		return true
 	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/messages") {
+		return true
+	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/responses") {
+		return true
+	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/realtime") {
+		return true
+	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/rerank") {
+		return true
+	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1beta/models/") {
+		return true
+	}
 	return false
 }
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenAuthErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(TokenAuth())
+	router.POST("/*path", func(c *gin.Context) {})
+
+	t.Run("the key query parameter is ignored outside /v1beta", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions?key=sk-leaked", nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		var body struct {
+			Error struct {
+				Message string `json:"message"`
+				Type    string `json:"type"`
+			} `json:"error"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Contains(t, body.Error.Message, "Token not provided")
+		assert.Equal(t, "one_api_error", body.Error.Type)
+	})
+
+	t.Run("errors on /v1beta use the Gemini envelope", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1beta/models/gemini-2.0-flash:generateContent", nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		var body struct {
+			Error struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+				Status  string `json:"status"`
+			} `json:"error"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, http.StatusUnauthorized, body.Error.Code)
+		assert.Equal(t, "UNAUTHENTICATED", body.Error.Status)
+		assert.Contains(t, body.Error.Message, "Token not provided")
+	})
+}
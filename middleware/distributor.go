@@ -4,13 +4,18 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
 type ModelRequest struct {
@@ -25,6 +30,13 @@ func Distribute() func(c *gin.Context) {
 		c.Set(ctxkey.Group, userGroup)
 		var requestModel string
 		var channel *model.Channel
+		if relayMode := relaymode.GetByPath(c.Request.URL.Path); relayMode == relaymode.Files || relayMode == relaymode.Batches {
+			statusCode, err := setBatchChannel(c, relayMode)
+			if err != nil {
+				abortWithMessage(c, statusCode, err.Error())
+				return
+			}
+		}
 		channelId, ok := c.Get(ctxkey.SpecificChannelId)
 		if ok {
 			id, err := strconv.Atoi(channelId.(string))
@@ -43,8 +55,21 @@ func Distribute() func(c *gin.Context) {
 			}
 		} else {
 			requestModel = c.GetString(ctxkey.RequestModel)
+			sessionKey := getSessionKey(c, userId, requestModel)
+			if sessionKey != "" {
+				if sessionChannelId, keyHash := model.CacheGetSessionChannel(sessionKey); sessionChannelId != 0 {
+					// a disabled channel falls back to the normal selection
+					channel = model.CacheGetSatisfiedChannelById(userGroup, requestModel, sessionChannelId)
+					if channel != nil {
+						// prompt caches are per key as well, a disabled key is replaced
+						c.Set(ctxkey.SpecificChannelKey, channel.GetKeyByHash(keyHash))
+					}
+				}
+			}
 			var err error
-			channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, requestModel, false)
+			if channel == nil {
+				channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, requestModel, false)
+			}
 			if err != nil {
 				message := fmt.Sprintf("当前分组 %s 下对于模型 %s 无可用渠道", userGroup, requestModel)
 				if channel != nil {
@@ -54,13 +79,79 @@ func Distribute() func(c *gin.Context) {
 				abortWithMessage(c, http.StatusServiceUnavailable, message)
 				return
 			}
+			if sessionKey != "" {
+				c.Set(ctxkey.SessionKey, sessionKey)
+			}
 		}
 		logger.Debugf(ctx, "user id %d, user group: %s, request model: %s, using channel #%d", userId, userGroup, requestModel, channel.Id)
 		SetupContextForSelectedChannel(c, channel, requestModel)
+		if sessionKey := c.GetString(ctxkey.SessionKey); sessionKey != "" {
+			model.CacheSetSessionChannel(sessionKey, channel.Id, c.GetString(ctxkey.ChannelKey))
+		}
 		c.Next()
 	}
 }
 
+// getSessionKey identifies the conversation of a request, so that its turns
+// hit the same upstream and benefit from prompt caching.
+func getSessionKey(c *gin.Context, userId int, requestModel string) string {
+	if !config.SessionAffinityEnabled {
+		return ""
+	}
+	sessionId := c.Request.Header.Get("X-Session-Id")
+	if sessionId == "" && strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		var sessionRequest struct {
+			User string `json:"user"`
+		}
+		_ = common.UnmarshalBodyReusable(c, &sessionRequest)
+		sessionId = sessionRequest.User
+	}
+	if sessionId == "" {
+		return ""
+	}
+	return fmt.Sprintf("%d:%s:%s", userId, requestModel, sessionId)
+}
+
+// setBatchChannel pins Files and Batch API calls to the channel that owns the
+// referenced object, or to the configured batch channel for new objects.
+func setBatchChannel(c *gin.Context, relayMode int) (int, error) {
+	objectType := model.RelayObjectTypeFile
+	objectId := c.Param("id")
+	if relayMode == relaymode.Batches {
+		objectType = model.RelayObjectTypeBatch
+		if objectId == "" && c.Request.Method == http.MethodPost {
+			// a new batch must run where its input file lives
+			var batchRequest struct {
+				InputFileId string `json:"input_file_id"`
+			}
+			err := common.UnmarshalBodyReusable(c, &batchRequest)
+			if err != nil || batchRequest.InputFileId == "" {
+				return http.StatusBadRequest, fmt.Errorf("input_file_id is required")
+			}
+			objectType = model.RelayObjectTypeFile
+			objectId = batchRequest.InputFileId
+		}
+	}
+	if objectId != "" {
+		object, err := model.GetUserRelayObject(objectId, objectType, c.GetInt(ctxkey.Id))
+		if err != nil {
+			return http.StatusNotFound, fmt.Errorf("No such object: '%s'", objectId)
+		}
+		c.Set(ctxkey.SpecificChannelId, strconv.Itoa(object.ChannelId))
+		// the object only exists for the key that created it
+		c.Set(ctxkey.SpecificChannelKey, object.ChannelKey)
+		return 0, nil
+	}
+	if _, ok := c.Get(ctxkey.SpecificChannelId); ok {
+		return 0, nil
+	}
+	if config.BatchChannelId == 0 {
+		return http.StatusServiceUnavailable, fmt.Errorf("Files and Batch APIs are not enabled, no batch channel configured")
+	}
+	c.Set(ctxkey.SpecificChannelId, strconv.Itoa(config.BatchChannelId))
+	return 0, nil
+}
+
 func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, modelName string) {
 	c.Set(ctxkey.Channel, channel.Type)
 	c.Set(ctxkey.ChannelId, channel.Id)
@@ -70,7 +161,19 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	}
 	c.Set(ctxkey.ModelMapping, channel.GetModelMapping())
 	c.Set(ctxkey.OriginalModel, modelName) // for retry
-	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+	c.Set(ctxkey.FirstByteLatency, time.Duration(0))
+	key := c.GetString(ctxkey.SpecificChannelKey)
+	// the key only applies to the first selection, retries pick their own
+	c.Set(ctxkey.SpecificChannelKey, "")
+	if key == "" || !channel.HasKey(key) {
+		key = model.PickChannelKey(channel)
+	}
+	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
+	if channel.IsMultiKey() {
+		c.Set(ctxkey.ChannelKey, key)
+	} else {
+		c.Set(ctxkey.ChannelKey, "")
+	}
 	c.Set(ctxkey.BaseURL, channel.GetBaseURL())
 	cfg, _ := channel.LoadConfig()
 	// this is for backward compatibility
@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func setupDistributorDB(t *testing.T, channels ...*model.Channel) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	redisEnabled, memoryCacheEnabled, sessionAffinityEnabled := common.RedisEnabled, config.MemoryCacheEnabled, config.SessionAffinityEnabled
+	common.RedisEnabled, config.MemoryCacheEnabled, config.SessionAffinityEnabled = false, false, true
+	model.DB = db
+	t.Cleanup(func() {
+		common.RedisEnabled, config.MemoryCacheEnabled, config.SessionAffinityEnabled = redisEnabled, memoryCacheEnabled, sessionAffinityEnabled
+		model.DB = nil
+	})
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.Channel{}, &model.Ability{}, &model.RelayObject{}))
+	require.NoError(t, db.Create(&model.User{Id: 1, Username: "user", Group: "default"}).Error)
+	for _, channel := range channels {
+		require.NoError(t, db.Create(channel).Error)
+		require.NoError(t, db.Create(&model.Ability{Group: "default", Model: channel.Models, ChannelId: channel.Id, Enabled: true}).Error)
+	}
+}
+
+func TestDistributeSessionAffinity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	channel := &model.Channel{
+		Id:     3001,
+		Type:   1,
+		Key:    "sk-a\nsk-b\nsk-c",
+		Status: model.ChannelStatusEnabled,
+		Name:   "multi-key",
+		Group:  "default",
+		Models: "gpt-4o",
+		Config: `{"multi_key":true}`,
+	}
+	setupDistributorDB(t, channel)
+
+	distribute := func(sessionId string) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Request.Header.Set("X-Session-Id", sessionId)
+		c.Set(ctxkey.Id, 1)
+		c.Set(ctxkey.RequestModel, "gpt-4o")
+		Distribute()(c)
+		require.False(t, c.IsAborted())
+		return c
+	}
+
+	first := distribute("conversation")
+	key := first.GetString(ctxkey.ChannelKey)
+	require.NotEmpty(t, key)
+	assert.Equal(t, "Bearer "+key, first.Request.Header.Get("Authorization"))
+	// the key is only a hint for the first selection
+	assert.Empty(t, first.GetString(ctxkey.SpecificChannelKey))
+
+	// other sessions move the round robin along, the session keeps its key
+	for i := 0; i < 3; i++ {
+		other := distribute(fmt.Sprintf("other-%d", i))
+		assert.Equal(t, channel.Id, other.GetInt(ctxkey.ChannelId))
+		next := distribute("conversation")
+		assert.Equal(t, channel.Id, next.GetInt(ctxkey.ChannelId))
+		assert.Equal(t, key, next.GetString(ctxkey.ChannelKey))
+	}
+}
+
+func TestDistributeBatchChannel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	batchChannel := &model.Channel{Id: 3101, Type: 1, Key: "sk-batch", Status: model.ChannelStatusEnabled, Name: "batch", Group: "default", Models: "gpt-4o"}
+	ownerChannel := &model.Channel{Id: 3102, Type: 1, Key: "sk-a\nsk-b", Status: model.ChannelStatusEnabled, Name: "owner", Group: "default", Models: "gpt-4o", Config: `{"multi_key":true}`}
+	setupDistributorDB(t, batchChannel, ownerChannel)
+	batchChannelId := config.BatchChannelId
+	t.Cleanup(func() { config.BatchChannelId = batchChannelId })
+	// the file was uploaded with the second key of the owner channel
+	require.NoError(t, (&model.RelayObject{ObjectId: "file-1", Type: model.RelayObjectTypeFile, UserId: 1, ChannelId: ownerChannel.Id, ChannelKey: "sk-b"}).Insert())
+	require.NoError(t, (&model.RelayObject{ObjectId: "batch-1", Type: model.RelayObjectTypeBatch, UserId: 1, ChannelId: ownerChannel.Id, ChannelKey: "sk-b"}).Insert())
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		userId := 1
+		if c.GetHeader("X-Test-User") == "other" {
+			userId = 2
+		}
+		c.Set(ctxkey.Id, userId)
+	}, Distribute())
+	handler := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"channel_id": c.GetInt(ctxkey.ChannelId), "authorization": c.Request.Header.Get("Authorization")})
+	}
+	router.POST("/v1/files", handler)
+	router.GET("/v1/files/:id", handler)
+	router.POST("/v1/batches", handler)
+	router.GET("/v1/batches/:id", handler)
+
+	serve := func(method string, path string, body string, user string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		if user != "" {
+			request.Header.Set("X-Test-User", user)
+		}
+		router.ServeHTTP(w, request)
+		return w
+	}
+
+	config.BatchChannelId = 0
+	assert.Equal(t, http.StatusServiceUnavailable, serve(http.MethodPost, "/v1/files", "", "").Code)
+
+	config.BatchChannelId = batchChannel.Id
+	cases := []struct {
+		name          string
+		method        string
+		path          string
+		body          string
+		user          string
+		status        int
+		channelId     int
+		authorization string
+	}{
+		{"new files go to the batch channel", http.MethodPost, "/v1/files", "", "", http.StatusOK, batchChannel.Id, "Bearer sk-batch"},
+		{"files stay with the channel and key that own them", http.MethodGet, "/v1/files/file-1", "", "", http.StatusOK, ownerChannel.Id, "Bearer sk-b"},
+		{"batches stay with the channel and key that own them", http.MethodGet, "/v1/batches/batch-1", "", "", http.StatusOK, ownerChannel.Id, "Bearer sk-b"},
+		{"new batches run where their input file lives", http.MethodPost, "/v1/batches", `{"input_file_id":"file-1"}`, "", http.StatusOK, ownerChannel.Id, "Bearer sk-b"},
+		{"new batches need an input file", http.MethodPost, "/v1/batches", `{}`, "", http.StatusBadRequest, 0, ""},
+		{"unknown objects are not found", http.MethodGet, "/v1/files/file-2", "", "", http.StatusNotFound, 0, ""},
+		{"objects of other users are not found", http.MethodGet, "/v1/files/file-1", "", "other", http.StatusNotFound, 0, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := serve(tc.method, tc.path, tc.body, tc.user)
+			require.Equal(t, tc.status, w.Code, w.Body.String())
+			if tc.status != http.StatusOK {
+				return
+			}
+			var body struct {
+				ChannelId     int    `json:"channel_id"`
+				Authorization string `json:"authorization"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, tc.channelId, body.ChannelId)
+			assert.Equal(t, tc.authorization, body.Authorization)
+		})
+	}
+}
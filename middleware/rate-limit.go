@@ -2,14 +2,22 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/ratelimit"
 )
 
 var timeFormat = "2006-01-02T15:04:05.000Z"
@@ -109,3 +117,118 @@ func DownloadRateLimit() func(c *gin.Context) {
 func UploadRateLimit() func(c *gin.Context) {
 	return rateLimitFactory(config.UploadRateLimitNum, config.UploadRateLimitDuration, "UP")
 }
+
+func setRateLimitHeaders(c *gin.Context, kind string, limit int, result *common.TokenBucketResult) {
+	c.Header("x-ratelimit-limit-"+kind, strconv.Itoa(limit))
+	c.Header("x-ratelimit-remaining-"+kind, strconv.FormatInt(result.Remaining(), 10))
+	c.Header("x-ratelimit-reset-"+kind, result.ResetAfter(int64(limit)).Round(time.Millisecond).String())
+}
+
+func abortWithRateLimit(c *gin.Context, kind string, limit int, result *common.TokenBucketResult) {
+	retryAfter := result.RetryAfter(int64(limit), 1)
+	c.Header("retry-after", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	message := fmt.Sprintf("Rate limit reached for %s per min (RPM): Limit %d, please try again in %s", kind, limit, retryAfter.Round(time.Millisecond))
+	if kind == "tokens" {
+		message = fmt.Sprintf("Rate limit reached for tokens per min (TPM): Limit %d, please try again in %s", limit, retryAfter.Round(time.Millisecond))
+	}
+	abortWithError(c, http.StatusTooManyRequests, gin.H{
+		"message": helper.MessageWithRequestId(message, c.GetString(helper.RequestIdKey)),
+		"type":    kind,
+		"param":   nil,
+		"code":    "rate_limit_exceeded",
+	})
+	logger.Warn(c.Request.Context(), message)
+}
+
+// TokenRateLimit enforces the requests-per-minute and tokens-per-minute limit
+// of the token of a relay request, see ratelimit.GetRateLimit.
+func TokenRateLimit() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		tokenId := c.GetInt(ctxkey.TokenId)
+		group, err := model.CacheGetUserGroup(c.GetInt(ctxkey.Id))
+		if err != nil {
+			abortWithMessage(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		limit := ratelimit.GetRateLimit(group, c.GetInt(ctxkey.TokenRPM), c.GetInt(ctxkey.TokenTPM))
+		if limit.RPM <= 0 && limit.TPM <= 0 {
+			c.Next()
+			return
+		}
+		result, err := ratelimit.Take(ctx, tokenId, limit)
+		if err != nil {
+			// a broken limiter should not take the relay down with it
+			logger.Error(ctx, "rate limiter failed: "+err.Error())
+			c.Next()
+			return
+		}
+		if result.Tokens != nil {
+			setRateLimitHeaders(c, "tokens", limit.TPM, result.Tokens)
+			if !result.Tokens.Allowed {
+				abortWithRateLimit(c, "tokens", limit.TPM, result.Tokens)
+				return
+			}
+			c.Set(ctxkey.RateLimitTPM, limit.TPM)
+		}
+		if result.Requests != nil {
+			setRateLimitHeaders(c, "requests", limit.RPM, result.Requests)
+			if !result.Requests.Allowed {
+				abortWithRateLimit(c, "requests", limit.RPM, result.Requests)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+func abortWithConcurrencyLimit(c *gin.Context, scope string, limit int, err error) {
+	message := fmt.Sprintf("Concurrency limit reached for this %s: Limit %d, please try again later", scope, limit)
+	if errors.Is(err, common.ErrSemaphoreTimeout) {
+		message = fmt.Sprintf("Concurrency limit reached for this %s: Limit %d, timed out after waiting %ds in queue", scope, limit, config.ConcurrencyQueueTimeout)
+	}
+	abortWithError(c, http.StatusTooManyRequests, gin.H{
+		"message": helper.MessageWithRequestId(message, c.GetString(helper.RequestIdKey)),
+		"type":    "requests",
+		"param":   nil,
+		"code":    "concurrency_limit_exceeded",
+	})
+	logger.Warn(c.Request.Context(), message)
+}
+
+// ConcurrencyLimit caps the requests in flight per token and per group.
+// Requests over the limit wait in a first come, first served queue, and are
+// rejected once the queue is full or they have waited too long. It runs
+// before TokenRateLimit so that a request rejected here does not use up the
+// requests-per-minute limit.
+func ConcurrencyLimit() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		group, err := model.CacheGetUserGroup(c.GetInt(ctxkey.Id))
+		if err != nil {
+			abortWithMessage(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		semaphores := []struct {
+			scope string
+			key   string
+			limit int
+		}{
+			{"token", fmt.Sprintf("concurrency:token:%d", c.GetInt(ctxkey.TokenId)), c.GetInt(ctxkey.TokenConcurrency)},
+			{"group", "concurrency:group:" + group, ratelimit.GetGroupConcurrency(group)},
+		}
+		deadline := time.Now().Add(time.Duration(config.ConcurrencyQueueTimeout) * time.Second)
+		for _, semaphore := range semaphores {
+			if semaphore.limit <= 0 {
+				continue
+			}
+			release, err := common.AcquireSemaphore(ctx, semaphore.key, semaphore.limit, time.Until(deadline), config.ConcurrencyQueueSize)
+			if err != nil {
+				abortWithConcurrencyLimit(c, semaphore.scope, semaphore.limit, err)
+				return
+			}
+			defer release()
+		}
+		c.Next()
+	}
+}
@@ -6,17 +6,34 @@ import (
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/adaptor/gemini"
 	"strings"
 )
 
+// isGeminiRequest reports whether the request is for the native Gemini API.
+func isGeminiRequest(c *gin.Context) bool {
+	return strings.HasPrefix(c.Request.URL.Path, "/v1beta/")
+}
+
+// abortWithError writes err in the OpenAI envelope, or the Gemini one for the
+// native Gemini API, and aborts the request.
+func abortWithError(c *gin.Context, statusCode int, err gin.H) {
+	if isGeminiRequest(c) {
+		message, _ := err["message"].(string)
+		c.JSON(statusCode, gemini.ErrorResponse(statusCode, message))
+	} else {
+		c.JSON(statusCode, gin.H{
+			"error": err,
+		})
+	}
+	c.Abort()
+}
+
 func abortWithMessage(c *gin.Context, statusCode int, message string) {
-	c.JSON(statusCode, gin.H{
-		"error": gin.H{
-			"message": helper.MessageWithRequestId(message, c.GetString(helper.RequestIdKey)),
-			"type":    "one_api_error",
-		},
+	abortWithError(c, statusCode, gin.H{
+		"message": helper.MessageWithRequestId(message, c.GetString(helper.RequestIdKey)),
+		"type":    "one_api_error",
 	})
-	c.Abort()
 	logger.Error(c.Request.Context(), message)
 }
 
@@ -36,11 +53,23 @@ func getRequestModel(c *gin.Context) (string, error) {
 			modelRequest.Model = c.Param("model")
 		}
 	}
-	if strings.HasPrefix(c.Request.URL.Path, "/v1/images/generations") {
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/images/") {
 		if modelRequest.Model == "" {
 			modelRequest.Model = "dall-e-2"
 		}
 	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/realtime") {
+		// realtime sessions are WebSocket upgrades, the model is in the query
+		modelRequest.Model = c.Query("model")
+	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1beta/models/") {
+		// the native Gemini API carries the model in the path: /v1beta/models/{model}:{action}
+		modelAction := strings.TrimPrefix(c.Request.URL.Path, "/v1beta/models/")
+		if i := strings.LastIndex(modelAction, ":"); i >= 0 {
+			modelAction = modelAction[:i]
+		}
+		modelRequest.Model = modelAction
+	}
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/audio/transcriptions") || strings.HasPrefix(c.Request.URL.Path, "/v1/audio/translations") {
 		if modelRequest.Model == "" {
 			modelRequest.Model = "whisper-1"
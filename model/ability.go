@@ -2,6 +2,7 @@ package model
 
 import (
 	"context"
+	"math/rand"
 	"sort"
 	"strings"
 
@@ -20,7 +21,6 @@ type Ability struct {
 }
 
 func GetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority bool) (*Channel, error) {
-	ability := Ability{}
 	groupCol := "`group`"
 	trueVal := "1"
 	if common.UsingPostgreSQL {
@@ -29,25 +29,44 @@ func GetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority b
 	}
 
 	var err error = nil
-	var channelQuery *gorm.DB
-	if ignoreFirstPriority {
-		channelQuery = DB.Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, model)
-	} else {
-		maxPrioritySubQuery := DB.Model(&Ability{}).Select("MAX(priority)").Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, model)
-		channelQuery = DB.Where(groupCol+" = ? and model = ? and enabled = "+trueVal+" and priority = (?)", group, model, maxPrioritySubQuery)
+	var channelIds []int
+	err = DB.Model(&Ability{}).Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, model).Pluck("channel_id", &channelIds).Error
+	if err != nil {
+		return nil, err
 	}
-	if common.UsingSQLite || common.UsingPostgreSQL {
-		err = channelQuery.Order("RANDOM()").First(&ability).Error
-	} else {
-		err = channelQuery.Order("RAND()").First(&ability).Error
+	if len(channelIds) == 0 {
+		return nil, gorm.ErrRecordNotFound
 	}
+	var channels []*Channel
+	err = DB.Where("id in ?", channelIds).Find(&channels).Error
 	if err != nil {
 		return nil, err
 	}
-	channel := Channel{}
-	channel.Id = ability.ChannelId
-	err = DB.First(&channel, "id = ?", ability.ChannelId).Error
-	return &channel, err
+	// the tiers are chosen the same way as from the memory cache
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].GetPriority() > channels[j].GetPriority()
+	})
+	channels = filterChannels(channels)
+	if len(channels) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return selectChannelByPriority(channels, ignoreFirstPriority), nil
+}
+
+// pickChannelByWeight chooses a channel at random, in proportion to its weight.
+func pickChannelByWeight(channels []*Channel) *Channel {
+	totalWeight := 0
+	for _, channel := range channels {
+		totalWeight += channel.GetWeight()
+	}
+	target := rand.Intn(totalWeight)
+	for _, channel := range channels {
+		target -= channel.GetWeight()
+		if target < 0 {
+			return channel
+		}
+	}
+	return channels[len(channels)-1]
 }
 
 func (channel *Channel) AddAbilities() error {
@@ -0,0 +1,199 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+const sampleCount = 100000
+
+func newWeightedChannel(id int, priority int64, weight uint) *Channel {
+	return &Channel{
+		Id:       id,
+		Status:   ChannelStatusEnabled,
+		Group:    "default",
+		Models:   "gpt-4o",
+		Priority: &priority,
+		Weight:   &weight,
+	}
+}
+
+func countPicks(pick func() *Channel) map[int]int {
+	counts := make(map[int]int)
+	for i := 0; i < sampleCount; i++ {
+		counts[pick().Id]++
+	}
+	return counts
+}
+
+func TestPickChannelByWeight(t *testing.T) {
+	Convey("pick channel by weight", t, func() {
+		Convey("traffic follows the weights", func() {
+			channels := []*Channel{newWeightedChannel(1, 0, 80), newWeightedChannel(2, 0, 20)}
+			counts := countPicks(func() *Channel { return pickChannelByWeight(channels) })
+			So(float64(counts[1])/sampleCount, ShouldAlmostEqual, 0.8, 0.01)
+			So(float64(counts[2])/sampleCount, ShouldAlmostEqual, 0.2, 0.01)
+		})
+		Convey("channels without a weight are picked uniformly", func() {
+			channels := []*Channel{newWeightedChannel(1, 0, 0), newWeightedChannel(2, 0, 0)}
+			counts := countPicks(func() *Channel { return pickChannelByWeight(channels) })
+			So(float64(counts[1])/sampleCount, ShouldAlmostEqual, 0.5, 0.01)
+		})
+		Convey("a single channel is always picked", func() {
+			channels := []*Channel{newWeightedChannel(1, 0, 5)}
+			So(pickChannelByWeight(channels).Id, ShouldEqual, 1)
+		})
+	})
+}
+
+func TestCacheGetRandomSatisfiedChannelWeighted(t *testing.T) {
+	memoryCacheEnabled := config.MemoryCacheEnabled
+	config.MemoryCacheEnabled = true
+	defer func() { config.MemoryCacheEnabled = memoryCacheEnabled }()
+	group2model2channels = map[string]map[string][]*Channel{
+		"default": {
+			"gpt-4o": {
+				newWeightedChannel(1, 10, 80),
+				newWeightedChannel(2, 10, 20),
+				newWeightedChannel(3, 0, 3),
+				newWeightedChannel(4, 0, 1),
+			},
+		},
+	}
+	defer func() { group2model2channels = nil }()
+
+	Convey("memory cache selection", t, func() {
+		Convey("only the first priority tier is used, by weight", func() {
+			counts := countPicks(func() *Channel {
+				channel, _ := CacheGetRandomSatisfiedChannel("default", "gpt-4o", false)
+				return channel
+			})
+			So(counts[3]+counts[4], ShouldEqual, 0)
+			So(float64(counts[1])/sampleCount, ShouldAlmostEqual, 0.8, 0.01)
+		})
+		Convey("retries use the lower tiers, by weight", func() {
+			counts := countPicks(func() *Channel {
+				channel, _ := CacheGetRandomSatisfiedChannel("default", "gpt-4o", true)
+				return channel
+			})
+			So(counts[1]+counts[2], ShouldEqual, 0)
+			So(float64(counts[3])/sampleCount, ShouldAlmostEqual, 0.75, 0.01)
+		})
+	})
+}
+
+func TestGetRandomSatisfiedChannelWeighted(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	DB = db
+	usingSQLite := common.UsingSQLite
+	common.UsingSQLite = true
+	defer func() {
+		DB = nil
+		common.UsingSQLite = usingSQLite
+	}()
+	if err := DB.AutoMigrate(&Channel{}, &Ability{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, channel := range []*Channel{
+		newWeightedChannel(1, 10, 80),
+		newWeightedChannel(2, 10, 20),
+		newWeightedChannel(3, 0, 1),
+	} {
+		if err := DB.Create(channel).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := channel.AddAbilities(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	Convey("database selection", t, func() {
+		_, err := GetRandomSatisfiedChannel("default", "gpt-4o", false)
+		So(err, ShouldBeNil)
+		counts := make(map[int]int)
+		for i := 0; i < sampleCount/10; i++ {
+			channel, _ := GetRandomSatisfiedChannel("default", "gpt-4o", false)
+			counts[channel.Id]++
+		}
+		So(counts[3], ShouldEqual, 0)
+		So(float64(counts[1])/(sampleCount/10), ShouldAlmostEqual, 0.8, 0.02)
+	})
+}
+
+func TestChannelFilters(t *testing.T) {
+	blocked := make(map[int]bool)
+	filters := channelFilters
+	channelFilters = []ChannelFilter{func(channel *Channel) bool { return !blocked[channel.Id] }}
+	defer func() { channelFilters = filters }()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	DB = db
+	defer func() { DB = nil }()
+	if err := DB.AutoMigrate(&Channel{}, &Ability{}); err != nil {
+		t.Fatal(err)
+	}
+	channels := []*Channel{
+		newWeightedChannel(1, 10, 1),
+		newWeightedChannel(2, 10, 1),
+		newWeightedChannel(3, 0, 1),
+	}
+	for _, channel := range channels {
+		if err := DB.Create(channel).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := channel.AddAbilities(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	group2model2channels = map[string]map[string][]*Channel{"default": {"gpt-4o": channels}}
+	defer func() { group2model2channels = nil }()
+	memoryCacheEnabled := config.MemoryCacheEnabled
+	defer func() { config.MemoryCacheEnabled = memoryCacheEnabled }()
+
+	for _, memoryCache := range []bool{true, false} {
+		config.MemoryCacheEnabled = memoryCache
+		Convey(fmt.Sprintf("filtered selection (memory cache %t)", memoryCache), t, func() {
+			Reset(func() { blocked = make(map[int]bool) })
+
+			Convey("filtered channels are skipped within a tier", func() {
+				blocked[1] = true
+				for i := 0; i < 100; i++ {
+					channel, err := CacheGetRandomSatisfiedChannel("default", "gpt-4o", false)
+					So(err, ShouldBeNil)
+					So(channel.Id, ShouldEqual, 2)
+				}
+			})
+			Convey("a tier without channels left falls through to the next one", func() {
+				blocked[1], blocked[2] = true, true
+				for i := 0; i < 100; i++ {
+					channel, err := CacheGetRandomSatisfiedChannel("default", "gpt-4o", false)
+					So(err, ShouldBeNil)
+					So(channel.Id, ShouldEqual, 3)
+				}
+			})
+			Convey("retries use the lower tiers", func() {
+				channel, err := CacheGetRandomSatisfiedChannel("default", "gpt-4o", true)
+				So(err, ShouldBeNil)
+				So(channel.Id, ShouldEqual, 3)
+			})
+			Convey("filtered channels are not used when none is left", func() {
+				blocked[1], blocked[2], blocked[3] = true, true, true
+				_, err := CacheGetRandomSatisfiedChannel("default", "gpt-4o", false)
+				So(err, ShouldNotBeNil)
+			})
+		})
+	}
+}
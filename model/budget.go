@@ -0,0 +1,293 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// Budget caps the quota a token or user spends per calendar day and month,
+// 0 means no cap. The spend is counted as the quota is consumed and starts
+// over at midnight and on the first of the month in the time zone of the
+// server, these are not rolling 24-hour or 30-day windows.
+type Budget struct {
+	DailyBudget      int64 `json:"daily_budget" gorm:"bigint;default:0"`
+	MonthlyBudget    int64 `json:"monthly_budget" gorm:"bigint;default:0"`
+	DailyUsedQuota   int64 `json:"-" gorm:"bigint;default:0"`
+	MonthlyUsedQuota int64 `json:"-" gorm:"bigint;default:0"`
+	BudgetDate       int   `json:"-" gorm:"default:0"` // yyyymmdd of the last spend
+}
+
+// budgetCounterColumns are only written by addBudgetSpend.
+var budgetCounterColumns = []string{"daily_used_quota", "monthly_used_quota", "budget_date"}
+
+// BudgetStatus is what is left of the budgets of a token or user.
+type BudgetStatus struct {
+	DailyBudget        int64 `json:"daily_budget"`
+	DailyUsedQuota     int64 `json:"daily_used_quota"`
+	DailyRemainQuota   int64 `json:"daily_remain_quota"`
+	DailyResetTime     int64 `json:"daily_reset_time"`
+	MonthlyBudget      int64 `json:"monthly_budget"`
+	MonthlyUsedQuota   int64 `json:"monthly_used_quota"`
+	MonthlyRemainQuota int64 `json:"monthly_remain_quota"`
+	MonthlyResetTime   int64 `json:"monthly_reset_time"`
+}
+
+func budgetDate(t time.Time) int {
+	return t.Year()*10000 + int(t.Month())*100 + t.Day()
+}
+
+func remainQuota(budget int64, used int64) int64 {
+	if budget <= 0 || used >= budget {
+		return 0
+	}
+	return budget - used
+}
+
+// Status returns the budget status at now, leaving out the spend of the
+// days and months that are over.
+func (b *Budget) Status(now time.Time) *BudgetStatus {
+	today := budgetDate(now)
+	status := &BudgetStatus{
+		DailyBudget:      b.DailyBudget,
+		MonthlyBudget:    b.MonthlyBudget,
+		DailyResetTime:   time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location()).Unix(),
+		MonthlyResetTime: time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location()).Unix(),
+	}
+	if b.BudgetDate == today {
+		status.DailyUsedQuota = b.DailyUsedQuota
+	}
+	if b.BudgetDate/100 == today/100 {
+		status.MonthlyUsedQuota = b.MonthlyUsedQuota
+	}
+	status.DailyRemainQuota = remainQuota(status.DailyBudget, status.DailyUsedQuota)
+	status.MonthlyRemainQuota = remainQuota(status.MonthlyBudget, status.MonthlyUsedQuota)
+	return status
+}
+
+func budgetExceeded(budget int64, used int64, quota int64) bool {
+	return budget > 0 && (used >= budget || used+quota > budget)
+}
+
+// check returns an error if spending quota more would go over a budget, and
+// sends a budget.exceeded webhook event the first time it does in a period.
+func (s *BudgetStatus) check(scope string, id int, userId int, quota int64) error {
+	period, budget, used := "", int64(0), int64(0)
+	if budgetExceeded(s.DailyBudget, s.DailyUsedQuota, quota) {
+		period, budget, used = "daily", s.DailyBudget, s.DailyUsedQuota
+	} else if budgetExceeded(s.MonthlyBudget, s.MonthlyUsedQuota, quota) {
+		period, budget, used = "monthly", s.MonthlyBudget, s.MonthlyUsedQuota
+	} else {
+		return nil
+	}
+	if markBudgetNotified(fmt.Sprintf("%s:%d:%s", scope, id, period)) {
+		TriggerWebhookEvent(userId, WebhookEventBudgetExceeded, map[string]any{
+			"scope":      scope,
+			"id":         id,
+			"period":     period,
+			"budget":     budget,
+			"used_quota": used,
+			"quota":      quota,
+		})
+	}
+	return fmt.Errorf("%s %s budget exceeded, used %d of %d", scope, period, used, budget)
+}
+
+var budgetNotifiedLock sync.Mutex
+var budgetNotified = make(map[string]bool)
+var budgetNotifiedDate int
+
+// markBudgetNotified reports whether a budget.exceeded event is due for key,
+// at most one is sent a day by this node.
+func markBudgetNotified(key string) bool {
+	budgetNotifiedLock.Lock()
+	defer budgetNotifiedLock.Unlock()
+	if today := budgetDate(time.Now()); today != budgetNotifiedDate {
+		budgetNotified = make(map[string]bool)
+		budgetNotifiedDate = today
+	}
+	if budgetNotified[key] {
+		return false
+	}
+	budgetNotified[key] = true
+	return true
+}
+
+func getBudget(table string, id int) (*Budget, error) {
+	budget := &Budget{}
+	err := DB.Table(table).Where("id = ?", id).
+		Select("daily_budget", "monthly_budget", "daily_used_quota", "monthly_used_quota", "budget_date").
+		Take(budget).Error
+	return budget, err
+}
+
+var BudgetCacheSeconds = config.SyncFrequency
+
+func budgetCacheKey(table string, id int) string {
+	return fmt.Sprintf("budget:%s:%d", table, id)
+}
+
+// cacheGetBudget returns the budget of a token or user from a Redis hash
+// that is kept for BudgetCacheSeconds and counts the spend in the meantime.
+func cacheGetBudget(table string, id int) (*Budget, error) {
+	if !common.RedisEnabled {
+		return getBudget(table, id)
+	}
+	ctx := context.Background()
+	key := budgetCacheKey(table, id)
+	values, err := common.RDB.HGetAll(ctx, key).Result()
+	if err == nil && len(values) > 0 {
+		budget := &Budget{}
+		budget.DailyBudget, _ = strconv.ParseInt(values["daily_budget"], 10, 64)
+		budget.MonthlyBudget, _ = strconv.ParseInt(values["monthly_budget"], 10, 64)
+		budget.DailyUsedQuota, _ = strconv.ParseInt(values["daily_used_quota"], 10, 64)
+		budget.MonthlyUsedQuota, _ = strconv.ParseInt(values["monthly_used_quota"], 10, 64)
+		budget.BudgetDate, _ = strconv.Atoi(values["budget_date"])
+		return budget, nil
+	}
+	budget, err := getBudget(table, id)
+	if err != nil {
+		return nil, err
+	}
+	_, err = common.RDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, map[string]any{
+			"daily_budget":       budget.DailyBudget,
+			"monthly_budget":     budget.MonthlyBudget,
+			"daily_used_quota":   budget.DailyUsedQuota,
+			"monthly_used_quota": budget.MonthlyUsedQuota,
+			"budget_date":        budget.BudgetDate,
+		})
+		pipe.Expire(ctx, key, time.Duration(BudgetCacheSeconds)*time.Second)
+		return nil
+	})
+	if err != nil {
+		logger.SysError("Redis set budget error: " + err.Error())
+	}
+	return budget, nil
+}
+
+// budgetSpendScript adds to the spend of a cached budget like addBudgetSpend
+// does in the database, if the budget is cached.
+var budgetSpendScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+local today = tonumber(ARGV[1])
+local date = tonumber(redis.call('HGET', KEYS[1], 'budget_date') or 0)
+if date == today then
+	redis.call('HINCRBY', KEYS[1], 'daily_used_quota', ARGV[2])
+else
+	redis.call('HSET', KEYS[1], 'daily_used_quota', ARGV[3])
+end
+if date >= today - today % 100 then
+	redis.call('HINCRBY', KEYS[1], 'monthly_used_quota', ARGV[2])
+else
+	redis.call('HSET', KEYS[1], 'monthly_used_quota', ARGV[3])
+end
+redis.call('HSET', KEYS[1], 'budget_date', today)
+return 1
+`)
+
+func cacheAddBudgetSpend(table string, id int, quota int64) {
+	if !common.RedisEnabled {
+		return
+	}
+	startQuota := quota
+	if startQuota < 0 {
+		startQuota = 0
+	}
+	err := budgetSpendScript.Run(context.Background(), common.RDB, []string{budgetCacheKey(table, id)},
+		budgetDate(time.Now()), quota, startQuota).Err()
+	if err != nil {
+		logger.SysError("Redis update budget error: " + err.Error())
+	}
+}
+
+// cacheDeleteBudget drops a cached budget once its caps change.
+func cacheDeleteBudget(table string, id int) {
+	if !common.RedisEnabled {
+		return
+	}
+	err := common.RedisDel(budgetCacheKey(table, id))
+	if err != nil {
+		logger.SysError("Redis delete budget error: " + err.Error())
+	}
+}
+
+func GetTokenBudgetStatus(tokenId int) (*BudgetStatus, error) {
+	budget, err := cacheGetBudget("tokens", tokenId)
+	if err != nil {
+		return nil, err
+	}
+	return budget.Status(time.Now()), nil
+}
+
+func GetUserBudgetStatus(userId int) (*BudgetStatus, error) {
+	budget, err := cacheGetBudget("users", userId)
+	if err != nil {
+		return nil, err
+	}
+	return budget.Status(time.Now()), nil
+}
+
+// CheckBudget returns an error if spending quota more would go over a budget
+// of the token or its user.
+func CheckBudget(tokenId int, userId int, quota int64) error {
+	status, err := GetTokenBudgetStatus(tokenId)
+	if err != nil {
+		return err
+	}
+	if err = status.check("token", tokenId, userId, quota); err != nil {
+		return err
+	}
+	status, err = GetUserBudgetStatus(userId)
+	if err != nil {
+		return err
+	}
+	return status.check("user", userId, userId, quota)
+}
+
+// addBudgetSpend adds quota, negative for a refund, to the spend of the
+// current day and month, starting them over if the last spend was before.
+// budget_date is assigned last as MySQL sees the assignments made before.
+func addBudgetSpend(table string, id int, quota int64) error {
+	today := budgetDate(time.Now())
+	startQuota := quota
+	if startQuota < 0 {
+		startQuota = 0
+	}
+	return DB.Exec(fmt.Sprintf("UPDATE %s SET "+
+		"daily_used_quota = CASE WHEN budget_date = ? THEN daily_used_quota + ? ELSE ? END, "+
+		"monthly_used_quota = CASE WHEN budget_date >= ? THEN monthly_used_quota + ? ELSE ? END, "+
+		"budget_date = ? WHERE id = ?", table),
+		today, quota, startQuota, today/100*100, quota, startQuota, today, id).Error
+}
+
+func recordBudgetSpend(tokenId int, userId int, quota int64) {
+	if quota == 0 {
+		return
+	}
+	cacheAddBudgetSpend("tokens", tokenId, quota)
+	cacheAddBudgetSpend("users", userId, quota)
+	if config.BatchUpdateEnabled {
+		addNewRecord(BatchUpdateTypeTokenBudget, tokenId, quota)
+		addNewRecord(BatchUpdateTypeUserBudget, userId, quota)
+		return
+	}
+	err := addBudgetSpend("tokens", tokenId, quota)
+	if err != nil {
+		logger.SysError("failed to update token budget spend: " + err.Error())
+	}
+	err = addBudgetSpend("users", userId, quota)
+	if err != nil {
+		logger.SysError("failed to update user budget spend: " + err.Error())
+	}
+}
@@ -0,0 +1,88 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestBudget(t *testing.T) {
+	setupLedgerDB(t)
+	defer func() {
+		webhookTasks.Wait()
+		DB, LOG_DB = nil, nil
+	}()
+	quotaRemindThreshold := config.QuotaRemindThreshold
+	config.QuotaRemindThreshold = 0
+	defer func() { config.QuotaRemindThreshold = quotaRemindThreshold }()
+	ctx := context.Background()
+
+	Convey("budgets", t, func() {
+		user := &User{Username: "budget", Quota: 10000, Budget: Budget{MonthlyBudget: 1000}}
+		So(DB.Create(user).Error, ShouldBeNil)
+		token := &Token{UserId: user.Id, Key: "budget-token", UnlimitedQuota: true, Budget: Budget{DailyBudget: 500}}
+		So(DB.Create(token).Error, ShouldBeNil)
+
+		Convey("consumed quota is counted against the budgets", func() {
+			So(CheckBudget(token.Id, user.Id, 500), ShouldBeNil)
+			So(PreConsumeTokenQuota(ctx, token.Id, 300), ShouldBeNil)
+			So(PostConsumeTokenQuota(ctx, token.Id, -100), ShouldBeNil)
+
+			status, err := GetTokenBudgetStatus(token.Id)
+			So(err, ShouldBeNil)
+			So(status.DailyUsedQuota, ShouldEqual, 200)
+			So(status.DailyRemainQuota, ShouldEqual, 300)
+			status, err = GetUserBudgetStatus(user.Id)
+			So(err, ShouldBeNil)
+			So(status.MonthlyUsedQuota, ShouldEqual, 200)
+			So(status.MonthlyRemainQuota, ShouldEqual, 800)
+
+			So(CheckBudget(token.Id, user.Id, 300), ShouldBeNil)
+			So(CheckBudget(token.Id, user.Id, 301), ShouldNotBeNil)
+			So(PostConsumeTokenQuota(ctx, token.Id, 300), ShouldBeNil)
+			So(CheckBudget(token.Id, user.Id, 0), ShouldNotBeNil)
+		})
+
+		Convey("the spend starts over with a new day and month", func() {
+			So(PreConsumeTokenQuota(ctx, token.Id, 400), ShouldBeNil)
+			DB.Model(&Token{}).Where("id = ?", token.Id).Update("budget_date", 20000101)
+
+			status, err := GetTokenBudgetStatus(token.Id)
+			So(err, ShouldBeNil)
+			So(status.DailyUsedQuota, ShouldEqual, 0)
+			So(status.DailyResetTime, ShouldBeGreaterThan, time.Now().Unix())
+
+			So(PreConsumeTokenQuota(ctx, token.Id, 100), ShouldBeNil)
+			So(PostConsumeTokenQuota(ctx, token.Id, -50), ShouldBeNil)
+			status, err = GetTokenBudgetStatus(token.Id)
+			So(err, ShouldBeNil)
+			So(status.DailyUsedQuota, ShouldEqual, 50)
+			So(status.MonthlyUsedQuota, ShouldEqual, 50)
+		})
+
+		Convey("administrators can change the budgets but not the spend", func() {
+			So(PreConsumeTokenQuota(ctx, token.Id, 100), ShouldBeNil)
+			updated, err := GetUserById(user.Id, true)
+			So(err, ShouldBeNil)
+			updated.DailyUsedQuota = 0
+			updated.MonthlyBudget = 0
+			So(updated.Update(false), ShouldBeNil)
+			So(updated.UpdateBudget(), ShouldBeNil)
+
+			status, err := GetUserBudgetStatus(user.Id)
+			So(err, ShouldBeNil)
+			So(status.MonthlyBudget, ShouldEqual, 0)
+			So(status.MonthlyUsedQuota, ShouldEqual, 100)
+		})
+
+		Reset(func() {
+			DB.Where("1 = 1").Delete(&LedgerEntry{})
+			DB.Where("1 = 1").Delete(&Token{})
+			DB.Where("1 = 1").Delete(&User{})
+		})
+	})
+}
@@ -8,8 +8,6 @@ import (
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
-	"github.com/songquanpeng/one-api/common/random"
-	"math/rand"
 	"sort"
 	"strconv"
 	"strings"
@@ -230,10 +228,17 @@ func CacheGetRandomSatisfiedChannel(group string, model string, ignoreFirstPrior
 	}
 	channelSyncLock.RLock()
 	defer channelSyncLock.RUnlock()
-	channels := group2model2channels[group][model]
+	channels := filterChannels(group2model2channels[group][model])
 	if len(channels) == 0 {
 		return nil, errors.New("channel not found")
 	}
+	return selectChannelByPriority(channels, ignoreFirstPriority), nil
+}
+
+// selectChannelByPriority picks a channel of the first priority tier, or of
+// the lower tiers if ignoreFirstPriority is set and there are any. The
+// channels must be sorted by priority, highest first.
+func selectChannelByPriority(channels []*Channel, ignoreFirstPriority bool) *Channel {
 	endIdx := len(channels)
 	// choose by priority
 	firstChannel := channels[0]
@@ -245,11 +250,107 @@ func CacheGetRandomSatisfiedChannel(group string, model string, ignoreFirstPrior
 			}
 		}
 	}
-	idx := rand.Intn(endIdx)
-	if ignoreFirstPriority {
-		if endIdx < len(channels) { // which means there are more than one priority
-			idx = random.RandRange(endIdx, len(channels))
+	if ignoreFirstPriority && endIdx < len(channels) { // which means there are more than one priority
+		return selectChannel(channels[endIdx:])
+	}
+	return selectChannel(channels[:endIdx])
+}
+
+// CacheGetSatisfiedChannelById returns the channel if it is enabled for the
+// group and model and not excluded by a channel filter, nil otherwise.
+func CacheGetSatisfiedChannelById(group string, model string, channelId int) *Channel {
+	if !config.MemoryCacheEnabled {
+		var count int64
+		groupCol := "`group`"
+		trueVal := "1"
+		if common.UsingPostgreSQL {
+			groupCol = `"group"`
+			trueVal = "true"
+		}
+		err := DB.Model(&Ability{}).Where(groupCol+" = ? and model = ? and channel_id = ? and enabled = "+trueVal, group, model, channelId).Count(&count).Error
+		if err != nil || count == 0 {
+			return nil
+		}
+		channel, err := GetChannelById(channelId, true)
+		if err != nil || !isChannelAllowed(channel) {
+			return nil
+		}
+		return channel
+	}
+	channelSyncLock.RLock()
+	defer channelSyncLock.RUnlock()
+	for _, channel := range group2model2channels[group][model] {
+		if channel.Id == channelId {
+			if !isChannelAllowed(channel) {
+				return nil
+			}
+			return channel
+		}
+	}
+	return nil
+}
+
+// ChannelSelector chooses one of the channels of a priority tier.
+type ChannelSelector func(channels []*Channel) *Channel
+
+var channelSelectors = map[string]ChannelSelector{
+	"random": pickChannelByWeight,
+}
+
+// RegisterChannelSelector makes a selection strategy available to the
+// ChannelSelectionStrategy option. It must be called during init.
+func RegisterChannelSelector(name string, selector ChannelSelector) {
+	channelSelectors[name] = selector
+}
+
+// IsChannelSelectorRegistered reports whether name is a valid value of the
+// ChannelSelectionStrategy option.
+func IsChannelSelectorRegistered(name string) bool {
+	_, ok := channelSelectors[name]
+	return ok
+}
+
+// ChannelFilter reports whether a channel may receive traffic right now,
+// regardless of its persisted status.
+type ChannelFilter func(channel *Channel) bool
+
+var channelFilters []ChannelFilter
+
+// RegisterChannelFilter adds a filter consulted on every channel selection.
+// It must be called during init.
+func RegisterChannelFilter(filter ChannelFilter) {
+	channelFilters = append(channelFilters, filter)
+}
+
+func isChannelAllowed(channel *Channel) bool {
+	for _, filter := range channelFilters {
+		if !filter(channel) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterChannels drops the channels rejected by a filter. It is applied
+// before the priority tiers are chosen, so that a tier without any channel
+// left falls through to the next one.
+func filterChannels(channels []*Channel) []*Channel {
+	if len(channelFilters) == 0 {
+		return channels
+	}
+	filtered := make([]*Channel, 0, len(channels))
+	for _, channel := range channels {
+		if isChannelAllowed(channel) {
+			filtered = append(filtered, channel)
 		}
 	}
-	return channels[idx], nil
+	return filtered
+}
+
+func selectChannel(channels []*Channel) *Channel {
+	selector, ok := channelSelectors[config.ChannelSelectionStrategy]
+	if !ok {
+		selector = pickChannelByWeight
+	}
+	return selector(channels)
 }
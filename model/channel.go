@@ -7,6 +7,7 @@ import (
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/message"
 	"gorm.io/gorm"
 )
 
@@ -38,6 +39,7 @@ type Channel struct {
 	Priority           *int64  `json:"priority" gorm:"bigint;default:0"`
 	Config             string  `json:"config"`
 	SystemPrompt       *string `json:"system_prompt" gorm:"type:text"`
+	DisabledKeys       string  `json:"-" gorm:"type:text"` // keys of a multi-key channel disabled automatically, one per line
 }
 
 type ChannelConfig struct {
@@ -50,6 +52,8 @@ type ChannelConfig struct {
 	Plugin            string `json:"plugin,omitempty"`
 	VertexAIProjectID string `json:"vertex_ai_project_id,omitempty"`
 	VertexAIADC       string `json:"vertex_ai_adc,omitempty"`
+	MultiKey          bool   `json:"multi_key,omitempty"`     // keep the keys in one channel instead of one channel per key
+	KeySelection      string `json:"key_selection,omitempty"` // round_robin or random
 }
 
 func GetAllChannels(startIdx int, num int, scope string) ([]*Channel, error) {
@@ -104,6 +108,15 @@ func (channel *Channel) GetPriority() int64 {
 	return *channel.Priority
 }
 
+// GetWeight returns the share of traffic the channel gets within its
+// priority tier. Channels without a weight count as 1.
+func (channel *Channel) GetWeight() int {
+	if channel.Weight == nil || *channel.Weight == 0 {
+		return 1
+	}
+	return int(*channel.Weight)
+}
+
 func (channel *Channel) GetBaseURL() string {
 	if channel.BaseURL == nil {
 		return ""
@@ -140,6 +153,13 @@ func (channel *Channel) Update() error {
 	if err != nil {
 		return err
 	}
+	if channel.Key != "" {
+		// new keys, give the disabled ones another chance
+		err = EnableChannelKeys(channel.Id)
+		if err != nil {
+			return err
+		}
+	}
 	DB.Model(channel).First(channel, "id = ?", channel.Id)
 	err = channel.UpdateAbilities()
 	return err
@@ -155,7 +175,37 @@ func (channel *Channel) UpdateResponseTime(responseTime int64) {
 	}
 }
 
+func notifyChannelBalanceLow(channelId int, channelName string, balance float64, threshold float64) {
+	if config.RootUserEmail == "" {
+		config.RootUserEmail = GetRootUserEmail()
+	}
+	subject := "Channel Balance Low Notification"
+	content := message.EmailTemplate(
+		subject,
+		fmt.Sprintf(`
+			<p>Hello!</p>
+			<p>The balance of channel「<strong>%s</strong>」（#%d）is <strong>$%.2f</strong>, below the threshold <strong>$%.2f</strong>.</p>
+		`, channelName, channelId, balance, threshold),
+	)
+	description := fmt.Sprintf("The balance of channel %s (#%d) is $%.2f, below the threshold $%.2f", channelName, channelId, balance, threshold)
+	err := message.NotifyEvent(message.EventChannelBalanceLow, subject, description, content)
+	if err != nil {
+		logger.SysError("failed to send notification: " + err.Error())
+	}
+}
+
 func (channel *Channel) UpdateBalance(balance float64) {
+	threshold := config.ChannelBalanceThreshold
+	// only notify when the balance drops below the threshold, not on every update
+	if threshold > 0 && balance < threshold && (channel.BalanceUpdatedTime == 0 || channel.Balance >= threshold) {
+		TriggerWebhookEvent(0, WebhookEventChannelBalanceLow, map[string]any{
+			"channel_id":   channel.Id,
+			"channel_name": channel.Name,
+			"balance":      balance,
+			"threshold":    threshold,
+		})
+		go notifyChannelBalanceLow(channel.Id, channel.Name, balance, threshold)
+	}
 	err := DB.Model(channel).Select("balance_updated_time", "balance").Updates(Channel{
 		BalanceUpdatedTime: helper.GetTimestamp(),
 		Balance:            balance,
@@ -196,6 +246,12 @@ func UpdateChannelStatusById(id int, status int) {
 	if err != nil {
 		logger.SysError("failed to update channel status: " + err.Error())
 	}
+	if status == ChannelStatusEnabled {
+		err = EnableChannelKeys(id)
+		if err != nil {
+			logger.SysError("failed to enable channel keys: " + err.Error())
+		}
+	}
 }
 
 func UpdateChannelUsedQuota(id int, quota int64) {
@@ -0,0 +1,212 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+const (
+	KeySelectionRoundRobin = "round_robin"
+	KeySelectionRandom     = "random"
+)
+
+// keyFailureThreshold is the number of consecutive failures after which a key
+// is only used when every other key of the channel is failing too.
+const keyFailureThreshold = 3
+
+type channelKeyState struct {
+	next     int
+	failures map[string]int
+	disabled map[string]bool
+}
+
+var channelKeyLock sync.Mutex
+var channelKeyStates = make(map[int]*channelKeyState)
+
+func getChannelKeyState(channelId int) *channelKeyState {
+	state, ok := channelKeyStates[channelId]
+	if !ok {
+		state = &channelKeyState{
+			failures: make(map[string]int),
+			disabled: make(map[string]bool),
+		}
+		channelKeyStates[channelId] = state
+	}
+	return state
+}
+
+// GetKeys returns the keys of the channel that have not been disabled. A
+// multi-key channel holds one key per line.
+func (channel *Channel) GetKeys() []string {
+	if !channel.IsMultiKey() {
+		return []string{channel.Key}
+	}
+	disabledKeys := make(map[string]bool)
+	for _, key := range strings.Split(channel.DisabledKeys, "\n") {
+		disabledKeys[key] = true
+	}
+	keys := make([]string, 0)
+	for _, key := range strings.Split(channel.Key, "\n") {
+		key = strings.TrimSpace(key)
+		if key == "" || disabledKeys[key] {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// IsMultiKey reports whether the channel pools several keys. Other channels
+// use their key as is, even if it spans several lines.
+func (channel *Channel) IsMultiKey() bool {
+	cfg, _ := channel.LoadConfig()
+	return cfg.MultiKey
+}
+
+// HasKey reports whether key is one of the enabled keys of the channel.
+func (channel *Channel) HasKey(key string) bool {
+	for _, channelKey := range channel.GetKeys() {
+		if channelKey == key {
+			return true
+		}
+	}
+	return false
+}
+
+// HashChannelKey fingerprints a key, so that it can be referred to outside
+// the database. An empty key has no fingerprint.
+func HashChannelKey(key string) string {
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// GetKeyByHash returns the enabled key with the fingerprint, "" if there is
+// none.
+func (channel *Channel) GetKeyByHash(keyHash string) string {
+	if keyHash == "" {
+		return ""
+	}
+	for _, key := range channel.GetKeys() {
+		if HashChannelKey(key) == keyHash {
+			return key
+		}
+	}
+	return ""
+}
+
+// PickChannelKey chooses the key to use for the next request to the channel,
+// skipping disabled keys and, if possible, keys that keep failing.
+func PickChannelKey(channel *Channel) string {
+	if !channel.IsMultiKey() {
+		return channel.Key
+	}
+	keys := channel.GetKeys()
+	if len(keys) == 0 {
+		return ""
+	}
+	channelKeyLock.Lock()
+	defer channelKeyLock.Unlock()
+	state := getChannelKeyState(channel.Id)
+	healthyKeys := make([]string, 0, len(keys))
+	enabledKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if state.disabled[key] {
+			continue
+		}
+		enabledKeys = append(enabledKeys, key)
+		if state.failures[key] < keyFailureThreshold {
+			healthyKeys = append(healthyKeys, key)
+		}
+	}
+	if len(healthyKeys) == 0 {
+		healthyKeys = enabledKeys
+	}
+	if len(healthyKeys) == 0 {
+		// the cached channel is behind the database, try the keys anyway
+		healthyKeys = keys
+	}
+	cfg, _ := channel.LoadConfig()
+	if cfg.KeySelection == KeySelectionRandom {
+		return healthyKeys[rand.Intn(len(healthyKeys))]
+	}
+	state.next++
+	return healthyKeys[state.next%len(healthyKeys)]
+}
+
+// RecordChannelKeyResult tracks the consecutive failures of a key of a
+// multi-key channel.
+func RecordChannelKeyResult(channelId int, key string, success bool) {
+	if key == "" {
+		return
+	}
+	channelKeyLock.Lock()
+	defer channelKeyLock.Unlock()
+	state := getChannelKeyState(channelId)
+	if success {
+		delete(state.failures, key)
+		return
+	}
+	state.failures[key]++
+}
+
+// DisableChannelKey disables a single key of a multi-key channel and returns
+// the number of keys the channel has left.
+func DisableChannelKey(channelId int, key string) (int, error) {
+	channelKeyLock.Lock()
+	getChannelKeyState(channelId).disabled[key] = true
+	channelKeyLock.Unlock()
+
+	channel := Channel{}
+	// concurrent failures of different keys must not overwrite each other
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "key", "config", "disabled_keys").First(&channel, "id = ?", channelId).Error
+		if err != nil {
+			return err
+		}
+		disabledKeys := strings.Split(channel.DisabledKeys, "\n")
+		if channel.DisabledKeys == "" {
+			disabledKeys = nil
+		}
+		for _, disabledKey := range disabledKeys {
+			if disabledKey == key {
+				return nil
+			}
+		}
+		disabledKeys = append(disabledKeys, key)
+		channel.DisabledKeys = strings.Join(disabledKeys, "\n")
+		return tx.Model(&channel).Update("disabled_keys", channel.DisabledKeys).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	remaining := len(channel.GetKeys())
+	logger.SysLog(fmt.Sprintf("key %s of channel #%d has been disabled, %d keys left", maskKey(key), channelId, remaining))
+	return remaining, nil
+}
+
+// EnableChannelKeys enables all the keys of a channel again.
+func EnableChannelKeys(channelId int) error {
+	channelKeyLock.Lock()
+	delete(channelKeyStates, channelId)
+	channelKeyLock.Unlock()
+	return DB.Model(&Channel{}).Where("id = ?", channelId).Update("disabled_keys", "").Error
+}
+
+func maskKey(key string) string {
+	if len(key) <= 8 {
+		return "***"
+	}
+	return key[:4] + "***" + key[len(key)-4:]
+}
@@ -0,0 +1,111 @@
+package model
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newMultiKeyChannel(id int, keys ...string) *Channel {
+	return &Channel{
+		Id:     id,
+		Type:   1,
+		Status: ChannelStatusEnabled,
+		Key:    strings.Join(keys, "\n"),
+		Config: `{"multi_key":true}`,
+	}
+}
+
+func TestChannelKeys(t *testing.T) {
+	Convey("Channel keys", t, func() {
+		Convey("only channels flagged as multi-key are split", func() {
+			channel := &Channel{Id: 1001, Key: "line1\nline2"}
+			So(channel.IsMultiKey(), ShouldBeFalse)
+			So(channel.GetKeys(), ShouldResemble, []string{"line1\nline2"})
+			So(PickChannelKey(channel), ShouldEqual, "line1\nline2")
+
+			channel = newMultiKeyChannel(1002, "sk-a", " sk-b ", "")
+			So(channel.IsMultiKey(), ShouldBeTrue)
+			So(channel.GetKeys(), ShouldResemble, []string{"sk-a", "sk-b"})
+			So(channel.HasKey("sk-b"), ShouldBeTrue)
+			So(channel.HasKey("sk-c"), ShouldBeFalse)
+		})
+
+		Convey("keys are picked in turn, skipping disabled and failing keys", func() {
+			channel := newMultiKeyChannel(1003, "sk-a", "sk-b", "sk-c")
+			channelKeyLock.Lock()
+			delete(channelKeyStates, channel.Id)
+			channelKeyLock.Unlock()
+			channel.DisabledKeys = "sk-c"
+			picks := make(map[string]int)
+			for i := 0; i < 10; i++ {
+				picks[PickChannelKey(channel)]++
+			}
+			So(picks, ShouldResemble, map[string]int{"sk-a": 5, "sk-b": 5})
+
+			for i := 0; i < keyFailureThreshold; i++ {
+				RecordChannelKeyResult(channel.Id, "sk-a", false)
+			}
+			for i := 0; i < 4; i++ {
+				So(PickChannelKey(channel), ShouldEqual, "sk-b")
+			}
+
+			// once every key is failing, they are all tried again
+			for i := 0; i < keyFailureThreshold; i++ {
+				RecordChannelKeyResult(channel.Id, "sk-b", false)
+			}
+			picks = make(map[string]int)
+			for i := 0; i < 10; i++ {
+				picks[PickChannelKey(channel)]++
+			}
+			So(picks, ShouldResemble, map[string]int{"sk-a": 5, "sk-b": 5})
+
+			RecordChannelKeyResult(channel.Id, "sk-a", true)
+			for i := 0; i < 4; i++ {
+				So(PickChannelKey(channel), ShouldEqual, "sk-a")
+			}
+		})
+
+		Convey("disabling keys concurrently keeps every key disabled once", func() {
+			setupLedgerDB(t)
+			defer func() { DB, LOG_DB = nil, nil }()
+			So(DB.AutoMigrate(&Channel{}), ShouldBeNil)
+			channel := newMultiKeyChannel(1004, "sk-a", "sk-b", "sk-c", "sk-d")
+			channelKeyLock.Lock()
+			delete(channelKeyStates, channel.Id)
+			channelKeyLock.Unlock()
+			So(DB.Create(channel).Error, ShouldBeNil)
+
+			keys := []string{"sk-a", "sk-b", "sk-c", "sk-a"}
+			errs := make([]error, len(keys))
+			var wg sync.WaitGroup
+			for i, key := range keys {
+				wg.Add(1)
+				go func(i int, key string) {
+					defer wg.Done()
+					_, errs[i] = DisableChannelKey(channel.Id, key)
+				}(i, key)
+			}
+			wg.Wait()
+			for _, err := range errs {
+				So(err, ShouldBeNil)
+			}
+
+			stored, err := GetChannelById(channel.Id, true)
+			So(err, ShouldBeNil)
+			disabledKeys := strings.Split(stored.DisabledKeys, "\n")
+			So(disabledKeys, ShouldHaveLength, 3)
+			So(disabledKeys, ShouldContain, "sk-a")
+			So(disabledKeys, ShouldContain, "sk-b")
+			So(disabledKeys, ShouldContain, "sk-c")
+			So(stored.GetKeys(), ShouldResemble, []string{"sk-d"})
+			So(PickChannelKey(stored), ShouldEqual, "sk-d")
+
+			remaining, err := DisableChannelKey(channel.Id, "sk-d")
+			So(err, ShouldBeNil)
+			So(remaining, ShouldEqual, 0)
+		})
+	})
+}
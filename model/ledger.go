@@ -0,0 +1,196 @@
+package model
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+)
+
+const (
+	LedgerTypeUnknown = iota
+	LedgerTypeOpening
+	LedgerTypeSignup
+	LedgerTypeInvite
+	LedgerTypeRedemption
+	LedgerTypeTopup
+	LedgerTypeAdjust
+	LedgerTypePreConsume
+	LedgerTypeConsume
+	LedgerTypeRefund
+)
+
+// ledgerSystemAccounts are the accounts on the other side of user quota
+// movements.
+var ledgerSystemAccounts = map[int]string{
+	LedgerTypeOpening:    "system:opening",
+	LedgerTypeSignup:     "system:bonus",
+	LedgerTypeInvite:     "system:bonus",
+	LedgerTypeRedemption: "system:redemption",
+	LedgerTypeTopup:      "system:topup",
+	LedgerTypeAdjust:     "system:adjust",
+	LedgerTypePreConsume: "system:usage",
+	LedgerTypeConsume:    "system:usage",
+	LedgerTypeRefund:     "system:usage",
+}
+
+// LedgerEntry is one side of a quota transaction. Every transaction debits
+// one account and credits another by the same amount, so the entries of a
+// transaction sum to zero and the entries of a user account sum to its quota.
+type LedgerEntry struct {
+	Id            int    `json:"id"`
+	TransactionId string `json:"transaction_id" gorm:"type:varchar(32);index"`
+	Account       string `json:"account" gorm:"type:varchar(64);index"`
+	UserId        int    `json:"user_id" gorm:"index"`
+	TokenId       int    `json:"token_id" gorm:"default:0"`
+	Type          int    `json:"type" gorm:"index"`
+	Amount        int64  `json:"amount" gorm:"bigint"` // credit is positive, debit is negative
+	BalanceAfter  int64  `json:"balance_after" gorm:"bigint;default:0"`
+	RequestId     string `json:"request_id" gorm:"default:''"`
+	CreatedAt     int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+// QuotaMismatch is a user whose quota differs from the sum of its ledger.
+type QuotaMismatch struct {
+	UserId      int    `json:"user_id"`
+	Username    string `json:"username"`
+	Quota       int64  `json:"quota"`
+	LedgerQuota int64  `json:"ledger_quota"`
+}
+
+func userAccount(userId int) string {
+	return fmt.Sprintf("user:%d", userId)
+}
+
+// newLedgerTransaction returns the two entries of a transaction moving amount
+// into the account of a user, out of it if amount is negative.
+func newLedgerTransaction(ctx context.Context, userId int, tokenId int, amount int64, ledgerType int) []*LedgerEntry {
+	transactionId := random.GetUUID()
+	requestId := ""
+	if ctx != nil {
+		requestId = helper.GetRequestID(ctx)
+	}
+	now := helper.GetTimestamp()
+	entry := LedgerEntry{
+		TransactionId: transactionId,
+		UserId:        userId,
+		TokenId:       tokenId,
+		Type:          ledgerType,
+		RequestId:     requestId,
+		CreatedAt:     now,
+	}
+	userEntry, systemEntry := entry, entry
+	userEntry.Account = userAccount(userId)
+	userEntry.Amount = amount
+	systemEntry.Account = ledgerSystemAccounts[ledgerType]
+	systemEntry.Amount = -amount
+	return []*LedgerEntry{&userEntry, &systemEntry}
+}
+
+// createLedgerEntries records entries once their amounts have been applied to
+// the quota of the user within tx, filling in the balance after each one.
+func createLedgerEntries(tx *gorm.DB, userId int, entries []*LedgerEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	var balance int64
+	err := tx.Model(&User{}).Where("id = ?", userId).Select("quota").Find(&balance).Error
+	if err != nil {
+		return err
+	}
+	account := userAccount(userId)
+	for _, entry := range entries {
+		if entry.Account == account {
+			balance -= entry.Amount
+		}
+	}
+	for _, entry := range entries {
+		if entry.Account == account {
+			balance += entry.Amount
+			entry.BalanceAfter = balance
+		}
+	}
+	return tx.Create(&entries).Error
+}
+
+// applyUserQuota adds delta to the quota of a user and records the entries
+// of the transactions behind it, atomically.
+func applyUserQuota(userId int, delta int64, entries []*LedgerEntry) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", delta)).Error
+		if err != nil {
+			return err
+		}
+		return createLedgerEntries(tx, userId, entries)
+	})
+}
+
+// changeUserQuota adds delta, negative to deduct, to the quota of a user and
+// records it in the ledger. With batch updates enabled, both are deferred to
+// the next batch.
+func changeUserQuota(ctx context.Context, userId int, tokenId int, delta int64, ledgerType int) error {
+	entries := newLedgerTransaction(ctx, userId, tokenId, delta, ledgerType)
+	if config.BatchUpdateEnabled {
+		addUserQuotaRecord(userId, delta, entries)
+		return nil
+	}
+	return applyUserQuota(userId, delta, entries)
+}
+
+// openLedger records the quota users had before the ledger existed, so that
+// their ledger adds up.
+func openLedger() error {
+	var count int64
+	err := DB.Model(&LedgerEntry{}).Count(&count).Error
+	if err != nil || count > 0 {
+		return err
+	}
+	var users []*User
+	err = DB.Select("id", "quota").Where("quota <> 0").Find(&users).Error
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return nil
+	}
+	logger.SysLog(fmt.Sprintf("recording the opening quota of %d users in the ledger", len(users)))
+	entries := make([]*LedgerEntry, 0, 2*len(users))
+	for _, user := range users {
+		transaction := newLedgerTransaction(nil, user.Id, 0, user.Quota, LedgerTypeOpening)
+		transaction[0].BalanceAfter = user.Quota
+		entries = append(entries, transaction...)
+	}
+	return DB.CreateInBatches(&entries, 100).Error
+}
+
+func GetLedgerEntries(userId int, startIdx int, num int) (entries []*LedgerEntry, err error) {
+	tx := DB.Order("id desc")
+	if userId != 0 {
+		tx = tx.Where("account = ?", userAccount(userId))
+	}
+	err = tx.Limit(num).Offset(startIdx).Find(&entries).Error
+	return entries, err
+}
+
+// ReconcileUserQuota compares the quota of users, all of them if userId is
+// 0, with the sum of their ledger and returns those that differ.
+func ReconcileUserQuota(userId int) (mismatches []*QuotaMismatch, err error) {
+	ledgerQuota := DB.Model(&LedgerEntry{}).
+		Select("user_id, SUM(amount) AS amount").
+		Where("account LIKE ?", "user:%").
+		Group("user_id")
+	tx := DB.Table("users").
+		Select("users.id AS user_id, users.username, users.quota, COALESCE(ledger.amount, 0) AS ledger_quota").
+		Joins("LEFT JOIN (?) AS ledger ON ledger.user_id = users.id", ledgerQuota).
+		Where("users.quota <> COALESCE(ledger.amount, 0)")
+	if userId != 0 {
+		tx = tx.Where("users.id = ?", userId)
+	}
+	err = tx.Order("users.id").Scan(&mismatches).Error
+	return mismatches, err
+}
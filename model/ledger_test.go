@@ -0,0 +1,148 @@
+package model
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func setupLedgerDB(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection to an in-memory database gets its own database
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	redisEnabled := common.RedisEnabled
+	common.RedisEnabled = false
+	t.Cleanup(func() { common.RedisEnabled = redisEnabled })
+	DB = db
+	LOG_DB = db
+	if err := DB.AutoMigrate(&User{}, &Token{}, &Redemption{}, &Log{}, &LedgerEntry{}, &Webhook{}, &WebhookDelivery{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sumLedger(account string) (sum int64) {
+	DB.Model(&LedgerEntry{}).Where("account = ?", account).Select("COALESCE(SUM(amount), 0)").Scan(&sum)
+	return sum
+}
+
+func TestLedger(t *testing.T) {
+	setupLedgerDB(t)
+	defer func() {
+		webhookTasks.Wait()
+		DB, LOG_DB = nil, nil
+	}()
+	// keep the quota reminders, sent in the background, out of the test
+	quotaRemindThreshold := config.QuotaRemindThreshold
+	config.QuotaRemindThreshold = 0
+	defer func() { config.QuotaRemindThreshold = quotaRemindThreshold }()
+	ctx := context.Background()
+
+	Convey("quota ledger", t, func() {
+		user := &User{Username: "ledger", Quota: 1000}
+		So(DB.Create(user).Error, ShouldBeNil)
+		So(openLedger(), ShouldBeNil)
+		token := &Token{UserId: user.Id, Key: "ledger-token", RemainQuota: 500}
+		So(DB.Create(token).Error, ShouldBeNil)
+
+		Convey("every quota change is recorded with the balance after it", func() {
+			So(PreConsumeTokenQuota(ctx, token.Id, 300), ShouldBeNil)
+			So(PostConsumeTokenQuota(ctx, token.Id, -100), ShouldBeNil)
+			So(IncreaseUserQuota(ctx, user.Id, 50, LedgerTypeTopup), ShouldBeNil)
+
+			quota, _ := GetUserQuota(user.Id)
+			So(quota, ShouldEqual, 850)
+			So(sumLedger(userAccount(user.Id)), ShouldEqual, 850)
+			var entries []*LedgerEntry
+			DB.Where("account = ?", userAccount(user.Id)).Order("id").Find(&entries)
+			So(len(entries), ShouldEqual, 4)
+			So(entries[1].Type, ShouldEqual, LedgerTypePreConsume)
+			So(entries[1].TokenId, ShouldEqual, token.Id)
+			So(entries[1].BalanceAfter, ShouldEqual, 700)
+			So(entries[2].BalanceAfter, ShouldEqual, 800)
+
+			var total int64
+			DB.Model(&LedgerEntry{}).Select("SUM(amount)").Scan(&total)
+			So(total, ShouldEqual, 0)
+
+			mismatches, err := ReconcileUserQuota(0)
+			So(err, ShouldBeNil)
+			So(mismatches, ShouldBeEmpty)
+		})
+
+		Convey("batch updates write the ledger along with the quota", func() {
+			config.BatchUpdateEnabled = true
+			defer func() { config.BatchUpdateEnabled = false }()
+			So(PreConsumeTokenQuota(ctx, token.Id, 200), ShouldBeNil)
+			So(PostConsumeTokenQuota(ctx, token.Id, 50), ShouldBeNil)
+			So(sumLedger(userAccount(user.Id)), ShouldEqual, 1000)
+			batchUpdate()
+			quota, _ := GetUserQuota(user.Id)
+			So(quota, ShouldEqual, 750)
+			So(sumLedger(userAccount(user.Id)), ShouldEqual, 750)
+			var last LedgerEntry
+			DB.Where("account = ?", userAccount(user.Id)).Order("id desc").First(&last)
+			So(last.BalanceAfter, ShouldEqual, 750)
+		})
+
+		Convey("redemptions are recorded", func() {
+			redemption := &Redemption{Key: "ledger-key", Status: RedemptionCodeStatusEnabled, Quota: 250}
+			So(DB.Create(redemption).Error, ShouldBeNil)
+			_, err := Redeem(ctx, "ledger-key", user.Id)
+			So(err, ShouldBeNil)
+			So(sumLedger(userAccount(user.Id)), ShouldEqual, 1250)
+			So(sumLedger("system:redemption"), ShouldEqual, -250)
+		})
+
+		Convey("administrator changes are recorded as adjustments", func() {
+			updated, err := GetUserById(user.Id, true)
+			So(err, ShouldBeNil)
+			So(PreConsumeTokenQuota(ctx, token.Id, 100), ShouldBeNil)
+			updated.Quota = 2000
+			So(updated.Update(false), ShouldBeNil)
+			quota, _ := GetUserQuota(user.Id)
+			So(quota, ShouldEqual, 2000)
+			So(sumLedger(userAccount(user.Id)), ShouldEqual, 2000)
+			So(sumLedger("system:adjust"), ShouldEqual, -1100)
+		})
+
+		Convey("a failed ledger write leaves the token untouched", func() {
+			So(DB.Migrator().DropTable(&LedgerEntry{}), ShouldBeNil)
+			defer func() { So(DB.AutoMigrate(&LedgerEntry{}), ShouldBeNil) }()
+			So(PostConsumeTokenQuota(ctx, token.Id, 100), ShouldNotBeNil)
+			quota, _ := GetUserQuota(user.Id)
+			So(quota, ShouldEqual, 1000)
+			updated, err := GetTokenById(token.Id)
+			So(err, ShouldBeNil)
+			So(updated.RemainQuota, ShouldEqual, 500)
+		})
+
+		Convey("quota changed outside the ledger is reported", func() {
+			DB.Model(&User{}).Where("id = ?", user.Id).Update("quota", 1234)
+			mismatches, err := ReconcileUserQuota(user.Id)
+			So(err, ShouldBeNil)
+			So(len(mismatches), ShouldEqual, 1)
+			So(mismatches[0].Quota, ShouldEqual, 1234)
+			So(mismatches[0].LedgerQuota, ShouldEqual, 1000)
+		})
+
+		Reset(func() {
+			DB.Where("1 = 1").Delete(&LedgerEntry{})
+			DB.Where("1 = 1").Delete(&Redemption{})
+			DB.Where("1 = 1").Delete(&Token{})
+			DB.Where("1 = 1").Delete(&User{})
+		})
+	})
+}
@@ -44,6 +44,7 @@ func CreateRootAccountIfNeed() error {
 			Quota:       500000000000000,
 		}
 		DB.Create(&rootUser)
+		_ = createLedgerEntries(DB, rootUser.Id, newLedgerTransaction(nil, rootUser.Id, 0, rootUser.Quota, LedgerTypeOpening))
 		if config.InitialRootToken != "" {
 			logger.SysLog("creating initial root token as requested")
 			token := Token{
@@ -177,6 +178,18 @@ func migrateDB() error {
 	if err = DB.AutoMigrate(&Log{}); err != nil {
 		return err
 	}
+	if err = DB.AutoMigrate(&RelayObject{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&LedgerEntry{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&Webhook{}, &WebhookDelivery{}); err != nil {
+		return err
+	}
+	if err = openLedger(); err != nil {
+		return err
+	}
 	if err = DB.AutoMigrate(&Channel{}); err != nil {
 		return err
 	}
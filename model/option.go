@@ -3,7 +3,11 @@ package model
 import (
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/message"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/fallback"
+	"github.com/songquanpeng/one-api/relay/hedge"
+	"github.com/songquanpeng/one-api/relay/ratelimit"
 	"strconv"
 	"strings"
 	"time"
@@ -33,10 +37,12 @@ func InitOptionMap() {
 	config.OptionMap["AutomaticDisableChannelEnabled"] = strconv.FormatBool(config.AutomaticDisableChannelEnabled)
 	config.OptionMap["AutomaticEnableChannelEnabled"] = strconv.FormatBool(config.AutomaticEnableChannelEnabled)
 	config.OptionMap["ApproximateTokenEnabled"] = strconv.FormatBool(config.ApproximateTokenEnabled)
+	config.OptionMap["SessionAffinityEnabled"] = strconv.FormatBool(config.SessionAffinityEnabled)
 	config.OptionMap["LogConsumeEnabled"] = strconv.FormatBool(config.LogConsumeEnabled)
 	config.OptionMap["DisplayInCurrencyEnabled"] = strconv.FormatBool(config.DisplayInCurrencyEnabled)
 	config.OptionMap["DisplayTokenStatEnabled"] = strconv.FormatBool(config.DisplayTokenStatEnabled)
 	config.OptionMap["ChannelDisableThreshold"] = strconv.FormatFloat(config.ChannelDisableThreshold, 'f', -1, 64)
+	config.OptionMap["ChannelBalanceThreshold"] = strconv.FormatFloat(config.ChannelBalanceThreshold, 'f', -1, 64)
 	config.OptionMap["EmailDomainRestrictionEnabled"] = strconv.FormatBool(config.EmailDomainRestrictionEnabled)
 	config.OptionMap["EmailDomainWhitelist"] = strings.Join(config.EmailDomainWhitelist, ",")
 	config.OptionMap["SMTPServer"] = ""
@@ -55,6 +61,15 @@ func InitOptionMap() {
 	config.OptionMap["GitHubClientSecret"] = ""
 	config.OptionMap["MessagePusherAddress"] = ""
 	config.OptionMap["MessagePusherToken"] = ""
+	config.OptionMap["SlackWebhookURL"] = ""
+	config.OptionMap["FeishuWebhookURL"] = ""
+	config.OptionMap["FeishuWebhookSecret"] = ""
+	config.OptionMap["DingTalkWebhookURL"] = ""
+	config.OptionMap["DingTalkWebhookSecret"] = ""
+	config.OptionMap["WeComWebhookURL"] = ""
+	config.OptionMap["TelegramBotToken"] = ""
+	config.OptionMap["TelegramChatId"] = ""
+	config.OptionMap["NotifyMethods"] = message.NotifyMethods2JSONString()
 	config.OptionMap["QuotaForNewUser"] = strconv.FormatInt(config.QuotaForNewUser, 10)
 	config.OptionMap["QuotaForInviter"] = strconv.FormatInt(config.QuotaForInviter, 10)
 	config.OptionMap["QuotaForInvitee"] = strconv.FormatInt(config.QuotaForInvitee, 10)
@@ -62,11 +77,25 @@ func InitOptionMap() {
 	config.OptionMap["PreConsumedQuota"] = strconv.FormatInt(config.PreConsumedQuota, 10)
 	config.OptionMap["ModelRatio"] = billingratio.ModelRatio2JSONString()
 	config.OptionMap["GroupRatio"] = billingratio.GroupRatio2JSONString()
+	config.OptionMap["ModelFallback"] = fallback.ModelFallback2JSONString()
+	config.OptionMap["ModelHedgeDelay"] = hedge.ModelHedgeDelay2JSONString()
+	config.OptionMap["GroupRateLimit"] = ratelimit.GroupRateLimit2JSONString()
+	config.OptionMap["GroupConcurrency"] = ratelimit.GroupConcurrency2JSONString()
 	config.OptionMap["CompletionRatio"] = billingratio.CompletionRatio2JSONString()
+	config.OptionMap["CacheReadRatio"] = billingratio.CacheReadRatio2JSONString()
+	config.OptionMap["CacheWriteRatio"] = billingratio.CacheWriteRatio2JSONString()
+	config.OptionMap["ModelFixedPrice"] = billingratio.ModelFixedPrice2JSONString()
+	config.OptionMap["ModelPriceTiers"] = billingratio.ModelPriceTiers2JSONString()
+	config.OptionMap["ReasoningRatio"] = billingratio.ReasoningRatio2JSONString()
+	config.OptionMap["AudioInputRatio"] = billingratio.AudioInputRatio2JSONString()
+	config.OptionMap["AudioOutputRatio"] = billingratio.AudioOutputRatio2JSONString()
 	config.OptionMap["TopUpLink"] = config.TopUpLink
 	config.OptionMap["ChatLink"] = config.ChatLink
 	config.OptionMap["QuotaPerUnit"] = strconv.FormatFloat(config.QuotaPerUnit, 'f', -1, 64)
 	config.OptionMap["RetryTimes"] = strconv.Itoa(config.RetryTimes)
+	config.OptionMap["ChannelSelectionStrategy"] = config.ChannelSelectionStrategy
+	config.OptionMap["BatchChannelId"] = strconv.Itoa(config.BatchChannelId)
+	config.OptionMap["BatchDiscountRatio"] = strconv.FormatFloat(config.BatchDiscountRatio, 'f', -1, 64)
 	config.OptionMap["Theme"] = config.Theme
 	config.OptionMapRWMutex.Unlock()
 	loadOptionsFromDatabase()
@@ -136,6 +165,8 @@ func updateOptionMap(key string, value string) (err error) {
 			config.AutomaticEnableChannelEnabled = boolValue
 		case "ApproximateTokenEnabled":
 			config.ApproximateTokenEnabled = boolValue
+		case "SessionAffinityEnabled":
+			config.SessionAffinityEnabled = boolValue
 		case "LogConsumeEnabled":
 			config.LogConsumeEnabled = boolValue
 		case "DisplayInCurrencyEnabled":
@@ -190,6 +221,24 @@ func updateOptionMap(key string, value string) (err error) {
 		config.MessagePusherAddress = value
 	case "MessagePusherToken":
 		config.MessagePusherToken = value
+	case "SlackWebhookURL":
+		config.SlackWebhookURL = value
+	case "FeishuWebhookURL":
+		config.FeishuWebhookURL = value
+	case "FeishuWebhookSecret":
+		config.FeishuWebhookSecret = value
+	case "DingTalkWebhookURL":
+		config.DingTalkWebhookURL = value
+	case "DingTalkWebhookSecret":
+		config.DingTalkWebhookSecret = value
+	case "WeComWebhookURL":
+		config.WeComWebhookURL = value
+	case "TelegramBotToken":
+		config.TelegramBotToken = value
+	case "TelegramChatId":
+		config.TelegramChatId = value
+	case "NotifyMethods":
+		err = message.UpdateNotifyMethodsByJSONString(value)
 	case "QuotaForNewUser":
 		config.QuotaForNewUser, _ = strconv.ParseInt(value, 10, 64)
 	case "QuotaForInviter":
@@ -202,18 +251,48 @@ func updateOptionMap(key string, value string) (err error) {
 		config.PreConsumedQuota, _ = strconv.ParseInt(value, 10, 64)
 	case "RetryTimes":
 		config.RetryTimes, _ = strconv.Atoi(value)
+	case "ChannelSelectionStrategy":
+		config.ChannelSelectionStrategy = value
+	case "BatchChannelId":
+		config.BatchChannelId, _ = strconv.Atoi(value)
+	case "BatchDiscountRatio":
+		config.BatchDiscountRatio, _ = strconv.ParseFloat(value, 64)
 	case "ModelRatio":
 		err = billingratio.UpdateModelRatioByJSONString(value)
 	case "GroupRatio":
 		err = billingratio.UpdateGroupRatioByJSONString(value)
+	case "ModelFallback":
+		err = fallback.UpdateModelFallbackByJSONString(value)
+	case "ModelHedgeDelay":
+		err = hedge.UpdateModelHedgeDelayByJSONString(value)
+	case "GroupRateLimit":
+		err = ratelimit.UpdateGroupRateLimitByJSONString(value)
+	case "GroupConcurrency":
+		err = ratelimit.UpdateGroupConcurrencyByJSONString(value)
 	case "CompletionRatio":
 		err = billingratio.UpdateCompletionRatioByJSONString(value)
+	case "CacheReadRatio":
+		err = billingratio.UpdateCacheReadRatioByJSONString(value)
+	case "CacheWriteRatio":
+		err = billingratio.UpdateCacheWriteRatioByJSONString(value)
+	case "ModelFixedPrice":
+		err = billingratio.UpdateModelFixedPriceByJSONString(value)
+	case "ModelPriceTiers":
+		err = billingratio.UpdateModelPriceTiersByJSONString(value)
+	case "ReasoningRatio":
+		err = billingratio.UpdateReasoningRatioByJSONString(value)
+	case "AudioInputRatio":
+		err = billingratio.UpdateAudioInputRatioByJSONString(value)
+	case "AudioOutputRatio":
+		err = billingratio.UpdateAudioOutputRatioByJSONString(value)
 	case "TopUpLink":
 		config.TopUpLink = value
 	case "ChatLink":
 		config.ChatLink = value
 	case "ChannelDisableThreshold":
 		config.ChannelDisableThreshold, _ = strconv.ParseFloat(value, 64)
+	case "ChannelBalanceThreshold":
+		config.ChannelBalanceThreshold, _ = strconv.ParseFloat(value, 64)
 	case "QuotaPerUnit":
 		config.QuotaPerUnit, _ = strconv.ParseFloat(value, 64)
 	case "Theme":
@@ -77,6 +77,10 @@ func Redeem(ctx context.Context, key string, userId int) (quota int64, err error
 		if err != nil {
 			return err
 		}
+		err = createLedgerEntries(tx, userId, newLedgerTransaction(ctx, userId, 0, redemption.Quota, LedgerTypeRedemption))
+		if err != nil {
+			return err
+		}
 		redemption.RedeemedTime = helper.GetTimestamp()
 		redemption.Status = RedemptionCodeStatusUsed
 		err = tx.Save(redemption).Error
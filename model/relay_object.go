@@ -0,0 +1,74 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+// RelayObject records which user and channel own an object created upstream
+// (a file or a batch), so that follow-up calls reach the same upstream.
+type RelayObject struct {
+	Id          int    `json:"id"`
+	ObjectId    string `json:"object_id" gorm:"type:varchar(128);uniqueIndex"`
+	Type        int    `json:"type" gorm:"index"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	TokenId     int    `json:"token_id"`
+	TokenName   string `json:"token_name"`
+	Group       string `json:"group" gorm:"type:varchar(32)"`
+	ChannelId   int    `json:"channel_id"`
+	ChannelKey  string `json:"-" gorm:"type:text"` // the key of a multi-key channel that created the object
+	Status      int    `json:"status" gorm:"default:0;index"`
+	Quota       int64  `json:"quota" gorm:"bigint;default:0"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	SettledTime int64  `json:"settled_time" gorm:"bigint"`
+}
+
+const (
+	RelayObjectTypeFile  = 1
+	RelayObjectTypeBatch = 2
+)
+
+const (
+	BatchStatusPending = 1 // don't use 0, 0 is the default value!
+	BatchStatusSettled = 2
+)
+
+func (object *RelayObject) Insert() error {
+	object.CreatedTime = helper.GetTimestamp()
+	return DB.Create(object).Error
+}
+
+func GetUserRelayObject(objectId string, objectType int, userId int) (*RelayObject, error) {
+	if objectId == "" {
+		return nil, errors.New("id is empty!")
+	}
+	object := RelayObject{}
+	err := DB.First(&object, "object_id = ? and type = ? and user_id = ?", objectId, objectType, userId).Error
+	return &object, err
+}
+
+func GetUserRelayObjectIds(userId int, objectType int) (ids []string, err error) {
+	err = DB.Model(&RelayObject{}).Where("user_id = ? and type = ?", userId, objectType).Pluck("object_id", &ids).Error
+	return ids, err
+}
+
+func DeleteRelayObject(objectId string, objectType int) error {
+	return DB.Where("object_id = ? and type = ?", objectId, objectType).Delete(&RelayObject{}).Error
+}
+
+func GetPendingBatches() (objects []*RelayObject, err error) {
+	err = DB.Where("type = ? and status = ?", RelayObjectTypeBatch, BatchStatusPending).Find(&objects).Error
+	return objects, err
+}
+
+// SettleBatch marks a pending batch as settled. It reports false when the
+// batch has already been settled, so that results are only billed once.
+func SettleBatch(id int, quota int64) (bool, error) {
+	result := DB.Model(&RelayObject{}).Where("id = ? and status = ?", id, BatchStatusPending).Updates(map[string]any{
+		"status":       BatchStatusSettled,
+		"quota":        quota,
+		"settled_time": helper.GetTimestamp(),
+	})
+	return result.RowsAffected > 0, result.Error
+}
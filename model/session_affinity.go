@@ -0,0 +1,78 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+type sessionChannel struct {
+	channelId int
+	keyHash   string
+	expiresAt time.Time
+}
+
+var sessionChannelLock sync.Mutex
+var sessionChannels = make(map[string]sessionChannel)
+
+// CacheGetSessionChannel returns the channel a session was last routed to and
+// the fingerprint of the key it used, 0 if there is none.
+func CacheGetSessionChannel(sessionKey string) (channelId int, keyHash string) {
+	if common.RedisEnabled {
+		value, err := common.RedisGet(fmt.Sprintf("session_channel:%s", sessionKey))
+		if err != nil {
+			return 0, ""
+		}
+		value, keyHash, _ = strings.Cut(value, ":")
+		channelId, _ = strconv.Atoi(value)
+		return channelId, keyHash
+	}
+	sessionChannelLock.Lock()
+	defer sessionChannelLock.Unlock()
+	session, ok := sessionChannels[sessionKey]
+	if !ok || time.Now().After(session.expiresAt) {
+		return 0, ""
+	}
+	return session.channelId, session.keyHash
+}
+
+// CacheSetSessionChannel routes the next requests of a session to a channel
+// and, for a multi-key channel, to the key that served it. Only a fingerprint
+// of the key is kept.
+func CacheSetSessionChannel(sessionKey string, channelId int, key string) {
+	ttl := time.Duration(config.SessionAffinityTTL) * time.Second
+	keyHash := HashChannelKey(key)
+	if common.RedisEnabled {
+		value := strconv.Itoa(channelId)
+		if keyHash != "" {
+			value += ":" + keyHash
+		}
+		err := common.RedisSet(fmt.Sprintf("session_channel:%s", sessionKey), value, ttl)
+		if err != nil {
+			logger.SysError("Redis set session channel error: " + err.Error())
+		}
+		return
+	}
+	sessionChannelLock.Lock()
+	defer sessionChannelLock.Unlock()
+	now := time.Now()
+	if len(sessionChannels) >= 100000 {
+		// drop the expired sessions before the map grows any further
+		for key, session := range sessionChannels {
+			if now.After(session.expiresAt) {
+				delete(sessionChannels, key)
+			}
+		}
+	}
+	sessionChannels[sessionKey] = sessionChannel{
+		channelId: channelId,
+		keyHash:   keyHash,
+		expiresAt: now.Add(ttl),
+	}
+}
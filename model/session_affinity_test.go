@@ -0,0 +1,43 @@
+package model
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/songquanpeng/one-api/common"
+)
+
+func TestSessionChannel(t *testing.T) {
+	redisEnabled := common.RedisEnabled
+	common.RedisEnabled = false
+	defer func() { common.RedisEnabled = redisEnabled }()
+
+	Convey("Session affinity", t, func() {
+		Convey("an unknown session has no channel", func() {
+			channelId, keyHash := CacheGetSessionChannel("1:gpt-4o:unknown")
+			So(channelId, ShouldEqual, 0)
+			So(keyHash, ShouldBeEmpty)
+		})
+
+		Convey("the channel and the key of a session are kept", func() {
+			channel := newMultiKeyChannel(1101, "sk-a", "sk-b")
+			CacheSetSessionChannel("1:gpt-4o:session", channel.Id, "sk-b")
+			channelId, keyHash := CacheGetSessionChannel("1:gpt-4o:session")
+			So(channelId, ShouldEqual, channel.Id)
+			So(keyHash, ShouldNotContainSubstring, "sk-b")
+			So(channel.GetKeyByHash(keyHash), ShouldEqual, "sk-b")
+
+			// a disabled key is no longer reused
+			channel.DisabledKeys = "sk-b"
+			So(channel.GetKeyByHash(keyHash), ShouldBeEmpty)
+		})
+
+		Convey("single-key channels keep no key", func() {
+			CacheSetSessionChannel("1:gpt-4o:single", 1102, "")
+			channelId, keyHash := CacheGetSessionChannel("1:gpt-4o:single")
+			So(channelId, ShouldEqual, 1102)
+			So(keyHash, ShouldBeEmpty)
+		})
+	})
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -34,6 +35,10 @@ type Token struct {
 	UsedQuota      int64   `json:"used_quota" gorm:"bigint;default:0"` // used quota
 	Models         *string `json:"models" gorm:"type:text"`            // allowed models
 	Subnet         *string `json:"subnet" gorm:"default:''"`           // allowed subnet
+	RPM            int     `json:"rpm" gorm:"default:0"`               // requests per minute, 0 means the limit of the group
+	TPM            int     `json:"tpm" gorm:"default:0"`               // tokens per minute, 0 means the limit of the group
+	MaxConcurrency int     `json:"max_concurrency" gorm:"default:0"`   // concurrent requests, 0 means no limit
+	Budget
 }
 
 func GetAllUserTokens(userId int, startIdx int, num int, order string) ([]*Token, error) {
@@ -132,7 +137,10 @@ func (t *Token) Insert() error {
 // Update Make sure your token's fields is completed, because this will update non-zero values
 func (t *Token) Update() error {
 	var err error
-	err = DB.Model(t).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "models", "subnet").Updates(t).Error
+	err = DB.Model(t).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "models", "subnet", "rpm", "tpm", "max_concurrency", "daily_budget", "monthly_budget").Updates(t).Error
+	if err == nil {
+		cacheDeleteBudget("tokens", t.Id)
+	}
 	return err
 }
 
@@ -214,7 +222,7 @@ func decreaseTokenQuota(id int, quota int64) (err error) {
 	return err
 }
 
-func PreConsumeTokenQuota(tokenId int, quota int64) (err error) {
+func PreConsumeTokenQuota(ctx context.Context, tokenId int, quota int64) (err error) {
 	if quota < 0 {
 		return errors.New("quota cannot be negative!")
 	}
@@ -235,6 +243,12 @@ func PreConsumeTokenQuota(tokenId int, quota int64) (err error) {
 	quotaTooLow := userQuota >= config.QuotaRemindThreshold && userQuota-quota < config.QuotaRemindThreshold
 	noMoreQuota := userQuota-quota <= 0
 	if quotaTooLow || noMoreQuota {
+		TriggerWebhookEvent(token.UserId, WebhookEventQuotaLow, map[string]any{
+			"user_id":   token.UserId,
+			"quota":     userQuota - quota,
+			"threshold": config.QuotaRemindThreshold,
+			"exhausted": noMoreQuota,
+		})
 		go func() {
 			email, err := GetUserEmail(token.UserId)
 			if err != nil {
@@ -274,24 +288,47 @@ func PreConsumeTokenQuota(tokenId int, quota int64) (err error) {
 		if err != nil {
 			return err
 		}
+		notifyTokenExhausted(token, quota)
 	}
-	err = DecreaseUserQuota(token.UserId, quota)
-	return err
+	err = changeUserQuota(ctx, token.UserId, tokenId, -quota, LedgerTypePreConsume)
+	if err != nil {
+		return err
+	}
+	recordBudgetSpend(tokenId, token.UserId, quota)
+	return nil
 }
 
-func PostConsumeTokenQuota(tokenId int, quota int64) (err error) {
+// notifyTokenExhausted sends a token.exhausted webhook event if consuming
+// quota uses up what is left of the quota of a token.
+func notifyTokenExhausted(token *Token, quota int64) {
+	if token.RemainQuota <= 0 || token.RemainQuota-quota > 0 {
+		return
+	}
+	TriggerWebhookEvent(token.UserId, WebhookEventTokenExhausted, map[string]any{
+		"token_id":   token.Id,
+		"token_name": token.Name,
+		"status":     TokenStatusExhausted,
+	})
+}
+
+func PostConsumeTokenQuota(ctx context.Context, tokenId int, quota int64) (err error) {
 	token, err := GetTokenById(tokenId)
 	if err != nil {
 		return err
 	}
 	if quota > 0 {
-		err = DecreaseUserQuota(token.UserId, quota)
-	} else {
-		err = IncreaseUserQuota(token.UserId, -quota)
+		err = changeUserQuota(ctx, token.UserId, tokenId, -quota, LedgerTypeConsume)
+	} else if quota < 0 {
+		err = changeUserQuota(ctx, token.UserId, tokenId, -quota, LedgerTypeRefund)
+	}
+	if err != nil {
+		return err
 	}
+	recordBudgetSpend(tokenId, token.UserId, quota)
 	if !token.UnlimitedQuota {
 		if quota > 0 {
 			err = DecreaseTokenQuota(tokenId, quota)
+			notifyTokenExhausted(token, quota)
 		} else {
 			err = IncreaseTokenQuota(tokenId, -quota)
 		}
@@ -50,6 +50,7 @@ type User struct {
 	Group            string `json:"group" gorm:"type:varchar(32);default:'default'"`
 	AffCode          string `json:"aff_code" gorm:"type:varchar(32);column:aff_code;uniqueIndex"`
 	InviterId        int    `json:"inviter_id" gorm:"type:int;column:inviter_id;index"`
+	Budget
 }
 
 func GetMaxUserId() int {
@@ -127,20 +128,28 @@ func (user *User) Insert(ctx context.Context, inviterId int) error {
 	user.Quota = config.QuotaForNewUser
 	user.AccessToken = random.GetUUID()
 	user.AffCode = random.GetRandomString(4)
-	result := DB.Create(user)
-	if result.Error != nil {
-		return result.Error
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		if user.Quota == 0 {
+			return nil
+		}
+		return createLedgerEntries(tx, user.Id, newLedgerTransaction(ctx, user.Id, 0, user.Quota, LedgerTypeSignup))
+	})
+	if err != nil {
+		return err
 	}
 	if config.QuotaForNewUser > 0 {
 		RecordLog(ctx, user.Id, LogTypeSystem, fmt.Sprintf("New user registration bonus %s", common.LogQuota(config.QuotaForNewUser)))
 	}
 	if inviterId != 0 {
 		if config.QuotaForInvitee > 0 {
-			_ = IncreaseUserQuota(user.Id, config.QuotaForInvitee)
+			_ = IncreaseUserQuota(ctx, user.Id, config.QuotaForInvitee, LedgerTypeInvite)
 			RecordLog(ctx, user.Id, LogTypeSystem, fmt.Sprintf("Invitation code bonus %s", common.LogQuota(config.QuotaForInvitee)))
 		}
 		if config.QuotaForInviter > 0 {
-			_ = IncreaseUserQuota(inviterId, config.QuotaForInviter)
+			_ = IncreaseUserQuota(ctx, inviterId, config.QuotaForInviter, LedgerTypeInvite)
 			RecordLog(ctx, inviterId, LogTypeSystem, fmt.Sprintf("User invitation bonus %s", common.LogQuota(config.QuotaForInviter)))
 		}
 	}
@@ -155,10 +164,10 @@ func (user *User) Insert(ctx context.Context, inviterId int) error {
 		RemainQuota:    -1,
 		UnlimitedQuota: true,
 	}
-	result.Error = cleanToken.Insert()
-	if result.Error != nil {
+	err = cleanToken.Insert()
+	if err != nil {
 		// do not block
-		logger.SysError(fmt.Sprintf("create default token for user %d failed: %s", user.Id, result.Error.Error()))
+		logger.SysError(fmt.Sprintf("create default token for user %d failed: %s", user.Id, err.Error()))
 	}
 	return nil
 }
@@ -176,7 +185,37 @@ func (user *User) Update(updatePassword bool) error {
 	} else if user.Status == UserStatusEnabled {
 		blacklist.UnbanUser(user.Id)
 	}
-	err = DB.Model(user).Updates(user).Error
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var quota int64
+		err := tx.Model(&User{}).Where("id = ?", user.Id).Select("quota").Find(&quota).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(user).Omit(append([]string{"quota"}, budgetCounterColumns...)...).Updates(user).Error
+		if err != nil {
+			return err
+		}
+		if user.Quota == 0 || user.Quota == quota {
+			return nil
+		}
+		// an administrator changed the quota, it is applied as a delta so the
+		// quota consumed since it was read is neither lost nor left out of the
+		// ledger
+		delta := user.Quota - quota
+		err = tx.Model(&User{}).Where("id = ?", user.Id).Update("quota", gorm.Expr("quota + ?", delta)).Error
+		if err != nil {
+			return err
+		}
+		return createLedgerEntries(tx, user.Id, newLedgerTransaction(nil, user.Id, 0, delta, LedgerTypeAdjust))
+	})
+}
+
+// UpdateBudget sets the budgets of a user, 0 included.
+func (user *User) UpdateBudget() error {
+	err := DB.Model(user).Select("daily_budget", "monthly_budget").Updates(user).Error
+	if err == nil {
+		cacheDeleteBudget("users", user.Id)
+	}
 	return err
 }
 
@@ -360,36 +399,18 @@ func GetUserGroup(id int) (group string, err error) {
 	return group, err
 }
 
-func IncreaseUserQuota(id int, quota int64) (err error) {
+func IncreaseUserQuota(ctx context.Context, id int, quota int64, ledgerType int) (err error) {
 	if quota < 0 {
 		return errors.New("quota cannot be negative!")
 	}
-	if config.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeUserQuota, id, quota)
-		return nil
-	}
-	return increaseUserQuota(id, quota)
+	return changeUserQuota(ctx, id, 0, quota, ledgerType)
 }
 
-func increaseUserQuota(id int, quota int64) (err error) {
-	err = DB.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", quota)).Error
-	return err
-}
-
-func DecreaseUserQuota(id int, quota int64) (err error) {
+func DecreaseUserQuota(ctx context.Context, id int, quota int64, ledgerType int) (err error) {
 	if quota < 0 {
 		return errors.New("quota cannot be negative!")
 	}
-	if config.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeUserQuota, id, -quota)
-		return nil
-	}
-	return decreaseUserQuota(id, quota)
-}
-
-func decreaseUserQuota(id int, quota int64) (err error) {
-	err = DB.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota - ?", quota)).Error
-	return err
+	return changeUserQuota(ctx, id, 0, -quota, ledgerType)
 }
 
 func GetRootUserEmail() (email string) {
@@ -13,12 +13,18 @@ const (
 	BatchUpdateTypeUsedQuota
 	BatchUpdateTypeChannelUsedQuota
 	BatchUpdateTypeRequestCount
+	BatchUpdateTypeTokenBudget
+	BatchUpdateTypeUserBudget
 	BatchUpdateTypeCount // if you add a new type, you need to add a new map and a new lock
 )
 
 var batchUpdateStores []map[int]int64
 var batchUpdateLocks []sync.Mutex
 
+// batchLedgerEntries holds the ledger entries of the pending user quota
+// updates, guarded by the lock of BatchUpdateTypeUserQuota.
+var batchLedgerEntries = make(map[int][]*LedgerEntry)
+
 func init() {
 	for i := 0; i < BatchUpdateTypeCount; i++ {
 		batchUpdateStores = append(batchUpdateStores, make(map[int]int64))
@@ -45,18 +51,30 @@ func addNewRecord(type_ int, id int, value int64) {
 	}
 }
 
+func addUserQuotaRecord(userId int, delta int64, entries []*LedgerEntry) {
+	batchUpdateLocks[BatchUpdateTypeUserQuota].Lock()
+	defer batchUpdateLocks[BatchUpdateTypeUserQuota].Unlock()
+	batchUpdateStores[BatchUpdateTypeUserQuota][userId] += delta
+	batchLedgerEntries[userId] = append(batchLedgerEntries[userId], entries...)
+}
+
 func batchUpdate() {
 	logger.SysLog("batch update started")
 	for i := 0; i < BatchUpdateTypeCount; i++ {
 		batchUpdateLocks[i].Lock()
 		store := batchUpdateStores[i]
 		batchUpdateStores[i] = make(map[int]int64)
+		var ledgerEntries map[int][]*LedgerEntry
+		if i == BatchUpdateTypeUserQuota {
+			ledgerEntries = batchLedgerEntries
+			batchLedgerEntries = make(map[int][]*LedgerEntry)
+		}
 		batchUpdateLocks[i].Unlock()
 		// TODO: maybe we can combine updates with same key?
 		for key, value := range store {
 			switch i {
 			case BatchUpdateTypeUserQuota:
-				err := increaseUserQuota(key, value)
+				err := applyUserQuota(key, value, ledgerEntries[key])
 				if err != nil {
 					logger.SysError("failed to batch update user quota: " + err.Error())
 				}
@@ -71,6 +89,16 @@ func batchUpdate() {
 				updateUserRequestCount(key, int(value))
 			case BatchUpdateTypeChannelUsedQuota:
 				updateChannelUsedQuota(key, value)
+			case BatchUpdateTypeTokenBudget:
+				err := addBudgetSpend("tokens", key, value)
+				if err != nil {
+					logger.SysError("failed to batch update token budget spend: " + err.Error())
+				}
+			case BatchUpdateTypeUserBudget:
+				err := addBudgetSpend("users", key, value)
+				if err != nil {
+					logger.SysError("failed to batch update user budget spend: " + err.Error())
+				}
 			}
 		}
 	}
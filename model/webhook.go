@@ -0,0 +1,408 @@
+package model
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+)
+
+const (
+	WebhookStatusEnabled  = 1
+	WebhookStatusDisabled = 2
+)
+
+const (
+	WebhookEventQuotaLow           = "quota.low"
+	WebhookEventBudgetExceeded     = "budget.exceeded"
+	WebhookEventTokenExhausted     = "token.exhausted"
+	WebhookEventChannelDisabled    = "channel.disabled"
+	WebhookEventChannelEnabled     = "channel.enabled"
+	WebhookEventChannelBalanceLow  = "channel.balance_low"
+	webhookDeliveryResponseMaxSize = 1024
+)
+
+// webhookUserEvents are the events a user can subscribe to, the others are
+// only sent to the system webhooks.
+var webhookUserEvents = map[string]bool{
+	WebhookEventQuotaLow:       true,
+	WebhookEventBudgetExceeded: true,
+	WebhookEventTokenExhausted: true,
+}
+
+var webhookEvents = map[string]bool{
+	WebhookEventQuotaLow:          true,
+	WebhookEventBudgetExceeded:    true,
+	WebhookEventTokenExhausted:    true,
+	WebhookEventChannelDisabled:   true,
+	WebhookEventChannelEnabled:    true,
+	WebhookEventChannelBalanceLow: true,
+}
+
+// Webhook receives events as signed JSON POST requests. The webhooks of user
+// 0 are set up by administrators and receive the events of every user.
+type Webhook struct {
+	Id          int    `json:"id"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	Name        string `json:"name" gorm:"type:varchar(64)"`
+	URL         string `json:"url" gorm:"type:varchar(512)"`
+	Secret      string `json:"secret" gorm:"type:varchar(64)"`
+	Events      string `json:"events" gorm:"type:text"` // comma separated, empty means all
+	Status      int    `json:"status" gorm:"default:1"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+// WebhookDelivery is the log of sending an event to a webhook.
+type WebhookDelivery struct {
+	Id         int    `json:"id"`
+	WebhookId  int    `json:"webhook_id" gorm:"index"`
+	UserId     int    `json:"user_id" gorm:"index"`
+	EventId    string `json:"event_id" gorm:"type:varchar(64)"`
+	Event      string `json:"event" gorm:"type:varchar(64)"`
+	Payload    string `json:"payload" gorm:"type:text"`
+	Success    bool   `json:"success"`
+	Attempts   int    `json:"attempts"`
+	StatusCode int    `json:"status_code"`
+	Response   string `json:"response" gorm:"type:text"`
+	Error      string `json:"error" gorm:"type:text"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+	UpdatedAt  int64  `json:"updated_at" gorm:"bigint"`
+}
+
+// WebhookEvent is the body of a webhook request.
+type WebhookEvent struct {
+	Id        string `json:"id"`
+	Event     string `json:"event"`
+	UserId    int    `json:"user_id,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+	Data      any    `json:"data"`
+}
+
+func (webhook *Webhook) subscribes(event string) bool {
+	if webhook.UserId != 0 && !webhookUserEvents[event] {
+		return false
+	}
+	if webhook.Events == "" {
+		return true
+	}
+	for _, e := range strings.Split(webhook.Events, ",") {
+		if strings.TrimSpace(e) == event {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookBlockedNets are the networks user webhooks may not reach besides
+// the loopback, private and link-local ones: "this" network, the shared
+// address space where some clouds serve their metadata, and the reserved ones.
+var webhookBlockedNets = func() (nets []*net.IPNet) {
+	for _, cidr := range []string{"0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "198.18.0.0/15", "240.0.0.0/4"} {
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		nets = append(nets, ipNet)
+	}
+	return nets
+}()
+
+// checkWebhookIP returns an error if user webhooks may not reach ip, tests
+// replace it to reach their local servers.
+var checkWebhookIP = func(ip net.IP) error {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("webhook address %s is not allowed", ip)
+	}
+	for _, ipNet := range webhookBlockedNets {
+		if ipNet.Contains(ip) {
+			return fmt.Errorf("webhook address %s is not allowed", ip)
+		}
+	}
+	return nil
+}
+
+func checkWebhookHost(host string) error {
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve webhook host: %w", err)
+	}
+	for _, ip := range ips {
+		if err = checkWebhookIP(ip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks the URL and events of a webhook, the webhooks of users may
+// only reach public addresses.
+func (webhook *Webhook) Validate() error {
+	u, err := url.Parse(webhook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("invalid webhook url")
+	}
+	if webhook.UserId != 0 {
+		if err = checkWebhookHost(u.Hostname()); err != nil {
+			return err
+		}
+	}
+	if webhook.Events == "" {
+		return nil
+	}
+	for _, event := range strings.Split(webhook.Events, ",") {
+		event = strings.TrimSpace(event)
+		if !webhookEvents[event] || (webhook.UserId != 0 && !webhookUserEvents[event]) {
+			return fmt.Errorf("unsupported webhook event: %s", event)
+		}
+	}
+	return nil
+}
+
+func GetWebhooks(userId int) (webhooks []*Webhook, err error) {
+	err = DB.Where("user_id = ?", userId).Order("id desc").Find(&webhooks).Error
+	return webhooks, err
+}
+
+func GetWebhookById(id int, userId int) (*Webhook, error) {
+	if id == 0 {
+		return nil, errors.New("id is empty!")
+	}
+	webhook := Webhook{}
+	err := DB.First(&webhook, "id = ? and user_id = ?", id, userId).Error
+	return &webhook, err
+}
+
+func (webhook *Webhook) Insert() error {
+	if webhook.Secret == "" {
+		webhook.Secret = random.GenerateKey()
+	}
+	webhook.CreatedTime = helper.GetTimestamp()
+	return DB.Create(webhook).Error
+}
+
+func (webhook *Webhook) Update() error {
+	return DB.Model(webhook).Select("name", "url", "secret", "events", "status").Updates(webhook).Error
+}
+
+func DeleteWebhookById(id int, userId int) error {
+	webhook, err := GetWebhookById(id, userId)
+	if err != nil {
+		return err
+	}
+	return DB.Delete(webhook).Error
+}
+
+// DeleteOldWebhookDeliveries deletes the deliveries created before
+// targetTimestamp.
+func DeleteOldWebhookDeliveries(targetTimestamp int64) (int64, error) {
+	result := DB.Where("created_at < ?", targetTimestamp).Delete(&WebhookDelivery{})
+	return result.RowsAffected, result.Error
+}
+
+// StartWebhookDeliveryCleanupRoutine deletes the deliveries older than
+// config.WebhookDeliveryRetentionDays every hour.
+func StartWebhookDeliveryCleanupRoutine() {
+	if config.WebhookDeliveryRetentionDays <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for ; true; <-ticker.C {
+			targetTimestamp := helper.GetTimestamp() - int64(config.WebhookDeliveryRetentionDays)*24*3600
+			count, err := DeleteOldWebhookDeliveries(targetTimestamp)
+			if err != nil {
+				logger.SysError("failed to delete old webhook deliveries: " + err.Error())
+			} else if count > 0 {
+				logger.SysLog(fmt.Sprintf("deleted %d old webhook deliveries", count))
+			}
+		}
+	}()
+}
+
+func GetWebhookDeliveries(userId int, webhookId int, startIdx int, num int) (deliveries []*WebhookDelivery, err error) {
+	tx := DB.Where("user_id = ?", userId)
+	if webhookId != 0 {
+		tx = tx.Where("webhook_id = ?", webhookId)
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&deliveries).Error
+	return deliveries, err
+}
+
+// SignWebhookPayload returns the signature of a webhook request, the hex
+// HMAC-SHA256 of the timestamp, a dot and the body, keyed by the secret.
+func SignWebhookPayload(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newWebhookHTTPClient returns a client that does not follow redirects,
+// restricted to the addresses allowed by checkWebhookIP if public is set. The
+// address is checked as it is dialed, so DNS rebinding can not get around it.
+func newWebhookHTTPClient(public bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if public {
+		dialer.Control = func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return fmt.Errorf("invalid webhook address %s", host)
+			}
+			return checkWebhookIP(ip)
+		}
+		// a proxy would be dialed instead of the webhook
+		transport.Proxy = nil
+	}
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// systemWebhookHTTPClient sends to the webhooks of administrators, which may
+// be internal services, userWebhookHTTPClient to those of users.
+var systemWebhookHTTPClient = newWebhookHTTPClient(false)
+var userWebhookHTTPClient = newWebhookHTTPClient(true)
+
+// webhookTasks are the events being sent, tests wait for them.
+var webhookTasks sync.WaitGroup
+
+// webhookRetryDelay is the delay before the first retry, doubled after each.
+var webhookRetryDelay = 2 * time.Second
+
+func sendWebhookRequest(webhook *Webhook, event *WebhookEvent, body []byte) (int, string, error) {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	timestamp := strconv.FormatInt(helper.GetTimestamp(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "one-api-webhook")
+	req.Header.Set("X-Webhook-Id", event.Id)
+	req.Header.Set("X-Webhook-Event", event.Event)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+SignWebhookPayload(webhook.Secret, timestamp, body))
+	client := systemWebhookHTTPClient
+	if webhook.UserId != 0 {
+		client = userWebhookHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	response, _ := io.ReadAll(io.LimitReader(resp.Body, webhookDeliveryResponseMaxSize))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(response), fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	return resp.StatusCode, string(response), nil
+}
+
+// deliverWebhook sends an event to a webhook, retrying with exponential
+// backoff, and logs the outcome.
+func deliverWebhook(webhook *Webhook, event *WebhookEvent, body []byte) {
+	now := helper.GetTimestamp()
+	delivery := &WebhookDelivery{
+		WebhookId: webhook.Id,
+		UserId:    webhook.UserId,
+		EventId:   event.Id,
+		Event:     event.Event,
+		Payload:   string(body),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err := DB.Create(delivery).Error
+	if err != nil {
+		logger.SysError("failed to record webhook delivery: " + err.Error())
+	}
+	delay := webhookRetryDelay
+	for attempt := 0; attempt <= config.WebhookRetryTimes; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		delivery.Attempts = attempt + 1
+		delivery.StatusCode, delivery.Response, err = sendWebhookRequest(webhook, event, body)
+		if err == nil {
+			delivery.Success = true
+			delivery.Error = ""
+			break
+		}
+		delivery.Error = err.Error()
+	}
+	if !delivery.Success {
+		logger.SysError(fmt.Sprintf("failed to deliver %s to webhook #%d: %s", event.Event, webhook.Id, delivery.Error))
+	}
+	delivery.UpdatedAt = helper.GetTimestamp()
+	err = DB.Model(delivery).Select("success", "attempts", "status_code", "response", "error", "updated_at").Updates(delivery).Error
+	if err != nil {
+		logger.SysError("failed to record webhook delivery: " + err.Error())
+	}
+}
+
+// TriggerWebhookEvent sends an event to the system webhooks and, for the
+// events of a user, to the webhooks of the user, in the background.
+func TriggerWebhookEvent(userId int, eventType string, data any) {
+	webhookTasks.Add(1)
+	go func() {
+		defer webhookTasks.Done()
+		var webhooks []*Webhook
+		tx := DB.Where("status = ?", WebhookStatusEnabled)
+		if userId != 0 {
+			tx = tx.Where("user_id = 0 or user_id = ?", userId)
+		} else {
+			tx = tx.Where("user_id = 0")
+		}
+		err := tx.Find(&webhooks).Error
+		if err != nil {
+			logger.SysError("failed to get webhooks: " + err.Error())
+			return
+		}
+		event := &WebhookEvent{
+			Id:        "evt_" + random.GetUUID(),
+			Event:     eventType,
+			UserId:    userId,
+			CreatedAt: helper.GetTimestamp(),
+			Data:      data,
+		}
+		body, err := json.Marshal(event)
+		if err != nil {
+			logger.SysError("failed to marshal webhook event: " + err.Error())
+			return
+		}
+		for _, webhook := range webhooks {
+			if webhook.subscribes(eventType) {
+				webhookTasks.Add(1)
+				go func(webhook *Webhook) {
+					defer webhookTasks.Done()
+					deliverWebhook(webhook, event, body)
+				}(webhook)
+			}
+		}
+	}()
+}
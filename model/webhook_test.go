@@ -0,0 +1,142 @@
+package model
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func waitWebhookDeliveries(webhookId int, n int) (deliveries []*WebhookDelivery) {
+	for i := 0; i < 100; i++ {
+		DB.Where("webhook_id = ? and attempts > 0", webhookId).Find(&deliveries)
+		if len(deliveries) >= n {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return deliveries
+}
+
+func TestWebhook(t *testing.T) {
+	setupLedgerDB(t)
+	retryTimes, retryDelay, checkIP := config.WebhookRetryTimes, webhookRetryDelay, checkWebhookIP
+	config.WebhookRetryTimes, webhookRetryDelay = 2, time.Millisecond
+	defer func() {
+		webhookTasks.Wait()
+		config.WebhookRetryTimes, webhookRetryDelay, checkWebhookIP = retryTimes, retryDelay, checkIP
+		DB, LOG_DB = nil, nil
+	}()
+	// the test server listens on the loopback
+	checkWebhookIP = func(ip net.IP) error { return nil }
+
+	Convey("webhooks", t, func() {
+		var failures int32
+		received := make(chan *http.Request, 10)
+		bodies := make(chan []byte, 10)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&failures, -1) >= 0 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			received <- r
+			bodies <- body
+		}))
+		defer server.Close()
+
+		system := &Webhook{URL: server.URL, Events: WebhookEventChannelDisabled + "," + WebhookEventQuotaLow}
+		So(system.Validate(), ShouldBeNil)
+		So(system.Insert(), ShouldBeNil)
+		user := &Webhook{UserId: 1, URL: server.URL}
+		So(user.Insert(), ShouldBeNil)
+
+		Convey("events are signed and sent to the subscribed webhooks", func() {
+			TriggerWebhookEvent(0, WebhookEventChannelDisabled, map[string]any{"channel_id": 3})
+			r := <-received
+			body := <-bodies
+			So(r.Header.Get("X-Webhook-Event"), ShouldEqual, WebhookEventChannelDisabled)
+			So(r.Header.Get("X-Webhook-Signature"), ShouldEqual, "sha256="+SignWebhookPayload(system.Secret, r.Header.Get("X-Webhook-Timestamp"), body))
+			var event WebhookEvent
+			So(json.Unmarshal(body, &event), ShouldBeNil)
+			So(event.Event, ShouldEqual, WebhookEventChannelDisabled)
+			So(event.Data, ShouldResemble, map[string]any{"channel_id": float64(3)})
+
+			deliveries := waitWebhookDeliveries(system.Id, 1)
+			So(len(deliveries), ShouldEqual, 1)
+			So(deliveries[0].Success, ShouldBeTrue)
+			var count int64
+			DB.Model(&WebhookDelivery{}).Where("webhook_id = ?", user.Id).Count(&count)
+			So(count, ShouldEqual, 0)
+		})
+
+		Convey("failed deliveries are retried", func() {
+			atomic.StoreInt32(&failures, 2)
+			TriggerWebhookEvent(1, WebhookEventTokenExhausted, map[string]any{"token_id": 1})
+			<-received
+			deliveries := waitWebhookDeliveries(user.Id, 1)
+			So(len(deliveries), ShouldEqual, 1)
+			So(deliveries[0].Success, ShouldBeTrue)
+			So(deliveries[0].Attempts, ShouldEqual, 3)
+		})
+
+		Convey("user webhooks can not reach internal addresses", func() {
+			checkWebhookIP = checkIP
+			defer func() { checkWebhookIP = func(ip net.IP) error { return nil } }()
+			So((&Webhook{UserId: 1, URL: server.URL}).Validate(), ShouldNotBeNil)
+			So((&Webhook{UserId: 1, URL: "http://169.254.169.254/latest/meta-data"}).Validate(), ShouldNotBeNil)
+			So((&Webhook{UserId: 1, URL: "http://[::ffff:10.0.0.1]/"}).Validate(), ShouldNotBeNil)
+			So((&Webhook{UserId: 1, URL: "http://100.100.100.200/"}).Validate(), ShouldNotBeNil)
+			So((&Webhook{UserId: 1, URL: "https://93.184.215.14/"}).Validate(), ShouldBeNil)
+			So((&Webhook{URL: server.URL}).Validate(), ShouldBeNil)
+
+			// a host that resolves to an internal address after validation
+			// is still refused when dialed
+			TriggerWebhookEvent(1, WebhookEventTokenExhausted, map[string]any{"token_id": 1})
+			webhookTasks.Wait()
+			deliveries := waitWebhookDeliveries(user.Id, 1)
+			So(len(deliveries), ShouldEqual, 1)
+			So(deliveries[0].Success, ShouldBeFalse)
+			So(deliveries[0].Error, ShouldContainSubstring, "is not allowed")
+		})
+
+		Convey("redirects are not followed", func() {
+			redirect := httptest.NewServer(http.RedirectHandler(server.URL, http.StatusFound))
+			defer redirect.Close()
+			So(DB.Model(system).Update("url", redirect.URL).Error, ShouldBeNil)
+			TriggerWebhookEvent(0, WebhookEventChannelDisabled, map[string]any{"channel_id": 3})
+			webhookTasks.Wait()
+			deliveries := waitWebhookDeliveries(system.Id, 1)
+			So(len(deliveries), ShouldEqual, 1)
+			So(deliveries[0].Success, ShouldBeFalse)
+			So(deliveries[0].StatusCode, ShouldEqual, http.StatusFound)
+		})
+
+		Convey("old deliveries are deleted", func() {
+			So(DB.Create(&WebhookDelivery{WebhookId: system.Id, CreatedAt: 1}).Error, ShouldBeNil)
+			So(DB.Create(&WebhookDelivery{WebhookId: system.Id, CreatedAt: time.Now().Unix()}).Error, ShouldBeNil)
+			count, err := DeleteOldWebhookDeliveries(time.Now().Unix() - 3600)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+		})
+
+		Convey("users can only subscribe to their own events", func() {
+			So((&Webhook{UserId: 1, URL: server.URL, Events: WebhookEventChannelEnabled}).Validate(), ShouldNotBeNil)
+			So((&Webhook{URL: "ftp://example.com"}).Validate(), ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			webhookTasks.Wait()
+			DB.Where("1 = 1").Delete(&Webhook{})
+			DB.Where("1 = 1").Delete(&WebhookDelivery{})
+		})
+	})
+}
@@ -0,0 +1,115 @@
+package monitor
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/model"
+)
+
+// statsDecay is the weight of the newest sample in the moving averages.
+const statsDecay = 0.2
+
+// minSuccessRate keeps failing channels on a trickle of traffic, so that
+// their stats can recover once the upstream does.
+const minSuccessRate = 0.05
+
+type channelStats struct {
+	latency     float64 // milliseconds, successful requests with a latency only
+	successRate float64
+}
+
+var statsLock sync.RWMutex
+var channelStatsStore = make(map[int]*channelStats)
+
+func init() {
+	model.RegisterChannelSelector("adaptive", pickChannelAdaptively)
+}
+
+func recordStats(channelId int, success bool, latency time.Duration) {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+	stats, ok := channelStatsStore[channelId]
+	if !ok {
+		stats = &channelStats{successRate: 1}
+		channelStatsStore[channelId] = stats
+	}
+	result := 0.0
+	if success {
+		result = 1
+	}
+	if success && latency > 0 {
+		milliseconds := float64(latency) / float64(time.Millisecond)
+		if stats.latency == 0 {
+			stats.latency = milliseconds
+		} else {
+			stats.latency += statsDecay * (milliseconds - stats.latency)
+		}
+	}
+	stats.successRate += statsDecay * (result - stats.successRate)
+}
+
+// GetChannelStats returns the moving averages of the latency and success
+// rate of a channel; ok is false if the channel has not served any request.
+func GetChannelStats(channelId int) (latency time.Duration, successRate float64, ok bool) {
+	statsLock.RLock()
+	defer statsLock.RUnlock()
+	stats, ok := channelStatsStore[channelId]
+	if !ok {
+		return 0, 0, false
+	}
+	return time.Duration(stats.latency) * time.Millisecond, stats.successRate, true
+}
+
+// pickChannelAdaptively chooses a channel at random, in proportion to its
+// weight scaled by its recent success rate and speed. Channels without stats
+// are assumed to be healthy and as fast as the average of the tier.
+func pickChannelAdaptively(channels []*model.Channel) *model.Channel {
+	if len(channels) == 1 {
+		return channels[0]
+	}
+	latencies := make([]float64, len(channels))
+	successRates := make([]float64, len(channels))
+	latencySum := 0.0
+	latencyCount := 0
+	statsLock.RLock()
+	for i, channel := range channels {
+		successRates[i] = 1
+		if stats, ok := channelStatsStore[channel.Id]; ok {
+			latencies[i] = stats.latency
+			successRates[i] = stats.successRate
+		}
+		if latencies[i] > 0 {
+			latencySum += latencies[i]
+			latencyCount++
+		}
+	}
+	statsLock.RUnlock()
+	averageLatency := 1.0
+	if latencyCount > 0 {
+		averageLatency = latencySum / float64(latencyCount)
+	}
+	scores := make([]float64, len(channels))
+	totalScore := 0.0
+	for i, channel := range channels {
+		latency := latencies[i]
+		if latency <= 0 {
+			latency = averageLatency
+		}
+		successRate := successRates[i]
+		if successRate < minSuccessRate {
+			successRate = minSuccessRate
+		}
+		scores[i] = float64(channel.GetWeight()) * successRate * successRate * averageLatency / latency
+		totalScore += scores[i]
+	}
+	target := rand.Float64() * totalScore
+	for i, channel := range channels {
+		target -= scores[i]
+		if target < 0 {
+			return channel
+		}
+	}
+	return channels[len(channels)-1]
+}
@@ -0,0 +1,73 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/model"
+)
+
+func resetChannelStats(t *testing.T) {
+	t.Cleanup(func() {
+		statsLock.Lock()
+		channelStatsStore = make(map[int]*channelStats)
+		statsLock.Unlock()
+	})
+}
+
+func TestRecordStats(t *testing.T) {
+	resetChannelStats(t)
+
+	recordStats(1, true, 100*time.Millisecond)
+	latency, successRate, ok := GetChannelStats(1)
+	assert.True(t, ok)
+	assert.Equal(t, 100*time.Millisecond, latency)
+	assert.Equal(t, 1.0, successRate)
+
+	// failures and requests without a first byte leave the latency alone
+	recordStats(1, false, 5*time.Second)
+	recordStats(1, true, 0)
+	latency, successRate, _ = GetChannelStats(1)
+	assert.Equal(t, 100*time.Millisecond, latency)
+	assert.InDelta(t, 0.84, successRate, 1e-9)
+
+	recordStats(1, true, 200*time.Millisecond)
+	latency, _, _ = GetChannelStats(1)
+	assert.Equal(t, 120*time.Millisecond, latency)
+
+	_, _, ok = GetChannelStats(2)
+	assert.False(t, ok)
+}
+
+func TestPickChannelAdaptively(t *testing.T) {
+	resetChannelStats(t)
+	fast := &model.Channel{Id: 1}
+	slow := &model.Channel{Id: 2}
+	failing := &model.Channel{Id: 3}
+	fresh := &model.Channel{Id: 4}
+	for i := 0; i < 20; i++ {
+		recordStats(fast.Id, true, 100*time.Millisecond)
+		recordStats(slow.Id, true, time.Second)
+		recordStats(failing.Id, false, 0)
+	}
+	recordStats(failing.Id, true, 100*time.Millisecond)
+
+	picks := make(map[int]int)
+	for i := 0; i < 10000; i++ {
+		picks[pickChannelAdaptively([]*model.Channel{fast, slow, failing, fresh}).Id]++
+	}
+	assert.Greater(t, picks[fast.Id], 3*picks[slow.Id])
+	assert.Greater(t, picks[slow.Id], picks[failing.Id])
+	// a channel without stats is treated as an average one
+	assert.Greater(t, picks[fresh.Id], picks[slow.Id])
+	assert.Less(t, picks[fresh.Id], picks[fast.Id])
+	assert.Positive(t, picks[failing.Id])
+}
+
+func TestAdaptiveSelectorRegistered(t *testing.T) {
+	assert.True(t, model.IsChannelSelectorRegistered("adaptive"))
+	assert.True(t, model.IsChannelSelectorRegistered("random"))
+	assert.False(t, model.IsChannelSelectorRegistered("fastest"))
+}
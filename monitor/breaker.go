@@ -0,0 +1,106 @@
+package monitor
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// probeRatio is the share of selections that may use a half-open channel.
+const probeRatio = 0.1
+
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+type circuitBreaker struct {
+	state    int
+	failures int
+	openedAt time.Time
+}
+
+var breakerLock sync.Mutex
+var breakers = make(map[int]*circuitBreaker)
+
+func init() {
+	model.RegisterChannelFilter(isChannelAvailable)
+}
+
+// isChannelAvailable keeps channels with an open circuit breaker out of the
+// selection. Once the cooldown is over, the breaker is half-open and lets a
+// share of the requests through to probe the channel.
+func isChannelAvailable(channel *model.Channel) bool {
+	if config.CircuitBreakerThreshold <= 0 {
+		return true
+	}
+	breakerLock.Lock()
+	defer breakerLock.Unlock()
+	breaker, ok := breakers[channel.Id]
+	if !ok {
+		return true
+	}
+	switch breaker.state {
+	case breakerOpen:
+		if time.Since(breaker.openedAt) < time.Duration(config.CircuitBreakerCooldown)*time.Second {
+			return false
+		}
+		breaker.state = breakerHalfOpen
+		logger.SysLog(fmt.Sprintf("channel #%d circuit breaker is half-open, probing", channel.Id))
+		return rand.Float64() < probeRatio
+	case breakerHalfOpen:
+		return rand.Float64() < probeRatio
+	}
+	return true
+}
+
+func recordBreakerSuccess(channelId int) {
+	breakerLock.Lock()
+	defer breakerLock.Unlock()
+	breaker, ok := breakers[channelId]
+	if !ok {
+		return
+	}
+	if breaker.state != breakerClosed {
+		logger.SysLog(fmt.Sprintf("channel #%d circuit breaker is closed", channelId))
+	}
+	delete(breakers, channelId)
+}
+
+// RecordBreakerError counts a failed request against the channel's circuit
+// breaker. Only server errors and timeouts count, client errors say nothing
+// about the health of the channel.
+func RecordBreakerError(channelId int, statusCode int) {
+	if config.CircuitBreakerThreshold <= 0 {
+		return
+	}
+	if statusCode/100 != 5 && statusCode != http.StatusRequestTimeout {
+		return
+	}
+	breakerLock.Lock()
+	defer breakerLock.Unlock()
+	breaker, ok := breakers[channelId]
+	if !ok {
+		breaker = &circuitBreaker{}
+		breakers[channelId] = breaker
+	}
+	breaker.failures++
+	switch breaker.state {
+	case breakerClosed:
+		if breaker.failures < config.CircuitBreakerThreshold {
+			return
+		}
+		logger.SysLog(fmt.Sprintf("channel #%d circuit breaker is open after %d consecutive errors", channelId, breaker.failures))
+	case breakerHalfOpen:
+		logger.SysLog(fmt.Sprintf("channel #%d circuit breaker is open again, probe failed", channelId))
+	}
+	breaker.state = breakerOpen
+	breaker.openedAt = time.Now()
+}
@@ -0,0 +1,93 @@
+package monitor
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func setBreakerConfig(t *testing.T, threshold int, cooldown int) {
+	oldThreshold, oldCooldown := config.CircuitBreakerThreshold, config.CircuitBreakerCooldown
+	config.CircuitBreakerThreshold, config.CircuitBreakerCooldown = threshold, cooldown
+	t.Cleanup(func() {
+		config.CircuitBreakerThreshold, config.CircuitBreakerCooldown = oldThreshold, oldCooldown
+		breakerLock.Lock()
+		breakers = make(map[int]*circuitBreaker)
+		breakerLock.Unlock()
+	})
+}
+
+func getBreakerState(channelId int) int {
+	breakerLock.Lock()
+	defer breakerLock.Unlock()
+	breaker, ok := breakers[channelId]
+	if !ok {
+		return breakerClosed
+	}
+	return breaker.state
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	channel := &model.Channel{Id: 1}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		setBreakerConfig(t, 0, 30)
+		for i := 0; i < 10; i++ {
+			RecordBreakerError(channel.Id, http.StatusInternalServerError)
+		}
+		assert.True(t, isChannelAvailable(channel))
+		assert.Equal(t, breakerClosed, getBreakerState(channel.Id))
+	})
+
+	t.Run("opens after consecutive server errors", func(t *testing.T) {
+		setBreakerConfig(t, 3, 30)
+		RecordBreakerError(channel.Id, http.StatusInternalServerError)
+		RecordBreakerError(channel.Id, http.StatusBadGateway)
+		assert.Equal(t, breakerClosed, getBreakerState(channel.Id))
+		// client errors say nothing about the channel
+		RecordBreakerError(channel.Id, http.StatusBadRequest)
+		assert.Equal(t, breakerClosed, getBreakerState(channel.Id))
+		RecordBreakerError(channel.Id, http.StatusRequestTimeout)
+		assert.Equal(t, breakerOpen, getBreakerState(channel.Id))
+		for i := 0; i < 100; i++ {
+			assert.False(t, isChannelAvailable(channel))
+		}
+	})
+
+	t.Run("a success closes the breaker", func(t *testing.T) {
+		setBreakerConfig(t, 3, 30)
+		RecordBreakerError(channel.Id, http.StatusInternalServerError)
+		RecordBreakerError(channel.Id, http.StatusInternalServerError)
+		recordBreakerSuccess(channel.Id)
+		RecordBreakerError(channel.Id, http.StatusInternalServerError)
+		// the failures are consecutive ones
+		assert.Equal(t, breakerClosed, getBreakerState(channel.Id))
+	})
+
+	t.Run("half-open after the cooldown", func(t *testing.T) {
+		setBreakerConfig(t, 1, 0)
+		RecordBreakerError(channel.Id, http.StatusInternalServerError)
+		assert.Equal(t, breakerOpen, getBreakerState(channel.Id))
+		allowed := 0
+		for i := 0; i < 10000; i++ {
+			if isChannelAvailable(channel) {
+				allowed++
+			}
+		}
+		assert.Equal(t, breakerHalfOpen, getBreakerState(channel.Id))
+		assert.InDelta(t, probeRatio*10000, allowed, 300)
+
+		// a failed probe opens it again, a successful one closes it
+		RecordBreakerError(channel.Id, http.StatusInternalServerError)
+		assert.Equal(t, breakerOpen, getBreakerState(channel.Id))
+		isChannelAvailable(channel)
+		assert.Equal(t, breakerHalfOpen, getBreakerState(channel.Id))
+		Emit(channel.Id, true, 0)
+		assert.Equal(t, breakerClosed, getBreakerState(channel.Id))
+		assert.True(t, isChannelAvailable(channel))
+	})
+}
@@ -1,29 +1,45 @@
 package monitor
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/common/message"
 	"github.com/songquanpeng/one-api/model"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
 )
 
-func notifyRootUser(subject string, content string) {
-	if config.MessagePusherAddress != "" {
-		err := message.SendMessage(subject, content, content)
-		if err != nil {
-			logger.SysError(fmt.Sprintf("failed to send message: %s", err.Error()))
-		} else {
-			return
-		}
-	}
+// NotifyRootUser sends a notification to the notifiers the event is routed
+// to by the NotifyMethods option, Message Pusher or email by default.
+func NotifyRootUser(event string, subject string, description string, content string) {
 	if config.RootUserEmail == "" {
 		config.RootUserEmail = model.GetRootUserEmail()
 	}
-	err := message.SendEmail(subject, config.RootUserEmail, content)
+	err := message.NotifyEvent(event, subject, description, content)
 	if err != nil {
-		logger.SysError(fmt.Sprintf("failed to send email: %s", err.Error()))
+		logger.SysError(fmt.Sprintf("failed to send notification: %s", err.Error()))
+	}
+}
+
+// ProcessRelayError records a failed upstream request against the channel and
+// its key, and disables them if the error says they are unusable.
+func ProcessRelayError(ctx context.Context, userId int, channelId int, channelName string, key string, latency time.Duration, err relaymodel.ErrorWithStatusCode) {
+	logger.Errorf(ctx, "relay error (channel id %d, user id: %d): %s", channelId, userId, err.Message)
+	RecordBreakerError(channelId, err.StatusCode)
+	model.RecordChannelKeyResult(channelId, key, false)
+	// https://platform.openai.com/docs/guides/error-codes/api-errors
+	if ShouldDisableChannel(&err.Error, err.StatusCode) {
+		if key != "" {
+			// only the key is bad, the other keys of the channel may be fine
+			DisableChannelKey(channelId, channelName, key, err.Message)
+		} else {
+			DisableChannel(channelId, channelName, err.Message)
+		}
+	} else {
+		Emit(channelId, false, latency)
 	}
 }
 
@@ -31,6 +47,11 @@ func notifyRootUser(subject string, content string) {
 func DisableChannel(channelId int, channelName string, reason string) {
 	model.UpdateChannelStatusById(channelId, model.ChannelStatusAutoDisabled)
 	logger.SysLog(fmt.Sprintf("channel #%d has been disabled: %s", channelId, reason))
+	model.TriggerWebhookEvent(0, model.WebhookEventChannelDisabled, map[string]any{
+		"channel_id":   channelId,
+		"channel_name": channelName,
+		"reason":       reason,
+	})
 	subject := fmt.Sprintf("Channel Status Change Notification")
 	content := message.EmailTemplate(
 		subject,
@@ -41,12 +62,44 @@ func DisableChannel(channelId int, channelName string, reason string) {
 			<p style="background-color: #f8f8f8; padding: 10px; border-radius: 4px;">%s</p>
 		`, channelName, channelId, reason),
 	)
-	notifyRootUser(subject, content)
+	NotifyRootUser(message.EventChannelDisabled, subject,
+		fmt.Sprintf("Channel %s (#%d) has been disabled, reason: %s", channelName, channelId, reason), content)
+}
+
+// DisableChannelKey disables a key of a multi-key channel & notify, the
+// channel itself is disabled once it runs out of keys
+func DisableChannelKey(channelId int, channelName string, key string, reason string) {
+	remaining, err := model.DisableChannelKey(channelId, key)
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to disable key of channel #%d: %s", channelId, err.Error()))
+		return
+	}
+	if remaining == 0 {
+		DisableChannel(channelId, channelName, "all keys have been disabled, last error: "+reason)
+		return
+	}
+	subject := fmt.Sprintf("Channel Key Status Change Notification")
+	content := message.EmailTemplate(
+		subject,
+		fmt.Sprintf(`
+			<p>Hello!</p>
+			<p>A key of channel「<strong>%s</strong>」（#%d）has been disabled, %d keys left.</p>
+			<p>Disable reason:</p>
+			<p style="background-color: #f8f8f8; padding: 10px; border-radius: 4px;">%s</p>
+		`, channelName, channelId, remaining, reason),
+	)
+	NotifyRootUser(message.EventChannelKeyDisabled, subject,
+		fmt.Sprintf("A key of channel %s (#%d) has been disabled, %d keys left, reason: %s", channelName, channelId, remaining, reason), content)
 }
 
 func MetricDisableChannel(channelId int, successRate float64) {
 	model.UpdateChannelStatusById(channelId, model.ChannelStatusAutoDisabled)
 	logger.SysLog(fmt.Sprintf("channel #%d has been disabled due to low success rate: %.2f", channelId, successRate*100))
+	model.TriggerWebhookEvent(0, model.WebhookEventChannelDisabled, map[string]any{
+		"channel_id":   channelId,
+		"reason":       fmt.Sprintf("success rate %.2f%% is below %.2f%%", successRate*100, config.MetricSuccessRateThreshold*100),
+		"success_rate": successRate,
+	})
 	subject := fmt.Sprintf("Channel Status Change Notification")
 	content := message.EmailTemplate(
 		subject,
@@ -57,13 +110,19 @@ func MetricDisableChannel(channelId int, successRate float64) {
 			<p style="background-color: #f8f8f8; padding: 10px; border-radius: 4px;">The channel's success rate in the recent %d calls is <strong>%.2f%%</strong>, which is below the system threshold <strong>%.2f%%</strong>.</p>
 		`, channelId, config.MetricQueueSize, successRate*100, config.MetricSuccessRateThreshold*100),
 	)
-	notifyRootUser(subject, content)
+	NotifyRootUser(message.EventChannelDisabled, subject,
+		fmt.Sprintf("Channel #%d has been disabled, its success rate in the recent %d calls is %.2f%%, below the threshold %.2f%%",
+			channelId, config.MetricQueueSize, successRate*100, config.MetricSuccessRateThreshold*100), content)
 }
 
 // EnableChannel enable & notify
 func EnableChannel(channelId int, channelName string) {
 	model.UpdateChannelStatusById(channelId, model.ChannelStatusEnabled)
 	logger.SysLog(fmt.Sprintf("channel #%d has been enabled", channelId))
+	model.TriggerWebhookEvent(0, model.WebhookEventChannelEnabled, map[string]any{
+		"channel_id":   channelId,
+		"channel_name": channelName,
+	})
 	subject := fmt.Sprintf("Channel Status Change Notification")
 	content := message.EmailTemplate(
 		subject,
@@ -73,5 +132,6 @@ func EnableChannel(channelId int, channelName string) {
 			<p>You can now continue using this channel.</p>
 		`, channelName, channelId),
 	)
-	notifyRootUser(subject, content)
+	NotifyRootUser(message.EventChannelEnabled, subject,
+		fmt.Sprintf("Channel %s (#%d) has been re-enabled", channelName, channelId), content)
 }
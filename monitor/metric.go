@@ -1,6 +1,8 @@
 package monitor
 
 import (
+	"time"
+
 	"github.com/songquanpeng/one-api/common/config"
 )
 
@@ -65,7 +67,12 @@ func init() {
 	}
 }
 
-func Emit(channelId int, success bool) {
+// Emit records the result of a request served by a channel.
+func Emit(channelId int, success bool, latency time.Duration) {
+	recordStats(channelId, success, latency)
+	if success {
+		recordBreakerSuccess(channelId)
+	}
 	if !config.EnableMetric {
 		return
 	}
@@ -1,6 +1,7 @@
 package anthropic
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -8,11 +9,15 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/relay/adaptor"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
+var _ NativeAdaptor = new(Adaptor)
+
 type Adaptor struct {
 }
 
@@ -39,6 +44,10 @@ func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *me
 	if strings.HasPrefix(meta.ActualModelName, "claude-3-5-sonnet") {
 		req.Header.Set("anthropic-beta", "max-tokens-3-5-sonnet-2024-07-15")
 	}
+	// native clients opt into beta features themselves
+	if anthropicBeta := c.Request.Header.Get("anthropic-beta"); meta.Mode == relaymode.ClaudeMessages && anthropicBeta != "" {
+		req.Header.Set("anthropic-beta", anthropicBeta)
+	}
 
 	return nil
 }
@@ -70,6 +79,38 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Met
 	return
 }
 
+// ConvertClaudeRequest forwards the raw request body, only overriding the
+// fields the relay may have changed, so that fields unknown to Request
+// (cache_control, thinking, ...) reach the upstream untouched.
+func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, meta *meta.Meta, request *Request) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil, err
+	}
+	rawRequest := make(map[string]any)
+	err = json.Unmarshal(requestBody, &rawRequest)
+	if err != nil {
+		return nil, err
+	}
+	rawRequest["model"] = request.Model
+	if meta.ForcedSystemPrompt != "" {
+		rawRequest["system"] = request.System
+	}
+	return rawRequest, nil
+}
+
+func (a *Adaptor) DoClaudeResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	if meta.IsStream {
+		err, usage = NativeStreamHandler(c, resp)
+	} else {
+		err, usage = NativeHandler(c, resp)
+	}
+	return
+}
+
 func (a *Adaptor) GetModelList() []string {
 	return ModelList
 }
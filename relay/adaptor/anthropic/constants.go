@@ -10,4 +10,8 @@ var ModelList = []string{
 	"claude-3-5-sonnet-20240620",
 	"claude-3-5-sonnet-20241022",
 	"claude-3-5-sonnet-latest",
+	"claude-sonnet-4-0",
+	"claude-sonnet-4-20250514",
+	"claude-sonnet-4-5",
+	"claude-sonnet-4-5-20250929",
 }
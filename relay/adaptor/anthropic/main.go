@@ -263,9 +263,10 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 	})
 
 	common.SetEventStreamHeaders(c)
+	stopWatching := common.WatchClientAbort(c, resp.Body)
 
 	var usage model.Usage
-	var modelName string
+	var modelName, responseText string
 	var id string
 	var lastToolCallChoice openai.ChatCompletionsStreamResponseChoice
 
@@ -284,10 +285,10 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 			continue
 		}
 
+		MergeStreamUsage(&usage, &claudeResponse)
+		responseText += claudeResponse.DeltaText()
 		response, meta := StreamResponseClaude2OpenAI(&claudeResponse)
 		if meta != nil {
-			usage.PromptTokens += meta.Usage.InputTokens
-			usage.CompletionTokens += meta.Usage.OutputTokens
 			if len(meta.Id) > 0 { // only message_start has an id, otherwise it's a finish_reason event.
 				modelName = meta.Model
 				id = fmt.Sprintf("chatcmpl-%s", meta.Id)
@@ -321,12 +322,18 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 			logger.SysError(err.Error())
 		}
 	}
+	aborted := stopWatching()
 
-	if err := scanner.Err(); err != nil {
+	if err := scanner.Err(); err != nil && !aborted {
 		logger.SysError("error reading stream: " + err.Error())
 	}
 
-	render.Done(c)
+	if aborted {
+		logger.Warn(c.Request.Context(), "client aborted the stream")
+		CountAbortedUsage(&usage, responseText, modelName)
+	} else {
+		render.Done(c)
+	}
 
 	err := resp.Body.Close()
 	if err != nil {
@@ -349,7 +356,7 @@ func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName st
 	if err != nil {
 		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
 	}
-	if claudeResponse.Error.Type != "" {
+	if claudeResponse.Error != nil && claudeResponse.Error.Type != "" {
 		return &model.ErrorWithStatusCode{
 			Error: model.Error{
 				Message: claudeResponse.Error.Message,
@@ -362,11 +369,7 @@ func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName st
 	}
 	fullTextResponse := ResponseClaude2OpenAI(&claudeResponse)
 	fullTextResponse.Model = modelName
-	usage := model.Usage{
-		PromptTokens:     claudeResponse.Usage.InputTokens,
-		CompletionTokens: claudeResponse.Usage.OutputTokens,
-		TotalTokens:      claudeResponse.Usage.InputTokens + claudeResponse.Usage.OutputTokens,
-	}
+	usage := *claudeResponse.Usage.ToUsage()
 	fullTextResponse.Usage = usage
 	jsonResponse, err := json.Marshal(fullTextResponse)
 	if err != nil {
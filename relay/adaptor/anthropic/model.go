@@ -1,5 +1,7 @@
 package anthropic
 
+import "encoding/json"
+
 // https://docs.anthropic.com/claude/reference/messages_post
 
 type Metadata struct {
@@ -8,8 +10,9 @@ type Metadata struct {
 
 type ImageSource struct {
 	Type      string `json:"type"`
-	MediaType string `json:"media_type"`
-	Data      string `json:"data"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	Url       string `json:"url,omitempty"`
 }
 
 type Content struct {
@@ -20,7 +23,7 @@ type Content struct {
 	Id        string `json:"id,omitempty"`
 	Name      string `json:"name,omitempty"`
 	Input     any    `json:"input,omitempty"`
-	Content   string `json:"content,omitempty"`
+	Content   any    `json:"content,omitempty"` // string or []Content for tool_result
 	ToolUseId string `json:"tool_use_id,omitempty"`
 }
 
@@ -29,6 +32,25 @@ type Message struct {
 	Content []Content `json:"content"`
 }
 
+// UnmarshalJSON accepts the string shorthand for content used by the Messages API.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var message struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &message); err != nil {
+		return err
+	}
+	m.Role = message.Role
+	m.Content = nil
+	var text string
+	if err := json.Unmarshal(message.Content, &text); err == nil {
+		m.Content = []Content{{Type: "text", Text: text}}
+		return nil
+	}
+	return json.Unmarshal(message.Content, &m.Content)
+}
+
 type Tool struct {
 	Name        string      `json:"name"`
 	Description string      `json:"description,omitempty"`
@@ -53,12 +75,41 @@ type Request struct {
 	TopK          int       `json:"top_k,omitempty"`
 	Tools         []Tool    `json:"tools,omitempty"`
 	ToolChoice    any       `json:"tool_choice,omitempty"`
-	//Metadata    `json:"metadata,omitempty"`
+	Metadata      *Metadata `json:"metadata,omitempty"`
+}
+
+// UnmarshalJSON accepts system prompts given either as a string or as a list of text blocks.
+func (r *Request) UnmarshalJSON(data []byte) error {
+	type request Request
+	aux := struct {
+		*request
+		System json.RawMessage `json:"system,omitempty"`
+	}{request: (*request)(r)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	r.System = ""
+	if len(aux.System) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(aux.System, &r.System); err == nil {
+		return nil
+	}
+	var blocks []Content
+	if err := json.Unmarshal(aux.System, &blocks); err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		r.System += block.Text
+	}
+	return nil
 }
 
 type Usage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
 }
 
 type Error struct {
@@ -75,7 +126,13 @@ type Response struct {
 	StopReason   *string   `json:"stop_reason"`
 	StopSequence *string   `json:"stop_sequence"`
 	Usage        Usage     `json:"usage"`
-	Error        Error     `json:"error"`
+	Error        *Error    `json:"error,omitempty"`
+}
+
+// ErrorResponse is the error body returned by the Messages API.
+type ErrorResponse struct {
+	Type  string `json:"type"`
+	Error Error  `json:"error"`
 }
 
 type Delta struct {
@@ -0,0 +1,372 @@
+package anthropic
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// NativeAdaptor is implemented by adaptors whose upstream speaks the Anthropic
+// Messages API, so that /v1/messages requests can be relayed without being
+// converted to the OpenAI format and back.
+type NativeAdaptor interface {
+	ConvertClaudeRequest(c *gin.Context, meta *meta.Meta, request *Request) (any, error)
+	DoClaudeResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode)
+}
+
+func stopReasonOpenAI2Claude(reason string) string {
+	switch reason {
+	case "stop":
+		return "end_turn"
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	default:
+		return reason
+	}
+}
+
+func toolChoiceClaude2OpenAI(toolChoice any) any {
+	choice, ok := toolChoice.(map[string]any)
+	if !ok {
+		return nil
+	}
+	switch choice["type"] {
+	case "auto":
+		return "auto"
+	case "any":
+		return "required"
+	case "none":
+		return "none"
+	case "tool":
+		return map[string]any{
+			"type": "function",
+			"function": map[string]any{
+				"name": choice["name"],
+			},
+		}
+	}
+	return nil
+}
+
+func toolResultText(content any) string {
+	switch v := content.(type) {
+	case string:
+		return v
+	case []any:
+		var text string
+		for _, item := range v {
+			if block, ok := item.(map[string]any); ok && block["type"] == "text" {
+				if s, ok := block["text"].(string); ok {
+					text += s
+				}
+			}
+		}
+		return text
+	}
+	return ""
+}
+
+// ConvertRequestToOpenAI converts an inbound Messages API request into the
+// OpenAI chat completions format, for channels that do not speak Claude natively.
+func ConvertRequestToOpenAI(claudeRequest *Request) *model.GeneralOpenAIRequest {
+	openaiRequest := model.GeneralOpenAIRequest{
+		Model:       claudeRequest.Model,
+		MaxTokens:   claudeRequest.MaxTokens,
+		Stream:      claudeRequest.Stream,
+		Temperature: claudeRequest.Temperature,
+		TopP:        claudeRequest.TopP,
+		TopK:        claudeRequest.TopK,
+		ToolChoice:  toolChoiceClaude2OpenAI(claudeRequest.ToolChoice),
+	}
+	if len(claudeRequest.StopSequences) > 0 {
+		openaiRequest.Stop = claudeRequest.StopSequences
+	}
+	if claudeRequest.Metadata != nil {
+		openaiRequest.User = claudeRequest.Metadata.UserId
+	}
+	for _, tool := range claudeRequest.Tools {
+		openaiRequest.Tools = append(openaiRequest.Tools, model.Tool{
+			Type: "function",
+			Function: model.Function{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters: map[string]any{
+					"type":       tool.InputSchema.Type,
+					"properties": tool.InputSchema.Properties,
+					"required":   tool.InputSchema.Required,
+				},
+			},
+		})
+	}
+	if claudeRequest.System != "" {
+		openaiRequest.Messages = append(openaiRequest.Messages, model.Message{
+			Role:    "system",
+			Content: claudeRequest.System,
+		})
+	}
+	for _, message := range claudeRequest.Messages {
+		var contents []model.MessageContent
+		var toolCalls []model.Tool
+		for _, content := range message.Content {
+			switch content.Type {
+			case "text":
+				contents = append(contents, model.MessageContent{
+					Type: model.ContentTypeText,
+					Text: content.Text,
+				})
+			case "image":
+				if content.Source == nil {
+					continue
+				}
+				url := content.Source.Url
+				if content.Source.Type == "base64" {
+					url = fmt.Sprintf("data:%s;base64,%s", content.Source.MediaType, content.Source.Data)
+				}
+				contents = append(contents, model.MessageContent{
+					Type:     model.ContentTypeImageURL,
+					ImageURL: &model.ImageURL{Url: url},
+				})
+			case "tool_use":
+				args, _ := json.Marshal(content.Input)
+				toolCalls = append(toolCalls, model.Tool{
+					Id:   content.Id,
+					Type: "function",
+					Function: model.Function{
+						Name:      content.Name,
+						Arguments: string(args),
+					},
+				})
+			case "tool_result":
+				openaiRequest.Messages = append(openaiRequest.Messages, model.Message{
+					Role:       "tool",
+					Content:    toolResultText(content.Content),
+					ToolCallId: content.ToolUseId,
+				})
+			}
+		}
+		if len(contents) == 0 && len(toolCalls) == 0 {
+			continue
+		}
+		openaiMessage := model.Message{
+			Role:      message.Role,
+			ToolCalls: toolCalls,
+		}
+		if len(contents) == 1 && contents[0].Type == model.ContentTypeText {
+			openaiMessage.Content = contents[0].Text
+		} else if len(contents) > 0 {
+			openaiMessage.Content = contents
+		}
+		openaiRequest.Messages = append(openaiRequest.Messages, openaiMessage)
+	}
+	return &openaiRequest
+}
+
+// ResponseOpenAI2Claude converts a chat completion into a Messages API response.
+func ResponseOpenAI2Claude(textResponse *openai.TextResponse) *Response {
+	claudeResponse := Response{
+		Id:    textResponse.Id,
+		Type:  "message",
+		Role:  "assistant",
+		Model: textResponse.Model,
+		Usage: Usage{
+			InputTokens:  textResponse.PromptTokens,
+			OutputTokens: textResponse.CompletionTokens,
+		},
+	}
+	if details := textResponse.PromptTokensDetails; details != nil {
+		claudeResponse.Usage.InputTokens -= details.CachedTokens + details.CacheWriteTokens
+		claudeResponse.Usage.CacheReadInputTokens = details.CachedTokens
+		claudeResponse.Usage.CacheCreationInputTokens = details.CacheWriteTokens
+	}
+	if len(textResponse.Choices) == 0 {
+		return &claudeResponse
+	}
+	choice := textResponse.Choices[0]
+	if text := choice.Message.StringContent(); text != "" {
+		claudeResponse.Content = append(claudeResponse.Content, Content{
+			Type: "text",
+			Text: text,
+		})
+	}
+	for _, toolCall := range choice.Message.ToolCalls {
+		input := make(map[string]any)
+		if args, ok := toolCall.Function.Arguments.(string); ok {
+			_ = json.Unmarshal([]byte(args), &input)
+		}
+		claudeResponse.Content = append(claudeResponse.Content, Content{
+			Type:  "tool_use",
+			Id:    toolCall.Id,
+			Name:  toolCall.Function.Name,
+			Input: input,
+		})
+	}
+	stopReason := stopReasonOpenAI2Claude(choice.FinishReason)
+	claudeResponse.StopReason = &stopReason
+	return &claudeResponse
+}
+
+// NativeStreamHandler relays a Messages API event stream to the client as-is,
+// collecting usage from the message_start and message_delta events.
+func NativeStreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	scanner.Split(bufio.ScanLines)
+
+	common.SetEventStreamHeaders(c)
+	c.Writer.WriteHeader(resp.StatusCode)
+	stopWatching := common.WatchClientAbort(c, resp.Body)
+
+	var usage model.Usage
+	var modelName, responseText string
+	for scanner.Scan() {
+		line := scanner.Text()
+		_, err := c.Writer.WriteString(line + "\n")
+		if err != nil {
+			logger.SysError("error writing stream response: " + err.Error())
+			break
+		}
+		if line == "" {
+			c.Writer.Flush()
+			continue
+		}
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		var claudeResponse StreamResponse
+		err = json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &claudeResponse)
+		if err != nil {
+			logger.SysError("error unmarshalling stream response: " + err.Error())
+			continue
+		}
+		MergeStreamUsage(&usage, &claudeResponse)
+		if claudeResponse.Message != nil {
+			modelName = claudeResponse.Message.Model
+		}
+		responseText += claudeResponse.DeltaText()
+	}
+	aborted := stopWatching()
+	c.Writer.Flush()
+
+	if err := scanner.Err(); err != nil && !aborted {
+		logger.SysError("error reading stream: " + err.Error())
+	}
+	if aborted {
+		logger.Warn(c.Request.Context(), "client aborted the stream")
+		CountAbortedUsage(&usage, responseText, modelName)
+	}
+
+	err := resp.Body.Close()
+	if err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return nil, &usage
+}
+
+// MergeStreamUsage updates usage from a stream event. The output token count
+// reported by message_delta is cumulative, so it replaces rather than adds.
+func MergeStreamUsage(usage *model.Usage, claudeResponse *StreamResponse) {
+	switch claudeResponse.Type {
+	case "message_start":
+		if claudeResponse.Message != nil {
+			*usage = *claudeResponse.Message.Usage.ToUsage()
+		}
+	case "message_delta":
+		if claudeResponse.Usage != nil {
+			if claudeResponse.Usage.InputTokens > 0 {
+				*usage = *claudeResponse.Usage.ToUsage()
+			}
+			usage.CompletionTokens = claudeResponse.Usage.OutputTokens
+			usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+		}
+	}
+}
+
+// DeltaText returns the text, or the tool input, a stream event adds.
+func (r *StreamResponse) DeltaText() string {
+	if r.Type != "content_block_delta" || r.Delta == nil {
+		return ""
+	}
+	return r.Delta.Text + r.Delta.PartialJson
+}
+
+// CountAbortedUsage makes up for the output tokens of a stream the client
+// aborted: Claude only reports them in the final message_delta, so they are
+// counted from the text delivered so far.
+func CountAbortedUsage(usage *model.Usage, responseText string, modelName string) {
+	completionTokens := openai.CountTokenText(responseText, modelName)
+	if completionTokens > usage.CompletionTokens {
+		usage.CompletionTokens = completionTokens
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+}
+
+// ToUsage converts the usage of a Claude response. Claude counts the cached
+// input apart from the input tokens, while they are part of the prompt tokens.
+func (u *Usage) ToUsage() *model.Usage {
+	usage := &model.Usage{
+		PromptTokens:     u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens,
+		CompletionTokens: u.OutputTokens,
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	if u.CacheReadInputTokens > 0 || u.CacheCreationInputTokens > 0 {
+		usage.PromptTokensDetails = &model.PromptTokensDetails{
+			CachedTokens:     u.CacheReadInputTokens,
+			CacheWriteTokens: u.CacheCreationInputTokens,
+		}
+	}
+	return usage
+}
+
+// NativeHandler relays a Messages API response to the client as-is.
+func NativeHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	return WriteNativeResponse(c, resp.StatusCode, responseBody)
+}
+
+// WriteNativeResponse writes a Messages API response body to the client and
+// returns the usage it reports.
+func WriteNativeResponse(c *gin.Context, statusCode int, responseBody []byte) (*model.ErrorWithStatusCode, *model.Usage) {
+	var claudeResponse Response
+	err := json.Unmarshal(responseBody, &claudeResponse)
+	if err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if claudeResponse.Error != nil && claudeResponse.Error.Type != "" {
+		return &model.ErrorWithStatusCode{
+			Error: model.Error{
+				Message: claudeResponse.Error.Message,
+				Type:    claudeResponse.Error.Type,
+				Param:   "",
+				Code:    claudeResponse.Error.Type,
+			},
+			StatusCode: statusCode,
+		}, nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(statusCode)
+	_, err = c.Writer.Write(responseBody)
+	if err != nil {
+		return openai.ErrorWrapper(err, "write_response_body_failed", http.StatusInternalServerError), nil
+	}
+	return nil, claudeResponse.Usage.ToUsage()
+}
@@ -0,0 +1,149 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestConvertRequestToOpenAI(t *testing.T) {
+	var claudeRequest Request
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"model": "claude-3-5-sonnet-20241022",
+		"max_tokens": 1024,
+		"system": [{"type": "text", "text": "be brief"}],
+		"stop_sequences": ["END"],
+		"tools": [{"name": "get_weather", "description": "weather of a city", "input_schema": {"type": "object", "properties": {"city": {"type": "string"}}, "required": ["city"]}}],
+		"tool_choice": {"type": "any"},
+		"messages": [
+			{"role": "user", "content": "weather in Paris?"},
+			{"role": "assistant", "content": [{"type": "text", "text": "let me check"}, {"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"city": "Paris"}}]},
+			{"role": "user", "content": [{"type": "tool_result", "tool_use_id": "toolu_1", "content": [{"type": "text", "text": "sunny"}]}]},
+			{"role": "user", "content": [{"type": "text", "text": "and this?"}, {"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "aGk="}}]}
+		]
+	}`), &claudeRequest))
+
+	openaiRequest := ConvertRequestToOpenAI(&claudeRequest)
+	assert.Equal(t, "claude-3-5-sonnet-20241022", openaiRequest.Model)
+	assert.Equal(t, 1024, openaiRequest.MaxTokens)
+	assert.Equal(t, []string{"END"}, openaiRequest.Stop)
+	assert.Equal(t, "required", openaiRequest.ToolChoice)
+	require.Len(t, openaiRequest.Tools, 1)
+	assert.Equal(t, "get_weather", openaiRequest.Tools[0].Function.Name)
+
+	require.Len(t, openaiRequest.Messages, 5)
+	assert.Equal(t, "system", openaiRequest.Messages[0].Role)
+	assert.Equal(t, "be brief", openaiRequest.Messages[0].StringContent())
+	assert.Equal(t, "weather in Paris?", openaiRequest.Messages[1].StringContent())
+
+	assistant := openaiRequest.Messages[2]
+	assert.Equal(t, "let me check", assistant.StringContent())
+	require.Len(t, assistant.ToolCalls, 1)
+	assert.Equal(t, "toolu_1", assistant.ToolCalls[0].Id)
+	assert.JSONEq(t, `{"city":"Paris"}`, assistant.ToolCalls[0].Function.Arguments.(string))
+
+	toolResult := openaiRequest.Messages[3]
+	assert.Equal(t, "tool", toolResult.Role)
+	assert.Equal(t, "toolu_1", toolResult.ToolCallId)
+	assert.Equal(t, "sunny", toolResult.StringContent())
+
+	contents, ok := openaiRequest.Messages[4].Content.([]model.MessageContent)
+	require.True(t, ok)
+	require.Len(t, contents, 2)
+	assert.Equal(t, model.ContentTypeImageURL, contents[1].Type)
+	assert.Equal(t, "data:image/png;base64,aGk=", contents[1].ImageURL.Url)
+}
+
+func TestResponseOpenAI2Claude(t *testing.T) {
+	var textResponse openai.TextResponse
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"id": "chatcmpl-1",
+		"model": "gpt-4o",
+		"choices": [{"index": 0, "finish_reason": "tool_calls", "message": {"role": "assistant", "content": "checking",
+			"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}]}}],
+		"usage": {"prompt_tokens": 100, "completion_tokens": 20, "total_tokens": 120, "prompt_tokens_details": {"cached_tokens": 60}}
+	}`), &textResponse))
+
+	claudeResponse := ResponseOpenAI2Claude(&textResponse)
+	assert.Equal(t, "message", claudeResponse.Type)
+	require.Len(t, claudeResponse.Content, 2)
+	assert.Equal(t, "checking", claudeResponse.Content[0].Text)
+	assert.Equal(t, "tool_use", claudeResponse.Content[1].Type)
+	assert.Equal(t, "call_1", claudeResponse.Content[1].Id)
+	assert.Equal(t, map[string]any{"city": "Paris"}, claudeResponse.Content[1].Input)
+	require.NotNil(t, claudeResponse.StopReason)
+	assert.Equal(t, "tool_use", *claudeResponse.StopReason)
+	// Claude counts cached input apart from the input tokens
+	assert.Equal(t, Usage{InputTokens: 40, OutputTokens: 20, CacheReadInputTokens: 60}, claudeResponse.Usage)
+	assert.Equal(t, &model.Usage{
+		PromptTokens:        100,
+		CompletionTokens:    20,
+		TotalTokens:         120,
+		PromptTokensDetails: &model.PromptTokensDetails{CachedTokens: 60},
+	}, claudeResponse.Usage.ToUsage())
+}
+
+func TestResponseWriterStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	writer := NewResponseWriter(c.Writer, true, "claude-3-5-sonnet-20241022", 12)
+
+	chunks := []string{
+		`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}`,
+		`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"content":"lo"}}]}`,
+		`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+		`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":\"Paris\"}"}}]},"finish_reason":"tool_calls"}]}`,
+	}
+	for _, chunk := range chunks {
+		// events may be split across writes
+		data := "data: " + chunk + "\n\n"
+		_, _ = writer.Write([]byte(data[:10]))
+		_, _ = writer.Write([]byte(data[10:]))
+	}
+	_, _ = writer.Write([]byte("data: [DONE]\n\n"))
+	writer.Finish(&model.Usage{PromptTokens: 12, CompletionTokens: 7})
+
+	var events []string
+	var payloads []map[string]any
+	for _, line := range strings.Split(recorder.Body.String(), "\n") {
+		if strings.HasPrefix(line, "event: ") {
+			events = append(events, strings.TrimPrefix(line, "event: "))
+		}
+		if strings.HasPrefix(line, "data: ") {
+			var payload map[string]any
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &payload))
+			payloads = append(payloads, payload)
+		}
+	}
+	assert.Equal(t, []string{
+		"message_start",
+		"content_block_start", "content_block_delta", "content_block_delta", "content_block_stop",
+		"content_block_start", "content_block_delta", "content_block_stop",
+		"message_delta", "message_stop",
+	}, events)
+	assert.Equal(t, "Hel", payloads[2]["delta"].(map[string]any)["text"])
+	assert.Equal(t, "call_1", payloads[5]["content_block"].(map[string]any)["id"])
+	assert.Equal(t, `{"city":"Paris"}`, payloads[6]["delta"].(map[string]any)["partial_json"])
+	assert.Equal(t, "tool_use", payloads[8]["delta"].(map[string]any)["stop_reason"])
+	assert.Equal(t, 7.0, payloads[8]["usage"].(map[string]any)["output_tokens"])
+}
+
+func TestMergeStreamUsage(t *testing.T) {
+	usage := &model.Usage{}
+	MergeStreamUsage(usage, &StreamResponse{Type: "message_start", Message: &Response{Usage: Usage{InputTokens: 10, CacheCreationInputTokens: 5, OutputTokens: 1}}})
+	MergeStreamUsage(usage, &StreamResponse{Type: "message_delta", Usage: &Usage{OutputTokens: 30}})
+	assert.Equal(t, 15, usage.PromptTokens)
+	assert.Equal(t, 30, usage.CompletionTokens)
+	assert.Equal(t, 45, usage.TotalTokens)
+	require.NotNil(t, usage.PromptTokensDetails)
+	assert.Equal(t, 5, usage.PromptTokensDetails.CacheWriteTokens)
+}
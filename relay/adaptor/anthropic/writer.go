@@ -0,0 +1,248 @@
+package anthropic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/conv"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// ResponseWriter translates the OpenAI chat completion output written by any
+// adaptor into the Messages API format, so that /v1/messages can be served by
+// channels that do not speak Claude natively.
+type ResponseWriter struct {
+	gin.ResponseWriter
+
+	isStream     bool
+	modelName    string
+	promptTokens int
+	statusCode   int
+	buffer       bytes.Buffer
+
+	// stream state
+	started    bool
+	blockIndex int
+	blockType  string
+	stopReason string
+	usage      *model.Usage
+}
+
+func NewResponseWriter(w gin.ResponseWriter, isStream bool, modelName string, promptTokens int) *ResponseWriter {
+	return &ResponseWriter{
+		ResponseWriter: w,
+		isStream:       isStream,
+		modelName:      modelName,
+		promptTokens:   promptTokens,
+		statusCode:     http.StatusOK,
+		blockIndex:     -1,
+	}
+}
+
+func (w *ResponseWriter) WriteHeader(statusCode int) {
+	// c.Render passes -1 for streamed events
+	if statusCode > 0 {
+		w.statusCode = statusCode
+	}
+}
+
+func (w *ResponseWriter) WriteHeaderNow() {}
+
+func (w *ResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *ResponseWriter) Write(data []byte) (int, error) {
+	w.buffer.Write(data)
+	if !w.isStream {
+		return len(data), nil
+	}
+	for {
+		line, err := w.buffer.ReadString('\n')
+		if err != nil {
+			// keep the incomplete line for the next write
+			w.buffer.Reset()
+			w.buffer.WriteString(line)
+			break
+		}
+		w.handleStreamLine(strings.TrimSpace(line))
+	}
+	return len(data), nil
+}
+
+func (w *ResponseWriter) Flush() {
+	if w.isStream {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *ResponseWriter) handleStreamLine(line string) {
+	if !strings.HasPrefix(line, "data:") {
+		return
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	if data == "[DONE]" {
+		return
+	}
+	var streamResponse openai.ChatCompletionsStreamResponse
+	err := json.Unmarshal([]byte(data), &streamResponse)
+	if err != nil {
+		logger.SysError("error unmarshalling stream response: " + err.Error())
+		return
+	}
+	if streamResponse.Usage != nil {
+		w.usage = streamResponse.Usage
+	}
+	w.startMessage(streamResponse.Id)
+	for _, choice := range streamResponse.Choices {
+		if text := conv.AsString(choice.Delta.Content); text != "" {
+			if w.blockType != "text" {
+				w.startBlock(map[string]any{"type": "text", "text": ""}, "text")
+			}
+			w.writeEvent("content_block_delta", map[string]any{
+				"index": w.blockIndex,
+				"delta": map[string]any{"type": "text_delta", "text": text},
+			})
+		}
+		for _, toolCall := range choice.Delta.ToolCalls {
+			if toolCall.Id != "" {
+				w.startBlock(map[string]any{
+					"type":  "tool_use",
+					"id":    toolCall.Id,
+					"name":  toolCall.Function.Name,
+					"input": map[string]any{},
+				}, "tool_use")
+			}
+			if args, ok := toolCall.Function.Arguments.(string); ok && args != "" && w.blockType == "tool_use" {
+				w.writeEvent("content_block_delta", map[string]any{
+					"index": w.blockIndex,
+					"delta": map[string]any{"type": "input_json_delta", "partial_json": args},
+				})
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			w.stopReason = stopReasonOpenAI2Claude(*choice.FinishReason)
+		}
+	}
+}
+
+func (w *ResponseWriter) startMessage(id string) {
+	if w.started {
+		return
+	}
+	w.started = true
+	w.writeEvent("message_start", map[string]any{
+		"message": map[string]any{
+			"id":            id,
+			"type":          "message",
+			"role":          "assistant",
+			"content":       []any{},
+			"model":         w.modelName,
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage": map[string]any{
+				"input_tokens":  w.promptTokens,
+				"output_tokens": 0,
+			},
+		},
+	})
+}
+
+func (w *ResponseWriter) startBlock(contentBlock map[string]any, blockType string) {
+	w.stopBlock()
+	w.blockIndex++
+	w.blockType = blockType
+	w.writeEvent("content_block_start", map[string]any{
+		"index":         w.blockIndex,
+		"content_block": contentBlock,
+	})
+}
+
+func (w *ResponseWriter) stopBlock() {
+	if w.blockType == "" {
+		return
+	}
+	w.writeEvent("content_block_stop", map[string]any{"index": w.blockIndex})
+	w.blockType = ""
+}
+
+func (w *ResponseWriter) writeEvent(event string, payload map[string]any) {
+	payload["type"] = event
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		logger.SysError("error marshalling stream response: " + err.Error())
+		return
+	}
+	_, err = w.ResponseWriter.WriteString(fmt.Sprintf("event: %s\ndata: %s\n\n", event, jsonData))
+	if err != nil {
+		logger.SysError("error writing stream response: " + err.Error())
+		return
+	}
+	w.ResponseWriter.Flush()
+}
+
+// Finish completes the translated response once the adaptor has returned.
+// usage is the final usage computed by the relay, which takes precedence over
+// the usage seen in the stream.
+func (w *ResponseWriter) Finish(usage *model.Usage) {
+	if usage == nil {
+		usage = w.usage
+	}
+	if w.isStream {
+		w.finishStream(usage)
+		return
+	}
+	w.ResponseWriter.Header().Del("Content-Length")
+	w.ResponseWriter.Header().Set("Content-Type", "application/json")
+	if w.statusCode != http.StatusOK {
+		w.ResponseWriter.WriteHeader(w.statusCode)
+		_, _ = w.ResponseWriter.Write(w.buffer.Bytes())
+		return
+	}
+	var textResponse openai.TextResponse
+	err := json.Unmarshal(w.buffer.Bytes(), &textResponse)
+	if err != nil {
+		logger.SysError("error unmarshalling response: " + err.Error())
+		w.ResponseWriter.WriteHeader(w.statusCode)
+		_, _ = w.ResponseWriter.Write(w.buffer.Bytes())
+		return
+	}
+	if usage != nil {
+		textResponse.Usage = *usage
+	}
+	claudeResponse := ResponseOpenAI2Claude(&textResponse)
+	claudeResponse.Model = w.modelName
+	jsonResponse, err := json.Marshal(claudeResponse)
+	if err != nil {
+		logger.SysError("error marshalling response: " + err.Error())
+		return
+	}
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	_, _ = w.ResponseWriter.Write(jsonResponse)
+}
+
+func (w *ResponseWriter) finishStream(usage *model.Usage) {
+	w.startMessage("")
+	w.stopBlock()
+	if w.stopReason == "" {
+		w.stopReason = "end_turn"
+	}
+	outputTokens := 0
+	if usage != nil {
+		outputTokens = usage.CompletionTokens
+	}
+	w.writeEvent("message_delta", map[string]any{
+		"delta": map[string]any{
+			"stop_reason":   w.stopReason,
+			"stop_sequence": nil,
+		},
+		"usage": map[string]any{"output_tokens": outputTokens},
+	})
+	w.writeEvent("message_stop", map[string]any{})
+}
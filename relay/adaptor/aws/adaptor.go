@@ -10,12 +10,15 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/anthropic"
+	claude "github.com/songquanpeng/one-api/relay/adaptor/aws/claude"
 	"github.com/songquanpeng/one-api/relay/adaptor/aws/utils"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
 )
 
 var _ adaptor.Adaptor = new(Adaptor)
+var _ anthropic.NativeAdaptor = new(Adaptor)
 
 type Adaptor struct {
 	awsAdapter utils.AwsAdapter
@@ -53,6 +56,17 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Met
 	return a.awsAdapter.DoResponse(c, a.AwsClient, meta)
 }
 
+func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, meta *meta.Meta, request *anthropic.Request) (any, error) {
+	if _, ok := GetAdaptor(request.Model).(*claude.Adaptor); !ok {
+		return nil, errors.New("adaptor not found")
+	}
+	return (&claude.Adaptor{}).ConvertClaudeRequest(c, request)
+}
+
+func (a *Adaptor) DoClaudeResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	return (&claude.Adaptor{}).DoClaudeResponse(c, a.AwsClient, meta)
+}
+
 func (a *Adaptor) GetModelList() (models []string) {
 	for model := range adaptors {
 		models = append(models, model)
@@ -27,6 +27,24 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.G
 	return claudeReq, nil
 }
 
+func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, request *anthropic.Request) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	c.Set(ctxkey.RequestModel, request.Model)
+	c.Set(ctxkey.ConvertedRequest, request)
+	return request, nil
+}
+
+func (a *Adaptor) DoClaudeResponse(c *gin.Context, awsCli *bedrockruntime.Client, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	if meta.IsStream {
+		err, usage = NativeStreamHandler(c, awsCli)
+	} else {
+		err, usage = NativeHandler(c, awsCli)
+	}
+	return
+}
+
 func (a *Adaptor) DoResponse(c *gin.Context, awsCli *bedrockruntime.Client, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
 	if meta.IsStream {
 		err, usage = StreamHandler(c, awsCli)
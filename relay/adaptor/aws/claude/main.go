@@ -88,11 +88,7 @@ func Handler(c *gin.Context, awsCli *bedrockruntime.Client, modelName string) (*
 
 	openaiResp := anthropic.ResponseClaude2OpenAI(claudeResponse)
 	openaiResp.Model = modelName
-	usage := relaymodel.Usage{
-		PromptTokens:     claudeResponse.Usage.InputTokens,
-		CompletionTokens: claudeResponse.Usage.OutputTokens,
-		TotalTokens:      claudeResponse.Usage.InputTokens + claudeResponse.Usage.OutputTokens,
-	}
+	usage := *claudeResponse.Usage.ToUsage()
 	openaiResp.Usage = usage
 
 	c.JSON(http.StatusOK, openaiResp)
@@ -138,7 +134,7 @@ func StreamHandler(c *gin.Context, awsCli *bedrockruntime.Client) (*relaymodel.E
 
 	c.Writer.Header().Set("Content-Type", "text/event-stream")
 	var usage relaymodel.Usage
-	var id string
+	var id, responseText string
 	var lastToolCallChoice openai.ChatCompletionsStreamResponseChoice
 
 	c.Stream(func(w io.Writer) bool {
@@ -157,10 +153,10 @@ func StreamHandler(c *gin.Context, awsCli *bedrockruntime.Client) (*relaymodel.E
 				return false
 			}
 
+			anthropic.MergeStreamUsage(&usage, claudeResp)
+			responseText += claudeResp.DeltaText()
 			response, meta := anthropic.StreamResponseClaude2OpenAI(claudeResp)
 			if meta != nil {
-				usage.PromptTokens += meta.Usage.InputTokens
-				usage.CompletionTokens += meta.Usage.OutputTokens
 				if len(meta.Id) > 0 { // only message_start has an id, otherwise it's a finish_reason event.
 					id = fmt.Sprintf("chatcmpl-%s", meta.Id)
 					return true
@@ -202,6 +198,110 @@ func StreamHandler(c *gin.Context, awsCli *bedrockruntime.Client) (*relaymodel.E
 			return false
 		}
 	})
+	countAbortedUsage(c, &usage, responseText)
+
+	return nil, &usage
+}
+
+func getNativeRequestBody(c *gin.Context) ([]byte, error) {
+	claudeReq_, ok := c.Get(ctxkey.ConvertedRequest)
+	if !ok {
+		return nil, errors.New("request not found")
+	}
+	claudeReq := claudeReq_.(*anthropic.Request)
+	awsClaudeReq := &Request{
+		AnthropicVersion: "bedrock-2023-05-31",
+	}
+	if err := copier.Copy(awsClaudeReq, claudeReq); err != nil {
+		return nil, errors.Wrap(err, "copy request")
+	}
+	body, err := json.Marshal(awsClaudeReq)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal request")
+	}
+	return body, nil
+}
+
+// NativeHandler serves /v1/messages, returning the Claude response as-is.
+func NativeHandler(c *gin.Context, awsCli *bedrockruntime.Client) (*relaymodel.ErrorWithStatusCode, *relaymodel.Usage) {
+	awsModelId, err := awsModelID(c.GetString(ctxkey.RequestModel))
+	if err != nil {
+		return utils.WrapErr(errors.Wrap(err, "awsModelID")), nil
+	}
+	body, err := getNativeRequestBody(c)
+	if err != nil {
+		return utils.WrapErr(err), nil
+	}
+	awsResp, err := awsCli.InvokeModel(c.Request.Context(), &bedrockruntime.InvokeModelInput{
+		ModelId:     aws.String(awsModelId),
+		Accept:      aws.String("application/json"),
+		ContentType: aws.String("application/json"),
+		Body:        body,
+	})
+	if err != nil {
+		return utils.WrapErr(errors.Wrap(err, "InvokeModel")), nil
+	}
+	return anthropic.WriteNativeResponse(c, http.StatusOK, awsResp.Body)
+}
+
+// NativeStreamHandler serves streaming /v1/messages, re-framing the Bedrock
+// event stream chunks as Messages API server-sent events.
+func NativeStreamHandler(c *gin.Context, awsCli *bedrockruntime.Client) (*relaymodel.ErrorWithStatusCode, *relaymodel.Usage) {
+	awsModelId, err := awsModelID(c.GetString(ctxkey.RequestModel))
+	if err != nil {
+		return utils.WrapErr(errors.Wrap(err, "awsModelID")), nil
+	}
+	body, err := getNativeRequestBody(c)
+	if err != nil {
+		return utils.WrapErr(err), nil
+	}
+	awsResp, err := awsCli.InvokeModelWithResponseStream(c.Request.Context(), &bedrockruntime.InvokeModelWithResponseStreamInput{
+		ModelId:     aws.String(awsModelId),
+		Accept:      aws.String("application/json"),
+		ContentType: aws.String("application/json"),
+		Body:        body,
+	})
+	if err != nil {
+		return utils.WrapErr(errors.Wrap(err, "InvokeModelWithResponseStream")), nil
+	}
+	stream := awsResp.GetStream()
+	defer stream.Close()
 
+	common.SetEventStreamHeaders(c)
+	var usage relaymodel.Usage
+	var responseText string
+	for event := range stream.Events() {
+		v, ok := event.(*types.ResponseStreamMemberChunk)
+		if !ok {
+			continue
+		}
+		claudeResp := new(anthropic.StreamResponse)
+		err := json.Unmarshal(v.Value.Bytes, claudeResp)
+		if err != nil {
+			logger.SysError("error unmarshalling stream response: " + err.Error())
+			continue
+		}
+		anthropic.MergeStreamUsage(&usage, claudeResp)
+		responseText += claudeResp.DeltaText()
+		_, err = c.Writer.WriteString(fmt.Sprintf("event: %s\ndata: %s\n\n", claudeResp.Type, v.Value.Bytes))
+		if err != nil {
+			logger.SysError("error writing stream response: " + err.Error())
+			break
+		}
+		c.Writer.Flush()
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	countAbortedUsage(c, &usage, responseText)
 	return nil, &usage
 }
+
+// countAbortedUsage counts the output of a stream the client aborted, the
+// request context is cancelled and the event stream ends early.
+func countAbortedUsage(c *gin.Context, usage *relaymodel.Usage, responseText string) {
+	if c.Request.Context().Err() == nil {
+		return
+	}
+	logger.Warn(c.Request.Context(), "client aborted the stream")
+	c.Set(ctxkey.ClientAborted, true)
+	anthropic.CountAbortedUsage(usage, responseText, c.GetString(ctxkey.RequestModel))
+}
@@ -11,4 +11,5 @@ func init() {
 	for i := 0; i < num; i++ {
 		ModelList = append(ModelList, ModelList[i]+"-internet")
 	}
+	ModelList = append(ModelList, RerankModelList...)
 }
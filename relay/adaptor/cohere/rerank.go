@@ -0,0 +1,48 @@
+package cohere
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://docs.cohere.com/v1/reference/rerank
+
+var RerankModelList = []string{
+	"rerank-v3.5",
+	"rerank-english-v3.0", "rerank-multilingual-v3.0",
+}
+
+type RerankResponse struct {
+	Id      string               `json:"id"`
+	Results []model.RerankResult `json:"results"`
+	Meta    Meta                 `json:"meta"`
+}
+
+// RerankHandler converts a Cohere rerank response. Cohere bills searches
+// rather than tokens, so the returned usage is empty.
+func RerankHandler(c *gin.Context, resp *http.Response, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var cohereResponse RerankResponse
+	err = json.Unmarshal(responseBody, &cohereResponse)
+	if err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.JSON(http.StatusOK, model.RerankResponse{
+		Id:      cohereResponse.Id,
+		Model:   modelName,
+		Results: cohereResponse.Results,
+	})
+	return nil, &model.Usage{}
+}
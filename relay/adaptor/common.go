@@ -1,13 +1,16 @@
 package adaptor
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"io"
 	"net/http"
+	"time"
 )
 
 func SetupCommonRequestHeader(c *gin.Context, req *http.Request, meta *meta.Meta) {
@@ -23,7 +26,7 @@ func DoRequestHelper(a Adaptor, c *gin.Context, meta *meta.Meta, requestBody io.
 	if err != nil {
 		return nil, fmt.Errorf("get request url failed: %w", err)
 	}
-	req, err := http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
+	req, err := http.NewRequestWithContext(upstreamContext(c), c.Request.Method, fullRequestURL, requestBody)
 	if err != nil {
 		return nil, fmt.Errorf("new request failed: %w", err)
 	}
@@ -38,7 +41,17 @@ func DoRequestHelper(a Adaptor, c *gin.Context, meta *meta.Meta, requestBody io.
 	return resp, nil
 }
 
+// upstreamContext returns the context of requests that may be abandoned
+// before they complete, e.g. the losing side of a hedged request.
+func upstreamContext(c *gin.Context) context.Context {
+	if ctx, ok := c.Value(ctxkey.UpstreamContext).(context.Context); ok {
+		return ctx
+	}
+	return context.Background()
+}
+
 func DoRequest(c *gin.Context, req *http.Request) (*http.Response, error) {
+	startTime := time.Now()
 	resp, err := client.HTTPClient.Do(req)
 	if err != nil {
 		return nil, err
@@ -46,6 +59,8 @@ func DoRequest(c *gin.Context, req *http.Request) (*http.Response, error) {
 	if resp == nil {
 		return nil, errors.New("resp is nil")
 	}
+	// the headers come with the first byte, also for streams
+	c.Set(ctxkey.FirstByteLatency, time.Since(startTime))
 	_ = req.Body.Close()
 	_ = c.Request.Body.Close()
 	return resp, nil
@@ -0,0 +1,44 @@
+package adaptor
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+)
+
+func TestDoRequestFirstByteLatency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	client.Init()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("data: {}\n\n"))
+		w.(http.Flusher).Flush()
+		// the rest of the stream does not count
+		time.Sleep(300 * time.Millisecond)
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer upstream.Close()
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	req, err := http.NewRequest(http.MethodPost, upstream.URL, http.NoBody)
+	require.NoError(t, err)
+	resp, err := DoRequest(c, req)
+	require.NoError(t, err)
+	latency := c.GetDuration(ctxkey.FirstByteLatency)
+	_, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.GreaterOrEqual(t, latency, 50*time.Millisecond)
+	assert.Less(t, latency, 300*time.Millisecond)
+}
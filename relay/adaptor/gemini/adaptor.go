@@ -17,6 +17,8 @@ import (
 	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
+var _ NativeAdaptor = new(Adaptor)
+
 type Adaptor struct {
 }
 
@@ -80,8 +82,10 @@ func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Read
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
 	if meta.IsStream {
 		var responseText string
-		err, responseText = StreamHandler(c, resp)
-		usage = openai.ResponseText2Usage(responseText, meta.ActualModelName, meta.PromptTokens)
+		err, responseText, usage = StreamHandler(c, resp)
+		if usage == nil {
+			usage = openai.ResponseText2Usage(responseText, meta.ActualModelName, meta.PromptTokens)
+		}
 	} else {
 		switch meta.Mode {
 		case relaymode.Embeddings:
@@ -93,6 +97,22 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Met
 	return
 }
 
+func (a *Adaptor) ConvertGeminiRequest(c *gin.Context, meta *meta.Meta, request *ChatRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	return ConvertNativeRequest(c, meta)
+}
+
+func (a *Adaptor) DoGeminiResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	if meta.IsStream {
+		err, usage = NativeStreamHandler(c, resp, meta)
+	} else {
+		err, usage = NativeHandler(c, resp, meta)
+	}
+	return
+}
+
 func (a *Adaptor) GetModelList() []string {
 	return ModelList
 }
@@ -185,8 +185,10 @@ func ConvertEmbeddingRequest(request model.GeneralOpenAIRequest) *BatchEmbedding
 }
 
 type ChatResponse struct {
-	Candidates     []ChatCandidate    `json:"candidates"`
-	PromptFeedback ChatPromptFeedback `json:"promptFeedback"`
+	Candidates     []ChatCandidate     `json:"candidates"`
+	PromptFeedback *ChatPromptFeedback `json:"promptFeedback,omitempty"`
+	UsageMetadata  *UsageMetadata      `json:"usageMetadata,omitempty"`
+	ModelVersion   string              `json:"modelVersion,omitempty"`
 }
 
 func (g *ChatResponse) GetResponseText() string {
@@ -201,9 +203,9 @@ func (g *ChatResponse) GetResponseText() string {
 
 type ChatCandidate struct {
 	Content       ChatContent        `json:"content"`
-	FinishReason  string             `json:"finishReason"`
+	FinishReason  string             `json:"finishReason,omitempty"`
 	Index         int64              `json:"index"`
-	SafetyRatings []ChatSafetyRating `json:"safetyRatings"`
+	SafetyRatings []ChatSafetyRating `json:"safetyRatings,omitempty"`
 }
 
 type ChatSafetyRating struct {
@@ -306,12 +308,16 @@ func embeddingResponseGemini2OpenAI(response *EmbeddingResponse) *openai.Embeddi
 	return &openAIEmbeddingResponse
 }
 
-func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, string) {
+// StreamHandler converts a Gemini stream into an OpenAI one. The usage is nil
+// if the upstream sent no usageMetadata.
+func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, string, *model.Usage) {
 	responseText := ""
+	var usage *model.Usage
 	scanner := bufio.NewScanner(resp.Body)
 	scanner.Split(bufio.ScanLines)
 
 	common.SetEventStreamHeaders(c)
+	stopWatching := common.WatchClientAbort(c, resp.Body)
 
 	for scanner.Scan() {
 		data := scanner.Text()
@@ -328,6 +334,11 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 			logger.SysError("error unmarshalling stream response: " + err.Error())
 			continue
 		}
+		if geminiResponse.UsageMetadata != nil {
+			// usageMetadata is cumulative, the last one covers the whole stream
+			usage = &model.Usage{}
+			usageGemini2OpenAI(usage, &geminiResponse)
+		}
 
 		response := streamResponseGeminiChat2OpenAI(&geminiResponse)
 		if response == nil {
@@ -341,19 +352,24 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 			logger.SysError(err.Error())
 		}
 	}
+	aborted := stopWatching()
 
-	if err := scanner.Err(); err != nil {
+	if err := scanner.Err(); err != nil && !aborted {
 		logger.SysError("error reading stream: " + err.Error())
 	}
 
-	render.Done(c)
+	if aborted {
+		logger.Warn(c.Request.Context(), "client aborted the stream")
+	} else {
+		render.Done(c)
+	}
 
 	err := resp.Body.Close()
 	if err != nil {
-		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), ""
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), "", nil
 	}
 
-	return nil, responseText
+	return nil, responseText, usage
 }
 
 func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
@@ -383,11 +399,17 @@ func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName st
 	}
 	fullTextResponse := responseGeminiChat2OpenAI(&geminiResponse)
 	fullTextResponse.Model = modelName
-	completionTokens := openai.CountTokenText(geminiResponse.GetResponseText(), modelName)
-	usage := model.Usage{
-		PromptTokens:     promptTokens,
-		CompletionTokens: completionTokens,
-		TotalTokens:      promptTokens + completionTokens,
+	var usage model.Usage
+	if geminiResponse.UsageMetadata != nil {
+		// the counts of the upstream include thoughts and cached content
+		usageGemini2OpenAI(&usage, &geminiResponse)
+	} else {
+		completionTokens := openai.CountTokenText(geminiResponse.GetResponseText(), modelName)
+		usage = model.Usage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		}
 	}
 	fullTextResponse.Usage = usage
 	jsonResponse, err := json.Marshal(fullTextResponse)
@@ -0,0 +1,82 @@
+package gemini
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func newGeminiResponse(body string) *http.Response {
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body))}
+}
+
+func TestHandlerUsage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	resp := newGeminiResponse(`{
+		"candidates": [{"content": {"role": "model", "parts": [{"text": "hello"}]}, "finishReason": "STOP"}],
+		"usageMetadata": {"promptTokenCount": 10, "candidatesTokenCount": 5, "totalTokenCount": 39, "cachedContentTokenCount": 4, "thoughtsTokenCount": 20}
+	}`)
+	err, usage := Handler(c, resp, 1, "gemini-2.5-pro")
+	require.Nil(t, err)
+	expected := model.Usage{
+		PromptTokens:            10,
+		CompletionTokens:        25,
+		TotalTokens:             35,
+		PromptTokensDetails:     &model.PromptTokensDetails{CachedTokens: 4},
+		CompletionTokensDetails: &model.CompletionTokensDetails{ReasoningTokens: 20},
+	}
+	assert.Equal(t, expected, *usage)
+
+	var response struct {
+		Usage model.Usage `json:"usage"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, expected, response.Usage)
+}
+
+func TestStreamHandlerUsage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("the last usageMetadata is used", func(t *testing.T) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		resp := newGeminiResponse(strings.Join([]string{
+			`data: {"candidates": [{"content": {"role": "model", "parts": [{"text": "hel"}]}}], "usageMetadata": {"promptTokenCount": 10, "candidatesTokenCount": 1, "thoughtsTokenCount": 20}}`,
+			`data: {"candidates": [{"content": {"role": "model", "parts": [{"text": "lo"}]}, "finishReason": "STOP"}], "usageMetadata": {"promptTokenCount": 10, "candidatesTokenCount": 2, "cachedContentTokenCount": 4, "thoughtsTokenCount": 20}}`,
+		}, "\n\n"))
+		err, responseText, usage := StreamHandler(c, resp)
+		require.Nil(t, err)
+		assert.Equal(t, "hello", responseText)
+		require.NotNil(t, usage)
+		assert.Equal(t, model.Usage{
+			PromptTokens:            10,
+			CompletionTokens:        22,
+			TotalTokens:             32,
+			PromptTokensDetails:     &model.PromptTokensDetails{CachedTokens: 4},
+			CompletionTokensDetails: &model.CompletionTokensDetails{ReasoningTokens: 20},
+		}, *usage)
+	})
+
+	t.Run("no usageMetadata", func(t *testing.T) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		resp := newGeminiResponse(`data: {"candidates": [{"content": {"role": "model", "parts": [{"text": "hello"}]}}]}`)
+		err, responseText, usage := StreamHandler(c, resp)
+		require.Nil(t, err)
+		assert.Equal(t, "hello", responseText)
+		assert.Nil(t, usage)
+	})
+}
@@ -1,5 +1,7 @@
 package gemini
 
+import "encoding/json"
+
 type ChatRequest struct {
 	Contents          []ChatContent        `json:"contents"`
 	SafetySettings    []ChatSafetySettings `json:"safety_settings,omitempty"`
@@ -8,6 +10,30 @@ type ChatRequest struct {
 	SystemInstruction *ChatContent         `json:"system_instruction,omitempty"`
 }
 
+// UnmarshalJSON also accepts the camelCase field names sent by the Gemini SDKs.
+func (r *ChatRequest) UnmarshalJSON(data []byte) error {
+	type chatRequest ChatRequest
+	aux := struct {
+		*chatRequest
+		SafetySettings    []ChatSafetySettings  `json:"safetySettings,omitempty"`
+		GenerationConfig  *ChatGenerationConfig `json:"generationConfig,omitempty"`
+		SystemInstruction *ChatContent          `json:"systemInstruction,omitempty"`
+	}{chatRequest: (*chatRequest)(r)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if aux.SafetySettings != nil {
+		r.SafetySettings = aux.SafetySettings
+	}
+	if aux.GenerationConfig != nil {
+		r.GenerationConfig = *aux.GenerationConfig
+	}
+	if aux.SystemInstruction != nil {
+		r.SystemInstruction = aux.SystemInstruction
+	}
+	return nil
+}
+
 type EmbeddingRequest struct {
 	Model                string      `json:"model"`
 	Content              ChatContent `json:"content"`
@@ -45,10 +71,16 @@ type FunctionCall struct {
 	Arguments    any    `json:"args"`
 }
 
+type FunctionResponse struct {
+	Name     string `json:"name"`
+	Response any    `json:"response"`
+}
+
 type Part struct {
-	Text         string        `json:"text,omitempty"`
-	InlineData   *InlineData   `json:"inlineData,omitempty"`
-	FunctionCall *FunctionCall `json:"functionCall,omitempty"`
+	Text             string            `json:"text,omitempty"`
+	InlineData       *InlineData       `json:"inlineData,omitempty"`
+	FunctionCall     *FunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *FunctionResponse `json:"functionResponse,omitempty"`
 }
 
 type ChatContent struct {
@@ -65,6 +97,36 @@ type ChatTools struct {
 	FunctionDeclarations any `json:"function_declarations,omitempty"`
 }
 
+// UnmarshalJSON also accepts the camelCase field name sent by the Gemini SDKs.
+func (t *ChatTools) UnmarshalJSON(data []byte) error {
+	var tools struct {
+		FunctionDeclarations      any `json:"function_declarations"`
+		FunctionDeclarationsCamel any `json:"functionDeclarations"`
+	}
+	if err := json.Unmarshal(data, &tools); err != nil {
+		return err
+	}
+	t.FunctionDeclarations = tools.FunctionDeclarations
+	if tools.FunctionDeclarationsCamel != nil {
+		t.FunctionDeclarations = tools.FunctionDeclarationsCamel
+	}
+	return nil
+}
+
+type FunctionDeclaration struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+}
+
+type UsageMetadata struct {
+	PromptTokenCount        int `json:"promptTokenCount"`
+	CandidatesTokenCount    int `json:"candidatesTokenCount"`
+	TotalTokenCount         int `json:"totalTokenCount"`
+	CachedContentTokenCount int `json:"cachedContentTokenCount,omitempty"`
+	ThoughtsTokenCount      int `json:"thoughtsTokenCount,omitempty"`
+}
+
 type ChatGenerationConfig struct {
 	ResponseMimeType string   `json:"responseMimeType,omitempty"`
 	ResponseSchema   any      `json:"responseSchema,omitempty"`
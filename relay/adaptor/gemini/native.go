@@ -0,0 +1,424 @@
+package gemini
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// NativeAdaptor is implemented by adaptors whose upstream speaks the Gemini
+// generateContent API, so that /v1beta/models/{model}:generateContent requests
+// can be relayed without being converted to the OpenAI format and back.
+type NativeAdaptor interface {
+	ConvertGeminiRequest(c *gin.Context, meta *meta.Meta, request *ChatRequest) (any, error)
+	DoGeminiResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode)
+}
+
+// ErrorStatus returns the google.rpc status the Gemini API reports along with
+// an HTTP status code.
+func ErrorStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusConflict:
+		return "ABORTED"
+	case http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case http.StatusNotImplemented:
+		return "UNIMPLEMENTED"
+	case http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	case http.StatusGatewayTimeout:
+		return "DEADLINE_EXCEEDED"
+	}
+	if statusCode/100 == 5 {
+		return "INTERNAL"
+	}
+	return "UNKNOWN"
+}
+
+// ErrorResponse is an error in the envelope of the Gemini API, which Gemini
+// SDKs expect from the native endpoints.
+func ErrorResponse(statusCode int, message string) gin.H {
+	return gin.H{
+		"error": gin.H{
+			"code":    statusCode,
+			"message": message,
+			"status":  ErrorStatus(statusCode),
+		},
+	}
+}
+
+// ParseModelAction splits the "{model}:{action}" path segment of the native API.
+func ParseModelAction(path string) (modelName string, action string) {
+	path = strings.TrimPrefix(path, "/")
+	if i := strings.LastIndex(path, ":"); i >= 0 {
+		return path[:i], path[i+1:]
+	}
+	return path, ""
+}
+
+// ConvertNativeRequest forwards the raw request body, only overriding the
+// system instruction when the channel forces one, so that fields unknown to
+// ChatRequest reach the upstream untouched.
+func ConvertNativeRequest(c *gin.Context, meta *meta.Meta) (any, error) {
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil, err
+	}
+	rawRequest := make(map[string]any)
+	err = json.Unmarshal(requestBody, &rawRequest)
+	if err != nil {
+		return nil, err
+	}
+	if meta.ForcedSystemPrompt != "" {
+		delete(rawRequest, "system_instruction")
+		rawRequest["systemInstruction"] = ChatContent{
+			Parts: []Part{{Text: meta.ForcedSystemPrompt}},
+		}
+	}
+	return rawRequest, nil
+}
+
+func finishReasonOpenAI2Gemini(reason string) string {
+	switch reason {
+	case "length":
+		return "MAX_TOKENS"
+	case "content_filter":
+		return "SAFETY"
+	default:
+		return "STOP"
+	}
+}
+
+// ConvertRequestToOpenAI converts an inbound generateContent request into the
+// OpenAI chat completions format, for channels that do not speak Gemini natively.
+func ConvertRequestToOpenAI(geminiRequest *ChatRequest, modelName string, isStream bool) *model.GeneralOpenAIRequest {
+	config := geminiRequest.GenerationConfig
+	openaiRequest := model.GeneralOpenAIRequest{
+		Model:       modelName,
+		Stream:      isStream,
+		MaxTokens:   config.MaxOutputTokens,
+		Temperature: config.Temperature,
+		TopP:        config.TopP,
+		TopK:        int(config.TopK),
+		N:           config.CandidateCount,
+	}
+	if len(config.StopSequences) > 0 {
+		openaiRequest.Stop = config.StopSequences
+	}
+	if config.ResponseMimeType == mimeTypeMap["json_object"] {
+		openaiRequest.ResponseFormat = &model.ResponseFormat{Type: "json_object"}
+	}
+	for _, tool := range geminiRequest.Tools {
+		var declarations []FunctionDeclaration
+		data, _ := json.Marshal(tool.FunctionDeclarations)
+		_ = json.Unmarshal(data, &declarations)
+		for _, declaration := range declarations {
+			openaiRequest.Tools = append(openaiRequest.Tools, model.Tool{
+				Type: "function",
+				Function: model.Function{
+					Name:        declaration.Name,
+					Description: declaration.Description,
+					Parameters:  declaration.Parameters,
+				},
+			})
+		}
+	}
+	if geminiRequest.SystemInstruction != nil {
+		var system string
+		for _, part := range geminiRequest.SystemInstruction.Parts {
+			system += part.Text
+		}
+		openaiRequest.Messages = append(openaiRequest.Messages, model.Message{
+			Role:    "system",
+			Content: system,
+		})
+	}
+	// gemini matches function responses to calls by name, openai by id
+	callIds := make(map[string]string)
+	callCount := 0
+	for _, content := range geminiRequest.Contents {
+		role := content.Role
+		if role == "model" {
+			role = "assistant"
+		} else if role == "" {
+			role = "user"
+		}
+		var contents []model.MessageContent
+		var toolCalls []model.Tool
+		for _, part := range content.Parts {
+			switch {
+			case part.FunctionCall != nil:
+				callCount++
+				id := fmt.Sprintf("call_%d", callCount)
+				callIds[part.FunctionCall.FunctionName] = id
+				args, _ := json.Marshal(part.FunctionCall.Arguments)
+				toolCalls = append(toolCalls, model.Tool{
+					Id:   id,
+					Type: "function",
+					Function: model.Function{
+						Name:      part.FunctionCall.FunctionName,
+						Arguments: string(args),
+					},
+				})
+			case part.FunctionResponse != nil:
+				response, _ := json.Marshal(part.FunctionResponse.Response)
+				openaiRequest.Messages = append(openaiRequest.Messages, model.Message{
+					Role:       "tool",
+					Content:    string(response),
+					ToolCallId: callIds[part.FunctionResponse.Name],
+				})
+			case part.InlineData != nil:
+				contents = append(contents, model.MessageContent{
+					Type: model.ContentTypeImageURL,
+					ImageURL: &model.ImageURL{
+						Url: fmt.Sprintf("data:%s;base64,%s", part.InlineData.MimeType, part.InlineData.Data),
+					},
+				})
+			case part.Text != "":
+				contents = append(contents, model.MessageContent{
+					Type: model.ContentTypeText,
+					Text: part.Text,
+				})
+			}
+		}
+		if len(contents) == 0 && len(toolCalls) == 0 {
+			continue
+		}
+		message := model.Message{
+			Role:      role,
+			ToolCalls: toolCalls,
+		}
+		if len(contents) == 1 && contents[0].Type == model.ContentTypeText {
+			message.Content = contents[0].Text
+		} else if len(contents) > 0 {
+			message.Content = contents
+		}
+		openaiRequest.Messages = append(openaiRequest.Messages, message)
+	}
+	return &openaiRequest
+}
+
+// ResponseOpenAI2Gemini converts a chat completion into a generateContent response.
+func ResponseOpenAI2Gemini(textResponse *openai.TextResponse) *ChatResponse {
+	geminiResponse := ChatResponse{
+		Candidates:   make([]ChatCandidate, 0, len(textResponse.Choices)),
+		ModelVersion: textResponse.Model,
+		UsageMetadata: &UsageMetadata{
+			PromptTokenCount:     textResponse.PromptTokens,
+			CandidatesTokenCount: textResponse.CompletionTokens,
+			TotalTokenCount:      textResponse.PromptTokens + textResponse.CompletionTokens,
+		},
+	}
+	if details := textResponse.CompletionTokensDetails; details != nil && details.ReasoningTokens > 0 {
+		geminiResponse.UsageMetadata.CandidatesTokenCount -= details.ReasoningTokens
+		geminiResponse.UsageMetadata.ThoughtsTokenCount = details.ReasoningTokens
+	}
+	for _, choice := range textResponse.Choices {
+		candidate := ChatCandidate{
+			Content: ChatContent{
+				Role:  "model",
+				Parts: make([]Part, 0),
+			},
+			FinishReason: finishReasonOpenAI2Gemini(choice.FinishReason),
+			Index:        int64(choice.Index),
+		}
+		if text := choice.Message.StringContent(); text != "" {
+			candidate.Content.Parts = append(candidate.Content.Parts, Part{Text: text})
+		}
+		for _, toolCall := range choice.Message.ToolCalls {
+			candidate.Content.Parts = append(candidate.Content.Parts, Part{
+				FunctionCall: toolCallOpenAI2Gemini(toolCall),
+			})
+		}
+		geminiResponse.Candidates = append(geminiResponse.Candidates, candidate)
+	}
+	return &geminiResponse
+}
+
+func toolCallOpenAI2Gemini(toolCall model.Tool) *FunctionCall {
+	args := make(map[string]any)
+	if arguments, ok := toolCall.Function.Arguments.(string); ok {
+		_ = json.Unmarshal([]byte(arguments), &args)
+	}
+	return &FunctionCall{
+		FunctionName: toolCall.Function.Name,
+		Arguments:    args,
+	}
+}
+
+func usageGemini2OpenAI(usage *model.Usage, geminiResponse *ChatResponse) {
+	if geminiResponse.UsageMetadata == nil {
+		return
+	}
+	usage.PromptTokens = geminiResponse.UsageMetadata.PromptTokenCount
+	// thoughts are billed as output but not counted in the candidates
+	usage.CompletionTokens = geminiResponse.UsageMetadata.CandidatesTokenCount + geminiResponse.UsageMetadata.ThoughtsTokenCount
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	if thoughtsTokens := geminiResponse.UsageMetadata.ThoughtsTokenCount; thoughtsTokens > 0 {
+		usage.CompletionTokensDetails = &model.CompletionTokensDetails{ReasoningTokens: thoughtsTokens}
+	}
+	if cachedTokens := geminiResponse.UsageMetadata.CachedContentTokenCount; cachedTokens > 0 {
+		usage.PromptTokensDetails = &model.PromptTokensDetails{CachedTokens: cachedTokens}
+	}
+}
+
+// NativeStreamHandler relays a streamGenerateContent server-sent event stream
+// to the client as-is, collecting usage from usageMetadata.
+func NativeStreamHandler(c *gin.Context, resp *http.Response, meta *meta.Meta) (*model.ErrorWithStatusCode, *model.Usage) {
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	scanner.Split(bufio.ScanLines)
+
+	encoder := NewStreamEncoder(c.Writer, c.Query("alt") == "sse")
+	stopWatching := common.WatchClientAbort(c, resp.Body)
+	var usage model.Usage
+	responseText := ""
+	for scanner.Scan() {
+		data := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(data, "data:") {
+			continue
+		}
+		data = strings.TrimSpace(strings.TrimPrefix(data, "data:"))
+		var geminiResponse ChatResponse
+		err := json.Unmarshal([]byte(data), &geminiResponse)
+		if err != nil {
+			logger.SysError("error unmarshalling stream response: " + err.Error())
+			continue
+		}
+		responseText += geminiResponse.GetResponseText()
+		usageGemini2OpenAI(&usage, &geminiResponse)
+		encoder.Encode([]byte(data))
+	}
+	aborted := stopWatching()
+	encoder.Close()
+
+	if err := scanner.Err(); err != nil && !aborted {
+		logger.SysError("error reading stream: " + err.Error())
+	}
+	if aborted {
+		// usageMetadata is cumulative, the last one seen covers what was delivered
+		logger.Warn(c.Request.Context(), "client aborted the stream")
+	}
+
+	err := resp.Body.Close()
+	if err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if usage.TotalTokens == 0 {
+		return nil, openai.ResponseText2Usage(responseText, meta.ActualModelName, meta.PromptTokens)
+	}
+	return nil, &usage
+}
+
+// NativeHandler relays a generateContent response to the client as-is.
+func NativeHandler(c *gin.Context, resp *http.Response, meta *meta.Meta) (*model.ErrorWithStatusCode, *model.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var geminiResponse ChatResponse
+	err = json.Unmarshal(responseBody, &geminiResponse)
+	if err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(responseBody)
+	if err != nil {
+		return openai.ErrorWrapper(err, "write_response_body_failed", http.StatusInternalServerError), nil
+	}
+	usage := model.Usage{}
+	usageGemini2OpenAI(&usage, &geminiResponse)
+	if usage.TotalTokens == 0 {
+		completionTokens := openai.CountTokenText(geminiResponse.GetResponseText(), meta.ActualModelName)
+		usage = model.Usage{
+			PromptTokens:     meta.PromptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      meta.PromptTokens + completionTokens,
+		}
+	}
+	return nil, &usage
+}
+
+// StreamEncoder writes streamGenerateContent chunks in the framing the client
+// asked for: server-sent events with alt=sse, a streamed JSON array otherwise.
+type StreamEncoder struct {
+	w       gin.ResponseWriter
+	sse     bool
+	started bool
+	count   int
+}
+
+func NewStreamEncoder(w gin.ResponseWriter, sse bool) *StreamEncoder {
+	return &StreamEncoder{w: w, sse: sse}
+}
+
+// start sets the headers right before the first write, overriding whatever
+// an adaptor may have set in the meantime.
+func (e *StreamEncoder) start() {
+	if e.started {
+		return
+	}
+	e.started = true
+	if e.sse {
+		e.w.Header().Set("Content-Type", "text/event-stream")
+		e.w.Header().Set("Cache-Control", "no-cache")
+		e.w.Header().Set("X-Accel-Buffering", "no")
+	} else {
+		e.w.Header().Set("Content-Type", "application/json")
+	}
+}
+
+func (e *StreamEncoder) Encode(data []byte) {
+	e.start()
+	var err error
+	if e.sse {
+		_, err = e.w.WriteString(fmt.Sprintf("data: %s\r\n\r\n", data))
+	} else {
+		prefix := ",\r\n"
+		if e.count == 0 {
+			prefix = "["
+		}
+		_, err = e.w.WriteString(prefix + string(data))
+	}
+	if err != nil {
+		logger.SysError("error writing stream response: " + err.Error())
+		return
+	}
+	e.count++
+	e.w.Flush()
+}
+
+func (e *StreamEncoder) Close() {
+	e.start()
+	if e.sse {
+		return
+	}
+	if e.count == 0 {
+		_, _ = e.w.WriteString("[")
+	}
+	_, _ = e.w.WriteString("]")
+	e.w.Flush()
+}
@@ -0,0 +1,142 @@
+package gemini
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestParseModelAction(t *testing.T) {
+	modelName, action := ParseModelAction("/gemini-2.0-flash:streamGenerateContent")
+	assert.Equal(t, "gemini-2.0-flash", modelName)
+	assert.Equal(t, "streamGenerateContent", action)
+
+	modelName, action = ParseModelAction("tunedModels/my-model:generateContent")
+	assert.Equal(t, "tunedModels/my-model", modelName)
+	assert.Equal(t, "generateContent", action)
+}
+
+func TestConvertNativeRequestToOpenAI(t *testing.T) {
+	var geminiRequest ChatRequest
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"systemInstruction": {"parts": [{"text": "be brief"}]},
+		"generationConfig": {"maxOutputTokens": 256, "temperature": 0.5, "stopSequences": ["END"], "responseMimeType": "application/json"},
+		"tools": [{"functionDeclarations": [{"name": "get_weather", "description": "weather of a city", "parameters": {"type": "object"}}]}],
+		"contents": [
+			{"role": "user", "parts": [{"text": "weather in Paris?"}]},
+			{"role": "model", "parts": [{"functionCall": {"name": "get_weather", "args": {"city": "Paris"}}}]},
+			{"role": "user", "parts": [{"functionResponse": {"name": "get_weather", "response": {"weather": "sunny"}}}]},
+			{"parts": [{"text": "and this?"}, {"inlineData": {"mimeType": "image/png", "data": "aGk="}}]}
+		]
+	}`), &geminiRequest))
+
+	openaiRequest := ConvertRequestToOpenAI(&geminiRequest, "gemini-2.0-flash", true)
+	assert.Equal(t, "gemini-2.0-flash", openaiRequest.Model)
+	assert.True(t, openaiRequest.Stream)
+	assert.Equal(t, 256, openaiRequest.MaxTokens)
+	require.NotNil(t, openaiRequest.Temperature)
+	assert.Equal(t, 0.5, *openaiRequest.Temperature)
+	assert.Equal(t, []string{"END"}, openaiRequest.Stop)
+	require.NotNil(t, openaiRequest.ResponseFormat)
+	assert.Equal(t, "json_object", openaiRequest.ResponseFormat.Type)
+	require.Len(t, openaiRequest.Tools, 1)
+	assert.Equal(t, "get_weather", openaiRequest.Tools[0].Function.Name)
+
+	require.Len(t, openaiRequest.Messages, 5)
+	assert.Equal(t, "system", openaiRequest.Messages[0].Role)
+	assert.Equal(t, "be brief", openaiRequest.Messages[0].StringContent())
+	assert.Equal(t, "user", openaiRequest.Messages[1].Role)
+
+	call := openaiRequest.Messages[2]
+	assert.Equal(t, "assistant", call.Role)
+	require.Len(t, call.ToolCalls, 1)
+	assert.JSONEq(t, `{"city":"Paris"}`, call.ToolCalls[0].Function.Arguments.(string))
+
+	// function responses are matched to their call by name
+	response := openaiRequest.Messages[3]
+	assert.Equal(t, "tool", response.Role)
+	assert.Equal(t, call.ToolCalls[0].Id, response.ToolCallId)
+	assert.JSONEq(t, `{"weather":"sunny"}`, response.StringContent())
+
+	image := openaiRequest.Messages[4]
+	assert.Equal(t, "user", image.Role)
+	contents, ok := image.Content.([]model.MessageContent)
+	require.True(t, ok)
+	require.Len(t, contents, 2)
+	assert.Equal(t, "data:image/png;base64,aGk=", contents[1].ImageURL.Url)
+}
+
+func TestResponseOpenAI2Gemini(t *testing.T) {
+	var textResponse openai.TextResponse
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"id": "chatcmpl-1",
+		"model": "gpt-4o",
+		"choices": [{"index": 0, "finish_reason": "length", "message": {"role": "assistant", "content": "checking",
+			"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}]}}],
+		"usage": {"prompt_tokens": 10, "completion_tokens": 30, "total_tokens": 40, "completion_tokens_details": {"reasoning_tokens": 20}}
+	}`), &textResponse))
+
+	geminiResponse := ResponseOpenAI2Gemini(&textResponse)
+	require.Len(t, geminiResponse.Candidates, 1)
+	candidate := geminiResponse.Candidates[0]
+	assert.Equal(t, "model", candidate.Content.Role)
+	assert.Equal(t, "MAX_TOKENS", candidate.FinishReason)
+	require.Len(t, candidate.Content.Parts, 2)
+	assert.Equal(t, "checking", candidate.Content.Parts[0].Text)
+	assert.Equal(t, "get_weather", candidate.Content.Parts[1].FunctionCall.FunctionName)
+	assert.Equal(t, map[string]any{"city": "Paris"}, candidate.Content.Parts[1].FunctionCall.Arguments)
+	// Gemini counts the thoughts apart from the candidates
+	assert.Equal(t, &UsageMetadata{PromptTokenCount: 10, CandidatesTokenCount: 10, ThoughtsTokenCount: 20, TotalTokenCount: 40}, geminiResponse.UsageMetadata)
+
+	var usage model.Usage
+	usageGemini2OpenAI(&usage, geminiResponse)
+	assert.Equal(t, 30, usage.CompletionTokens)
+	assert.Equal(t, 20, usage.CompletionTokensDetails.ReasoningTokens)
+}
+
+func TestNativeStreamHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stream := "data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\"Hel\"}]}}],\"usageMetadata\":{\"promptTokenCount\":10,\"candidatesTokenCount\":1,\"totalTokenCount\":11}}\r\n\r\n" +
+		"data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\"lo\"}]},\"finishReason\":\"STOP\"}],\"usageMetadata\":{\"promptTokenCount\":10,\"candidatesTokenCount\":2,\"totalTokenCount\":12}}\r\n\r\n"
+	testMeta := &meta.Meta{ActualModelName: "gemini-2.0-flash"}
+
+	t.Run("a JSON array without alt=sse", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1beta/models/gemini-2.0-flash:streamGenerateContent", nil)
+		err, usage := NativeStreamHandler(c, newGeminiResponse(stream), testMeta)
+		require.Nil(t, err)
+		assert.Equal(t, &model.Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12}, usage)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		var chunks []ChatResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &chunks))
+		require.Len(t, chunks, 2)
+		assert.Equal(t, "lo", chunks[1].GetResponseText())
+	})
+
+	t.Run("server-sent events with alt=sse", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1beta/models/gemini-2.0-flash:streamGenerateContent?alt=sse", nil)
+		err, _ := NativeStreamHandler(c, newGeminiResponse(stream), testMeta)
+		require.Nil(t, err)
+		assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+		assert.Equal(t, stream, w.Body.String())
+	})
+}
+
+func TestErrorResponse(t *testing.T) {
+	body := ErrorResponse(http.StatusTooManyRequests, "slow down")
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"error":{"code":429,"message":"slow down","status":"RESOURCE_EXHAUSTED"}}`, string(data))
+}
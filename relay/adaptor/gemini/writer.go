@@ -0,0 +1,205 @@
+package gemini
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/conv"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// ResponseWriter translates the OpenAI chat completion output written by any
+// adaptor into the generateContent format, so that the native Gemini API can be
+// served by channels that do not speak Gemini.
+type ResponseWriter struct {
+	gin.ResponseWriter
+
+	isStream   bool
+	modelName  string
+	statusCode int
+	buffer     bytes.Buffer
+
+	// stream state
+	encoder      *StreamEncoder
+	toolCalls    []model.Tool
+	finishReason string
+	usage        *model.Usage
+}
+
+func NewResponseWriter(w gin.ResponseWriter, isStream bool, sse bool, modelName string) *ResponseWriter {
+	writer := &ResponseWriter{
+		ResponseWriter: w,
+		isStream:       isStream,
+		modelName:      modelName,
+		statusCode:     http.StatusOK,
+	}
+	if isStream {
+		writer.encoder = NewStreamEncoder(w, sse)
+	}
+	return writer
+}
+
+func (w *ResponseWriter) WriteHeader(statusCode int) {
+	// c.Render passes -1 for streamed events
+	if statusCode > 0 {
+		w.statusCode = statusCode
+	}
+}
+
+func (w *ResponseWriter) WriteHeaderNow() {}
+
+func (w *ResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *ResponseWriter) Write(data []byte) (int, error) {
+	w.buffer.Write(data)
+	if !w.isStream {
+		return len(data), nil
+	}
+	for {
+		line, err := w.buffer.ReadString('\n')
+		if err != nil {
+			// keep the incomplete line for the next write
+			w.buffer.Reset()
+			w.buffer.WriteString(line)
+			break
+		}
+		w.handleStreamLine(strings.TrimSpace(line))
+	}
+	return len(data), nil
+}
+
+func (w *ResponseWriter) Flush() {
+	if w.isStream {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *ResponseWriter) handleStreamLine(line string) {
+	if !strings.HasPrefix(line, "data:") {
+		return
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	if data == "[DONE]" {
+		return
+	}
+	var streamResponse openai.ChatCompletionsStreamResponse
+	err := json.Unmarshal([]byte(data), &streamResponse)
+	if err != nil {
+		logger.SysError("error unmarshalling stream response: " + err.Error())
+		return
+	}
+	if streamResponse.Usage != nil {
+		w.usage = streamResponse.Usage
+	}
+	for _, choice := range streamResponse.Choices {
+		// tool call arguments arrive in fragments, so calls are sent once complete
+		for _, toolCall := range choice.Delta.ToolCalls {
+			if toolCall.Id != "" || len(w.toolCalls) == 0 {
+				toolCall.Function.Arguments = conv.AsString(toolCall.Function.Arguments)
+				w.toolCalls = append(w.toolCalls, toolCall)
+				continue
+			}
+			last := &w.toolCalls[len(w.toolCalls)-1].Function
+			last.Arguments = conv.AsString(last.Arguments) + conv.AsString(toolCall.Function.Arguments)
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			w.finishReason = *choice.FinishReason
+		}
+		if text := conv.AsString(choice.Delta.Content); text != "" {
+			w.writeChunk(&ChatResponse{
+				Candidates: []ChatCandidate{{
+					Content: ChatContent{
+						Role:  "model",
+						Parts: []Part{{Text: text}},
+					},
+					Index: int64(choice.Index),
+				}},
+				ModelVersion: w.modelName,
+			})
+		}
+	}
+}
+
+func (w *ResponseWriter) writeChunk(geminiResponse *ChatResponse) {
+	jsonData, err := json.Marshal(geminiResponse)
+	if err != nil {
+		logger.SysError("error marshalling stream response: " + err.Error())
+		return
+	}
+	w.encoder.Encode(jsonData)
+}
+
+// Finish completes the translated response once the adaptor has returned.
+// usage is the final usage computed by the relay, which takes precedence over
+// the usage seen in the stream.
+func (w *ResponseWriter) Finish(usage *model.Usage) {
+	if usage == nil {
+		usage = w.usage
+	}
+	if w.isStream {
+		w.finishStream(usage)
+		return
+	}
+	w.ResponseWriter.Header().Del("Content-Length")
+	w.ResponseWriter.Header().Set("Content-Type", "application/json")
+	if w.statusCode != http.StatusOK {
+		w.ResponseWriter.WriteHeader(w.statusCode)
+		_, _ = w.ResponseWriter.Write(w.buffer.Bytes())
+		return
+	}
+	var textResponse openai.TextResponse
+	err := json.Unmarshal(w.buffer.Bytes(), &textResponse)
+	if err != nil {
+		logger.SysError("error unmarshalling response: " + err.Error())
+		w.ResponseWriter.WriteHeader(w.statusCode)
+		_, _ = w.ResponseWriter.Write(w.buffer.Bytes())
+		return
+	}
+	if usage != nil {
+		textResponse.Usage = *usage
+	}
+	geminiResponse := ResponseOpenAI2Gemini(&textResponse)
+	geminiResponse.ModelVersion = w.modelName
+	jsonResponse, err := json.Marshal(geminiResponse)
+	if err != nil {
+		logger.SysError("error marshalling response: " + err.Error())
+		return
+	}
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	_, _ = w.ResponseWriter.Write(jsonResponse)
+}
+
+func (w *ResponseWriter) finishStream(usage *model.Usage) {
+	candidate := ChatCandidate{
+		Content: ChatContent{
+			Role:  "model",
+			Parts: make([]Part, 0, len(w.toolCalls)),
+		},
+		FinishReason: finishReasonOpenAI2Gemini(w.finishReason),
+	}
+	for _, toolCall := range w.toolCalls {
+		candidate.Content.Parts = append(candidate.Content.Parts, Part{
+			FunctionCall: toolCallOpenAI2Gemini(toolCall),
+		})
+	}
+	geminiResponse := &ChatResponse{
+		Candidates:   []ChatCandidate{candidate},
+		ModelVersion: w.modelName,
+	}
+	if usage != nil {
+		geminiResponse.UsageMetadata = &UsageMetadata{
+			PromptTokenCount:     usage.PromptTokens,
+			CandidatesTokenCount: usage.CompletionTokens,
+			TotalTokenCount:      usage.PromptTokens + usage.CompletionTokens,
+		}
+	}
+	w.writeChunk(geminiResponse)
+	w.encoder.Close()
+}
@@ -19,3 +19,9 @@ type Adaptor interface {
 	GetModelList() []string
 	GetChannelName() string
 }
+
+// RerankAdaptor is implemented by adaptors whose upstream serves the rerank
+// API. DoResponse handles the response when meta.Mode is relaymode.Rerank.
+type RerankAdaptor interface {
+	ConvertRerankRequest(c *gin.Context, request *model.RerankRequest) (any, error)
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/songquanpeng/one-api/relay/adaptor/geminiv2"
 	"github.com/songquanpeng/one-api/relay/adaptor/minimax"
 	"github.com/songquanpeng/one-api/relay/adaptor/novita"
+	"github.com/songquanpeng/one-api/relay/adaptor/siliconflow"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
@@ -39,6 +40,22 @@ func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 			fullRequestURL := fmt.Sprintf("%s/openai/deployments/%s/images/generations?api-version=%s", meta.BaseURL, meta.ActualModelName, meta.Config.APIVersion)
 			return fullRequestURL, nil
 		}
+		if meta.Mode == relaymode.Files || meta.Mode == relaymode.Batches {
+			// {your endpoint}/openai/files?api-version={api_version}
+			requestURL := "/openai" + strings.TrimPrefix(meta.RequestURLPath, "/v1")
+			separator := "?"
+			if strings.Contains(requestURL, "?") {
+				separator = "&"
+			}
+			requestURL = fmt.Sprintf("%s%sapi-version=%s", requestURL, separator, meta.Config.APIVersion)
+			return GetFullRequestURL(meta.BaseURL, requestURL, meta.ChannelType), nil
+		}
+		if meta.Mode == relaymode.Responses {
+			// https://learn.microsoft.com/en-us/azure/ai-services/openai/how-to/responses
+			// {your endpoint}/openai/responses?api-version={api_version}
+			requestURL := fmt.Sprintf("/openai/responses?api-version=%s", meta.Config.APIVersion)
+			return GetFullRequestURL(meta.BaseURL, requestURL, meta.ChannelType), nil
+		}
 
 		// https://learn.microsoft.com/en-us/azure/cognitive-services/openai/chatgpt-quickstart?pivots=rest-api&tabs=command-line#rest-api
 		requestURL := strings.Split(meta.RequestURLPath, "?")[0]
@@ -62,6 +79,11 @@ func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 		return alibailian.GetRequestURL(meta)
 	case channeltype.GeminiOpenAICompatible:
 		return geminiv2.GetRequestURL(meta)
+	case channeltype.SiliconFlow:
+		if meta.Mode == relaymode.ImagesEdits || meta.Mode == relaymode.ImagesVariations {
+			return siliconflow.GetImageEditRequestURL(meta)
+		}
+		return GetFullRequestURL(meta.BaseURL, meta.RequestURLPath, meta.ChannelType), nil
 	default:
 		return GetFullRequestURL(meta.BaseURL, meta.RequestURLPath, meta.ChannelType), nil
 	}
@@ -99,6 +121,9 @@ func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error)
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
+	if request.Image != nil && a.ChannelType == channeltype.SiliconFlow {
+		return siliconflow.ConvertImageEditRequest(request)
+	}
 	return request, nil
 }
 
@@ -107,6 +132,18 @@ func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Read
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	if meta.Mode == relaymode.Rerank {
+		err, usage = RerankHandler(c, resp, meta.ChannelType, meta.ActualModelName)
+		return
+	}
+	if meta.Mode == relaymode.Responses {
+		if meta.IsStream {
+			err, usage = ResponsesStreamHandler(c, resp, meta.PromptTokens, meta.ActualModelName)
+		} else {
+			err, usage = ResponsesHandler(c, resp, meta.PromptTokens, meta.ActualModelName)
+		}
+		return
+	}
 	if meta.IsStream {
 		var responseText string
 		err, responseText, usage = StreamHandler(c, resp, meta.Mode)
@@ -119,7 +156,7 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Met
 		}
 	} else {
 		switch meta.Mode {
-		case relaymode.ImagesGenerations:
+		case relaymode.ImagesGenerations, relaymode.ImagesEdits, relaymode.ImagesVariations:
 			err, _ = ImageHandler(c, resp)
 		default:
 			err, usage = Handler(c, resp, meta.PromptTokens, meta.ActualModelName)
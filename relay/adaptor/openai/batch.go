@@ -0,0 +1,51 @@
+package openai
+
+// https://platform.openai.com/docs/api-reference/batch
+
+type Batch struct {
+	Id           string `json:"id"`
+	Object       string `json:"object"`
+	Endpoint     string `json:"endpoint"`
+	InputFileId  string `json:"input_file_id"`
+	Status       string `json:"status"`
+	OutputFileId string `json:"output_file_id,omitempty"`
+	ErrorFileId  string `json:"error_file_id,omitempty"`
+}
+
+// IsFinished reports whether the batch has reached a terminal status, after
+// which its results no longer change.
+func (b *Batch) IsFinished() bool {
+	switch b.Status {
+	case "completed", "failed", "expired", "cancelled":
+		return true
+	}
+	return false
+}
+
+// BatchOutput is one line of a batch output file.
+type BatchOutput struct {
+	Id       string `json:"id"`
+	CustomId string `json:"custom_id"`
+	Response *struct {
+		StatusCode int `json:"status_code"`
+		Body       struct {
+			Model string `json:"model"`
+			Usage struct {
+				PromptTokens     int `json:"prompt_tokens"`
+				CompletionTokens int `json:"completion_tokens"`
+				// the Responses API reports input and output tokens instead
+				InputTokens  int `json:"input_tokens"`
+				OutputTokens int `json:"output_tokens"`
+			} `json:"usage"`
+		} `json:"body"`
+	} `json:"response"`
+}
+
+// ObjectList is the envelope of the list endpoints of the Files and Batch APIs.
+type ObjectList struct {
+	Object  string           `json:"object"`
+	Data    []map[string]any `json:"data"`
+	FirstId string           `json:"first_id,omitempty"`
+	LastId  string           `json:"last_id,omitempty"`
+	HasMore bool             `json:"has_more"`
+}
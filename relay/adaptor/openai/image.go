@@ -40,5 +40,12 @@ func ImageHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCo
 	if err != nil {
 		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
 	}
-	return nil, nil
+	if imageResponse.Usage == nil {
+		return nil, nil
+	}
+	return nil, &model.Usage{
+		PromptTokens:     imageResponse.Usage.InputTokens,
+		CompletionTokens: imageResponse.Usage.OutputTokens,
+		TotalTokens:      imageResponse.Usage.TotalTokens,
+	}
 }
@@ -31,6 +31,7 @@ func StreamHandler(c *gin.Context, resp *http.Response, relayMode int) (*model.E
 	var usage *model.Usage
 
 	common.SetEventStreamHeaders(c)
+	stopWatching := common.WatchClientAbort(c, resp.Body)
 
 	doneRendered := false
 	for scanner.Scan() {
@@ -79,12 +80,16 @@ func StreamHandler(c *gin.Context, resp *http.Response, relayMode int) (*model.E
 			}
 		}
 	}
+	aborted := stopWatching()
 
-	if err := scanner.Err(); err != nil {
+	if err := scanner.Err(); err != nil && !aborted {
 		logger.SysError("error reading stream: " + err.Error())
 	}
 
-	if !doneRendered {
+	if aborted {
+		// the usage chunk comes last, the usage is counted from what was delivered
+		logger.Warn(c.Request.Context(), "client aborted the stream")
+	} else if !doneRendered {
 		render.Done(c)
 	}
 
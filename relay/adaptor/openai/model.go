@@ -119,7 +119,14 @@ type ImageData struct {
 type ImageResponse struct {
 	Created int64       `json:"created"`
 	Data    []ImageData `json:"data"`
-	//model.Usage `json:"usage"`
+	Usage   *ImageUsage `json:"usage,omitempty"`
+}
+
+// ImageUsage is the token usage reported by gpt-image models.
+type ImageUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
 }
 
 type ChatCompletionsStreamResponseChoice struct {
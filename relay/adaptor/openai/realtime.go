@@ -0,0 +1,68 @@
+package openai
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://platform.openai.com/docs/api-reference/realtime
+
+type RealtimeUsage struct {
+	TotalTokens       int `json:"total_tokens"`
+	InputTokens       int `json:"input_tokens"`
+	OutputTokens      int `json:"output_tokens"`
+	InputTokenDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+		TextTokens   int `json:"text_tokens"`
+		AudioTokens  int `json:"audio_tokens"`
+	} `json:"input_token_details"`
+	OutputTokenDetails struct {
+		TextTokens  int `json:"text_tokens"`
+		AudioTokens int `json:"audio_tokens"`
+	} `json:"output_token_details"`
+}
+
+func (u *RealtimeUsage) ToUsage() *model.Usage {
+	usage := &model.Usage{
+		PromptTokens:     u.InputTokens,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      u.InputTokens + u.OutputTokens,
+	}
+	if u.InputTokenDetails.CachedTokens > 0 || u.InputTokenDetails.AudioTokens > 0 {
+		usage.PromptTokensDetails = &model.PromptTokensDetails{
+			CachedTokens: u.InputTokenDetails.CachedTokens,
+			AudioTokens:  u.InputTokenDetails.AudioTokens,
+		}
+	}
+	if u.OutputTokenDetails.AudioTokens > 0 {
+		usage.CompletionTokensDetails = &model.CompletionTokensDetails{
+			AudioTokens: u.OutputTokenDetails.AudioTokens,
+		}
+	}
+	return usage
+}
+
+// RealtimeEvent holds the fields of a server event the relay cares about.
+type RealtimeEvent struct {
+	Type     string `json:"type"`
+	Response *struct {
+		Usage *RealtimeUsage `json:"usage"`
+	} `json:"response,omitempty"`
+}
+
+// GetRealtimeURL returns the WebSocket URL of the upstream realtime session.
+func GetRealtimeURL(meta *meta.Meta) string {
+	baseURL := meta.BaseURL
+	baseURL = strings.Replace(baseURL, "https://", "wss://", 1)
+	baseURL = strings.Replace(baseURL, "http://", "ws://", 1)
+	if meta.ChannelType == channeltype.Azure {
+		// wss://{resource}.openai.azure.com/openai/realtime?api-version={api_version}&deployment={deployment}
+		return fmt.Sprintf("%s/openai/realtime?api-version=%s&deployment=%s", baseURL, meta.Config.APIVersion, url.QueryEscape(meta.ActualModelName))
+	}
+	return GetFullRequestURL(baseURL, "/v1/realtime?model="+url.QueryEscape(meta.ActualModelName), meta.ChannelType)
+}
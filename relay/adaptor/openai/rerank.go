@@ -0,0 +1,62 @@
+package openai
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/relay/adaptor/siliconflow"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func (a *Adaptor) ConvertRerankRequest(c *gin.Context, request *model.RerankRequest) (any, error) {
+	return request, nil
+}
+
+// RerankHandler relays the rerank response of a Jina-compatible upstream
+// as-is; SiliconFlow responses are converted to the common format.
+func RerankHandler(c *gin.Context, resp *http.Response, channelType int, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if channelType == channeltype.SiliconFlow {
+		var siliconflowResponse siliconflow.RerankResponse
+		err = json.Unmarshal(responseBody, &siliconflowResponse)
+		if err != nil {
+			return ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+		}
+		usage := &model.Usage{
+			PromptTokens: siliconflowResponse.Tokens.InputTokens,
+			TotalTokens:  siliconflowResponse.Tokens.InputTokens,
+		}
+		c.JSON(http.StatusOK, model.RerankResponse{
+			Id:      siliconflowResponse.Id,
+			Model:   modelName,
+			Results: siliconflowResponse.Results,
+			Usage:   usage,
+		})
+		return nil, usage
+	}
+	var rerankResponse model.RerankResponse
+	err = json.Unmarshal(responseBody, &rerankResponse)
+	if err != nil {
+		return ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(responseBody)
+	if err != nil {
+		return ErrorWrapper(err, "write_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if rerankResponse.Usage == nil {
+		return nil, &model.Usage{}
+	}
+	return nil, rerankResponse.Usage
+}
@@ -0,0 +1,60 @@
+package openai
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func newRerankResponse(body string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestRerankHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("Jina usage is passed through", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		body := `{"model":"jina-reranker-m0","results":[{"index":1,"relevance_score":0.9}],"usage":{"prompt_tokens":0,"total_tokens":42}}`
+		err, usage := RerankHandler(c, newRerankResponse(body), channeltype.OpenAICompatible, "jina-reranker-m0")
+		require.Nil(t, err)
+		assert.Equal(t, 42, usage.TotalTokens)
+		assert.JSONEq(t, body, w.Body.String())
+	})
+
+	t.Run("SiliconFlow tokens become the prompt tokens", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		body := `{"id":"r1","results":[{"index":0,"relevance_score":0.5}],"tokens":{"input_tokens":30,"output_tokens":0}}`
+		err, usage := RerankHandler(c, newRerankResponse(body), channeltype.SiliconFlow, "BAAI/bge-reranker-v2-m3")
+		require.Nil(t, err)
+		assert.Equal(t, 30, usage.PromptTokens)
+		var rerankResponse model.RerankResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rerankResponse))
+		assert.Equal(t, "BAAI/bge-reranker-v2-m3", rerankResponse.Model)
+		assert.Equal(t, 30, rerankResponse.Usage.PromptTokens)
+		assert.Len(t, rerankResponse.Results, 1)
+	})
+
+	t.Run("no usage means billing per search", func(t *testing.T) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		err, usage := RerankHandler(c, newRerankResponse(`{"results":[]}`), channeltype.OpenAICompatible, "rerank")
+		require.Nil(t, err)
+		assert.Zero(t, usage.PromptTokens)
+	})
+}
@@ -0,0 +1,438 @@
+package openai
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/conv"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://platform.openai.com/docs/api-reference/responses
+
+type ResponsesTool struct {
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+	Strict      *bool  `json:"strict,omitempty"`
+}
+
+type ResponsesRequest struct {
+	Model              string          `json:"model"`
+	Input              any             `json:"input,omitempty"` // string or []ResponsesInputItem
+	Instructions       string          `json:"instructions,omitempty"`
+	MaxOutputTokens    int             `json:"max_output_tokens,omitempty"`
+	Temperature        *float64        `json:"temperature,omitempty"`
+	TopP               *float64        `json:"top_p,omitempty"`
+	Stream             bool            `json:"stream,omitempty"`
+	Tools              []ResponsesTool `json:"tools,omitempty"`
+	ToolChoice         any             `json:"tool_choice,omitempty"`
+	ParallelToolCalls  *bool           `json:"parallel_tool_calls,omitempty"`
+	PreviousResponseId string          `json:"previous_response_id,omitempty"`
+	Store              *bool           `json:"store,omitempty"`
+	Metadata           any             `json:"metadata,omitempty"`
+	Reasoning          any             `json:"reasoning,omitempty"`
+	Text               any             `json:"text,omitempty"`
+	User               string          `json:"user,omitempty"`
+}
+
+type ResponsesContent struct {
+	Type        string `json:"type"`
+	Text        string `json:"text,omitempty"`
+	ImageURL    string `json:"image_url,omitempty"`
+	Detail      string `json:"detail,omitempty"`
+	Annotations []any  `json:"annotations,omitempty"`
+}
+
+// ResponsesItem is an input or output item. Which fields are set depends on Type:
+// message, function_call or function_call_output.
+type ResponsesItem struct {
+	Type      string `json:"type,omitempty"`
+	Id        string `json:"id,omitempty"`
+	Status    string `json:"status,omitempty"`
+	Role      string `json:"role,omitempty"`
+	Content   any    `json:"content,omitempty"` // string or []ResponsesContent
+	CallId    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	Output    string `json:"output,omitempty"`
+}
+
+type ResponsesUsage struct {
+	InputTokens        int `json:"input_tokens"`
+	OutputTokens       int `json:"output_tokens"`
+	TotalTokens        int `json:"total_tokens"`
+	InputTokensDetails *struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"input_tokens_details,omitempty"`
+	OutputTokensDetails *struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"output_tokens_details,omitempty"`
+}
+
+func (u *ResponsesUsage) ToUsage() *model.Usage {
+	usage := &model.Usage{
+		PromptTokens:     u.InputTokens,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      u.InputTokens + u.OutputTokens,
+	}
+	if u.InputTokensDetails != nil && u.InputTokensDetails.CachedTokens > 0 {
+		usage.PromptTokensDetails = &model.PromptTokensDetails{
+			CachedTokens: u.InputTokensDetails.CachedTokens,
+		}
+	}
+	if u.OutputTokensDetails != nil {
+		usage.CompletionTokensDetails = &model.CompletionTokensDetails{
+			ReasoningTokens: u.OutputTokensDetails.ReasoningTokens,
+		}
+	}
+	return usage
+}
+
+type ResponsesResponse struct {
+	Id        string          `json:"id"`
+	Object    string          `json:"object"`
+	CreatedAt int64           `json:"created_at"`
+	Status    string          `json:"status"`
+	Model     string          `json:"model"`
+	Output    []ResponsesItem `json:"output"`
+	Usage     *ResponsesUsage `json:"usage,omitempty"`
+	Error     *model.Error    `json:"error,omitempty"`
+}
+
+type ResponsesStreamEvent struct {
+	Type     string             `json:"type"`
+	Response *ResponsesResponse `json:"response,omitempty"`
+}
+
+// ConvertResponsesNativeRequest forwards the inbound Responses API request
+// as-is, so that fields unknown to this relay still reach the upstream.
+func ConvertResponsesNativeRequest(c *gin.Context, meta *meta.Meta) (any, error) {
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil, err
+	}
+	rawRequest := make(map[string]any)
+	err = json.Unmarshal(requestBody, &rawRequest)
+	if err != nil {
+		return nil, err
+	}
+	rawRequest["model"] = meta.ActualModelName
+	if meta.ForcedSystemPrompt != "" {
+		rawRequest["instructions"] = meta.ForcedSystemPrompt
+	}
+	return rawRequest, nil
+}
+
+func responsesToolChoice2Chat(toolChoice any) any {
+	choice, ok := toolChoice.(map[string]any)
+	if !ok {
+		// "auto", "none" and "required" mean the same in both APIs
+		return toolChoice
+	}
+	if choice["type"] == "function" {
+		return map[string]any{
+			"type": "function",
+			"function": map[string]any{
+				"name": choice["name"],
+			},
+		}
+	}
+	return nil
+}
+
+func responsesContent2Chat(content any) any {
+	if text, ok := content.(string); ok {
+		return text
+	}
+	var contents []ResponsesContent
+	data, _ := json.Marshal(content)
+	_ = json.Unmarshal(data, &contents)
+	var parts []model.MessageContent
+	for _, part := range contents {
+		switch part.Type {
+		case "input_text", "output_text", "text":
+			parts = append(parts, model.MessageContent{
+				Type: model.ContentTypeText,
+				Text: part.Text,
+			})
+		case "input_image":
+			parts = append(parts, model.MessageContent{
+				Type: model.ContentTypeImageURL,
+				ImageURL: &model.ImageURL{
+					Url:    part.ImageURL,
+					Detail: part.Detail,
+				},
+			})
+		}
+	}
+	if len(parts) == 1 && parts[0].Type == model.ContentTypeText {
+		return parts[0].Text
+	}
+	return parts
+}
+
+// ConvertResponsesRequest converts a Responses API request into a chat
+// completions request, for channels that only speak chat.
+func ConvertResponsesRequest(request *ResponsesRequest) (*model.GeneralOpenAIRequest, error) {
+	if request.PreviousResponseId != "" {
+		return nil, fmt.Errorf("previous_response_id is not supported by this channel")
+	}
+	chatRequest := model.GeneralOpenAIRequest{
+		Model:            request.Model,
+		MaxTokens:        request.MaxOutputTokens,
+		Temperature:      request.Temperature,
+		TopP:             request.TopP,
+		Stream:           request.Stream,
+		ToolChoice:       responsesToolChoice2Chat(request.ToolChoice),
+		ParallelTooCalls: request.ParallelToolCalls,
+		User:             request.User,
+	}
+	for _, tool := range request.Tools {
+		if tool.Type != "function" {
+			continue
+		}
+		chatRequest.Tools = append(chatRequest.Tools, model.Tool{
+			Type: "function",
+			Function: model.Function{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	if request.Instructions != "" {
+		chatRequest.Messages = append(chatRequest.Messages, model.Message{
+			Role:    "system",
+			Content: request.Instructions,
+		})
+	}
+	if input, ok := request.Input.(string); ok {
+		chatRequest.Messages = append(chatRequest.Messages, model.Message{
+			Role:    "user",
+			Content: input,
+		})
+		return &chatRequest, nil
+	}
+	var items []ResponsesItem
+	data, _ := json.Marshal(request.Input)
+	err := json.Unmarshal(data, &items)
+	if err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+	for _, item := range items {
+		switch item.Type {
+		case "function_call":
+			toolCall := model.Tool{
+				Id:   item.CallId,
+				Type: "function",
+				Function: model.Function{
+					Name:      item.Name,
+					Arguments: item.Arguments,
+				},
+			}
+			// consecutive calls belong to the same assistant turn
+			last := len(chatRequest.Messages) - 1
+			if last >= 0 && chatRequest.Messages[last].Role == "assistant" && len(chatRequest.Messages[last].ToolCalls) > 0 {
+				chatRequest.Messages[last].ToolCalls = append(chatRequest.Messages[last].ToolCalls, toolCall)
+				continue
+			}
+			chatRequest.Messages = append(chatRequest.Messages, model.Message{
+				Role:      "assistant",
+				ToolCalls: []model.Tool{toolCall},
+			})
+		case "function_call_output":
+			chatRequest.Messages = append(chatRequest.Messages, model.Message{
+				Role:       "tool",
+				Content:    item.Output,
+				ToolCallId: item.CallId,
+			})
+		case "message", "":
+			role := item.Role
+			if role == "developer" {
+				role = "system"
+			}
+			chatRequest.Messages = append(chatRequest.Messages, model.Message{
+				Role:    role,
+				Content: responsesContent2Chat(item.Content),
+			})
+		}
+	}
+	return &chatRequest, nil
+}
+
+func ResponsesResponseFromChat(textResponse *TextResponse) *ResponsesResponse {
+	response := ResponsesResponse{
+		Id:        fmt.Sprintf("resp_%s", random.GetUUID()),
+		Object:    "response",
+		CreatedAt: helper.GetTimestamp(),
+		Status:    "completed",
+		Model:     textResponse.Model,
+		Output:    make([]ResponsesItem, 0),
+		Usage: &ResponsesUsage{
+			InputTokens:  textResponse.PromptTokens,
+			OutputTokens: textResponse.CompletionTokens,
+			TotalTokens:  textResponse.PromptTokens + textResponse.CompletionTokens,
+		},
+	}
+	if len(textResponse.Choices) == 0 {
+		return &response
+	}
+	choice := textResponse.Choices[0]
+	if choice.FinishReason == "length" {
+		response.Status = "incomplete"
+	}
+	if text := choice.Message.StringContent(); text != "" {
+		response.Output = append(response.Output, ResponsesItem{
+			Type:   "message",
+			Id:     fmt.Sprintf("msg_%s", random.GetUUID()),
+			Status: "completed",
+			Role:   "assistant",
+			Content: []ResponsesContent{{
+				Type:        "output_text",
+				Text:        text,
+				Annotations: []any{},
+			}},
+		})
+	}
+	for _, toolCall := range choice.Message.ToolCalls {
+		response.Output = append(response.Output, ResponsesItem{
+			Type:      "function_call",
+			Id:        fmt.Sprintf("fc_%s", random.GetUUID()),
+			Status:    "completed",
+			CallId:    toolCall.Id,
+			Name:      toolCall.Function.Name,
+			Arguments: conv.AsString(toolCall.Function.Arguments),
+		})
+	}
+	return &response
+}
+
+// ResponsesStreamHandler relays a Responses API event stream as-is, taking
+// usage from the response.completed event.
+func ResponsesStreamHandler(c *gin.Context, resp *http.Response, promptTokens int, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	scanner.Split(bufio.ScanLines)
+
+	common.SetEventStreamHeaders(c)
+	stopWatching := common.WatchClientAbort(c, resp.Body)
+
+	var usage *model.Usage
+	responseText := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		_, err := c.Writer.WriteString(line + "\n")
+		if err != nil {
+			logger.SysError("error writing stream response: " + err.Error())
+			break
+		}
+		if line == "" {
+			c.Writer.Flush()
+			continue
+		}
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		var event struct {
+			ResponsesStreamEvent
+			Delta string `json:"delta"`
+		}
+		err = json.Unmarshal([]byte(data), &event)
+		if err != nil {
+			logger.SysError("error unmarshalling stream response: " + err.Error())
+			continue
+		}
+		switch event.Type {
+		case "response.output_text.delta":
+			responseText += event.Delta
+		case "response.completed", "response.incomplete", "response.failed":
+			if event.Response != nil && event.Response.Usage != nil {
+				usage = event.Response.Usage.ToUsage()
+			}
+		}
+	}
+	aborted := stopWatching()
+	c.Writer.Flush()
+
+	if err := scanner.Err(); err != nil && !aborted {
+		logger.SysError("error reading stream: " + err.Error())
+	}
+	if aborted {
+		logger.Warn(c.Request.Context(), "client aborted the stream")
+	}
+
+	err := resp.Body.Close()
+	if err != nil {
+		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if usage == nil || usage.TotalTokens == 0 {
+		usage = ResponseText2Usage(responseText, modelName, promptTokens)
+	}
+	return nil, usage
+}
+
+// ResponsesHandler relays a Responses API response as-is.
+func ResponsesHandler(c *gin.Context, resp *http.Response, promptTokens int, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var response ResponsesResponse
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if response.Error != nil && response.Error.Message != "" {
+		return &model.ErrorWithStatusCode{
+			Error:      *response.Error,
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(responseBody)
+	if err != nil {
+		return ErrorWrapper(err, "write_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if response.Usage != nil && response.Usage.TotalTokens != 0 {
+		return nil, response.Usage.ToUsage()
+	}
+	responseText := ""
+	for _, item := range response.Output {
+		if item.Type == "message" {
+			responseText += responsesContentText(item.Content)
+		}
+	}
+	return nil, ResponseText2Usage(responseText, modelName, promptTokens)
+}
+
+func responsesContentText(content any) string {
+	if text, ok := content.(string); ok {
+		return text
+	}
+	var contents []ResponsesContent
+	data, _ := json.Marshal(content)
+	_ = json.Unmarshal(data, &contents)
+	text := ""
+	for _, part := range contents {
+		text += part.Text
+	}
+	return text
+}
@@ -0,0 +1,147 @@
+package openai
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestConvertResponsesRequest(t *testing.T) {
+	var request ResponsesRequest
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"model": "gpt-4o",
+		"instructions": "be brief",
+		"max_output_tokens": 256,
+		"tool_choice": {"type": "function", "name": "get_weather"},
+		"tools": [{"type": "function", "name": "get_weather", "parameters": {"type": "object"}}, {"type": "web_search_preview"}],
+		"input": [
+			{"role": "developer", "content": "answer in French"},
+			{"type": "message", "role": "user", "content": [{"type": "input_text", "text": "weather?"}, {"type": "input_image", "image_url": "https://example.com/a.png"}]},
+			{"type": "function_call", "call_id": "call_1", "name": "get_weather", "arguments": "{\"city\":\"Paris\"}"},
+			{"type": "function_call", "call_id": "call_2", "name": "get_weather", "arguments": "{\"city\":\"Lyon\"}"},
+			{"type": "function_call_output", "call_id": "call_1", "output": "sunny"}
+		]
+	}`), &request))
+
+	chatRequest, err := ConvertResponsesRequest(&request)
+	require.NoError(t, err)
+	assert.Equal(t, 256, chatRequest.MaxTokens)
+	assert.Equal(t, map[string]any{"type": "function", "function": map[string]any{"name": "get_weather"}}, chatRequest.ToolChoice)
+	// only function tools can be served over chat
+	require.Len(t, chatRequest.Tools, 1)
+
+	require.Len(t, chatRequest.Messages, 5)
+	assert.Equal(t, "system", chatRequest.Messages[0].Role)
+	assert.Equal(t, "be brief", chatRequest.Messages[0].StringContent())
+	assert.Equal(t, "system", chatRequest.Messages[1].Role)
+	contents, ok := chatRequest.Messages[2].Content.([]model.MessageContent)
+	require.True(t, ok)
+	require.Len(t, contents, 2)
+	assert.Equal(t, "https://example.com/a.png", contents[1].ImageURL.Url)
+	// consecutive calls make up a single assistant turn
+	assert.Equal(t, "assistant", chatRequest.Messages[3].Role)
+	require.Len(t, chatRequest.Messages[3].ToolCalls, 2)
+	assert.Equal(t, "call_2", chatRequest.Messages[3].ToolCalls[1].Id)
+	assert.Equal(t, "tool", chatRequest.Messages[4].Role)
+	assert.Equal(t, "call_1", chatRequest.Messages[4].ToolCallId)
+
+	request = ResponsesRequest{Model: "gpt-4o", Input: "hi"}
+	chatRequest, err = ConvertResponsesRequest(&request)
+	require.NoError(t, err)
+	require.Len(t, chatRequest.Messages, 1)
+	assert.Equal(t, "hi", chatRequest.Messages[0].StringContent())
+
+	request.PreviousResponseId = "resp_1"
+	_, err = ConvertResponsesRequest(&request)
+	assert.Error(t, err)
+}
+
+func TestResponsesWriter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("a chat completion becomes a response", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		writer := NewResponsesWriter(c.Writer, false, "gpt-4o")
+		_, _ = writer.Write([]byte(`{"id":"chatcmpl-1","model":"gpt-4o-2024-08-06","choices":[{"index":0,"finish_reason":"tool_calls","message":{"role":"assistant","content":"checking","tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{}"}}]}}]}`))
+		writer.Finish(&model.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15})
+
+		var response ResponsesResponse
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.Equal(t, "response", response.Object)
+		assert.Equal(t, "completed", response.Status)
+		assert.Equal(t, "gpt-4o", response.Model)
+		require.Len(t, response.Output, 2)
+		assert.Equal(t, "checking", responsesContentText(response.Output[0].Content))
+		assert.Equal(t, "function_call", response.Output[1].Type)
+		assert.Equal(t, "call_1", response.Output[1].CallId)
+		assert.Equal(t, &ResponsesUsage{InputTokens: 10, OutputTokens: 5, TotalTokens: 15}, response.Usage)
+	})
+
+	t.Run("chat chunks become response events", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		writer := NewResponsesWriter(c.Writer, true, "gpt-4o")
+		chunks := []string{
+			`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}`,
+			`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"content":"lo"},"finish_reason":"length"}]}`,
+		}
+		for _, chunk := range chunks {
+			_, _ = writer.Write([]byte("data: " + chunk + "\n\n"))
+		}
+		writer.Finish(&model.Usage{PromptTokens: 10, CompletionTokens: 2})
+
+		var events []string
+		var last map[string]any
+		for _, line := range strings.Split(recorder.Body.String(), "\n") {
+			if strings.HasPrefix(line, "event: ") {
+				events = append(events, strings.TrimPrefix(line, "event: "))
+			}
+			if strings.HasPrefix(line, "data: ") {
+				last = nil
+				require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &last))
+			}
+		}
+		assert.Equal(t, []string{
+			"response.created",
+			"response.output_item.added", "response.content_part.added",
+			"response.output_text.delta", "response.output_text.delta",
+			"response.output_text.done", "response.content_part.done", "response.output_item.done",
+			"response.incomplete",
+		}, events)
+		response := last["response"].(map[string]any)
+		assert.Equal(t, "incomplete", response["status"])
+		assert.Equal(t, 2.0, response["usage"].(map[string]any)["output_tokens"])
+		assert.Equal(t, 8.0, last["sequence_number"])
+	})
+}
+
+func TestResponsesStreamHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/responses", nil)
+	stream := "event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\"Hello\"}\n\n" +
+		"event: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_1\",\"status\":\"completed\",\"usage\":{\"input_tokens\":10,\"output_tokens\":3,\"total_tokens\":13,\"input_tokens_details\":{\"cached_tokens\":4},\"output_tokens_details\":{\"reasoning_tokens\":2}}}}\n\n"
+	resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(stream))}
+
+	err, usage := ResponsesStreamHandler(c, resp, 10, "gpt-4o")
+	require.Nil(t, err)
+	assert.Equal(t, stream, recorder.Body.String())
+	assert.Equal(t, &model.Usage{
+		PromptTokens:            10,
+		CompletionTokens:        3,
+		TotalTokens:             13,
+		PromptTokensDetails:     &model.PromptTokensDetails{CachedTokens: 4},
+		CompletionTokensDetails: &model.CompletionTokensDetails{ReasoningTokens: 2},
+	}, usage)
+}
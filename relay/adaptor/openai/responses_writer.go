@@ -0,0 +1,288 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/conv"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// ResponsesWriter translates the chat completion output written by any adaptor
+// into the Responses API format, so that /v1/responses can be served by
+// channels that only speak chat completions.
+type ResponsesWriter struct {
+	gin.ResponseWriter
+
+	isStream   bool
+	modelName  string
+	statusCode int
+	buffer     bytes.Buffer
+
+	// stream state
+	response       *ResponsesResponse
+	sequenceNumber int
+	item           *ResponsesItem
+	text           strings.Builder
+	usage          *model.Usage
+}
+
+func NewResponsesWriter(w gin.ResponseWriter, isStream bool, modelName string) *ResponsesWriter {
+	return &ResponsesWriter{
+		ResponseWriter: w,
+		isStream:       isStream,
+		modelName:      modelName,
+		statusCode:     http.StatusOK,
+	}
+}
+
+func (w *ResponsesWriter) WriteHeader(statusCode int) {
+	// c.Render passes -1 for streamed events
+	if statusCode > 0 {
+		w.statusCode = statusCode
+	}
+}
+
+func (w *ResponsesWriter) WriteHeaderNow() {}
+
+func (w *ResponsesWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *ResponsesWriter) Write(data []byte) (int, error) {
+	w.buffer.Write(data)
+	if !w.isStream {
+		return len(data), nil
+	}
+	for {
+		line, err := w.buffer.ReadString('\n')
+		if err != nil {
+			// keep the incomplete line for the next write
+			w.buffer.Reset()
+			w.buffer.WriteString(line)
+			break
+		}
+		w.handleStreamLine(strings.TrimSpace(line))
+	}
+	return len(data), nil
+}
+
+func (w *ResponsesWriter) Flush() {
+	if w.isStream {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *ResponsesWriter) handleStreamLine(line string) {
+	if !strings.HasPrefix(line, "data:") {
+		return
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	if data == "[DONE]" {
+		return
+	}
+	var streamResponse ChatCompletionsStreamResponse
+	err := json.Unmarshal([]byte(data), &streamResponse)
+	if err != nil {
+		logger.SysError("error unmarshalling stream response: " + err.Error())
+		return
+	}
+	if streamResponse.Usage != nil {
+		w.usage = streamResponse.Usage
+	}
+	w.startResponse()
+	for _, choice := range streamResponse.Choices {
+		if text := conv.AsString(choice.Delta.Content); text != "" {
+			if w.item == nil || w.item.Type != "message" {
+				w.startItem(&ResponsesItem{
+					Type:    "message",
+					Id:      fmt.Sprintf("msg_%s", random.GetUUID()),
+					Status:  "in_progress",
+					Role:    "assistant",
+					Content: []ResponsesContent{},
+				})
+				w.writeEvent("response.content_part.added", map[string]any{
+					"item_id":       w.item.Id,
+					"output_index":  len(w.response.Output),
+					"content_index": 0,
+					"part":          ResponsesContent{Type: "output_text", Annotations: []any{}},
+				})
+			}
+			w.text.WriteString(text)
+			w.writeEvent("response.output_text.delta", map[string]any{
+				"item_id":       w.item.Id,
+				"output_index":  len(w.response.Output),
+				"content_index": 0,
+				"delta":         text,
+			})
+		}
+		for _, toolCall := range choice.Delta.ToolCalls {
+			if toolCall.Id != "" {
+				w.startItem(&ResponsesItem{
+					Type:   "function_call",
+					Id:     fmt.Sprintf("fc_%s", random.GetUUID()),
+					Status: "in_progress",
+					CallId: toolCall.Id,
+					Name:   toolCall.Function.Name,
+				})
+			}
+			if args := conv.AsString(toolCall.Function.Arguments); args != "" && w.item != nil && w.item.Type == "function_call" {
+				w.text.WriteString(args)
+				w.writeEvent("response.function_call_arguments.delta", map[string]any{
+					"item_id":      w.item.Id,
+					"output_index": len(w.response.Output),
+					"delta":        args,
+				})
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason == "length" {
+			w.response.Status = "incomplete"
+		}
+	}
+}
+
+func (w *ResponsesWriter) startResponse() {
+	if w.response != nil {
+		return
+	}
+	w.response = &ResponsesResponse{
+		Id:        fmt.Sprintf("resp_%s", random.GetUUID()),
+		Object:    "response",
+		CreatedAt: helper.GetTimestamp(),
+		Status:    "in_progress",
+		Model:     w.modelName,
+		Output:    make([]ResponsesItem, 0),
+	}
+	w.writeEvent("response.created", map[string]any{"response": w.response})
+}
+
+func (w *ResponsesWriter) startItem(item *ResponsesItem) {
+	w.stopItem()
+	w.item = item
+	w.writeEvent("response.output_item.added", map[string]any{
+		"output_index": len(w.response.Output),
+		"item":         item,
+	})
+}
+
+func (w *ResponsesWriter) stopItem() {
+	if w.item == nil {
+		return
+	}
+	outputIndex := len(w.response.Output)
+	w.item.Status = "completed"
+	switch w.item.Type {
+	case "message":
+		part := ResponsesContent{Type: "output_text", Text: w.text.String(), Annotations: []any{}}
+		w.writeEvent("response.output_text.done", map[string]any{
+			"item_id":       w.item.Id,
+			"output_index":  outputIndex,
+			"content_index": 0,
+			"text":          part.Text,
+		})
+		w.writeEvent("response.content_part.done", map[string]any{
+			"item_id":       w.item.Id,
+			"output_index":  outputIndex,
+			"content_index": 0,
+			"part":          part,
+		})
+		w.item.Content = []ResponsesContent{part}
+	case "function_call":
+		w.item.Arguments = w.text.String()
+		w.writeEvent("response.function_call_arguments.done", map[string]any{
+			"item_id":      w.item.Id,
+			"output_index": outputIndex,
+			"arguments":    w.item.Arguments,
+		})
+	}
+	w.writeEvent("response.output_item.done", map[string]any{
+		"output_index": outputIndex,
+		"item":         w.item,
+	})
+	w.response.Output = append(w.response.Output, *w.item)
+	w.item = nil
+	w.text.Reset()
+}
+
+func (w *ResponsesWriter) writeEvent(event string, payload map[string]any) {
+	payload["type"] = event
+	payload["sequence_number"] = w.sequenceNumber
+	w.sequenceNumber++
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		logger.SysError("error marshalling stream response: " + err.Error())
+		return
+	}
+	_, err = w.ResponseWriter.WriteString(fmt.Sprintf("event: %s\ndata: %s\n\n", event, jsonData))
+	if err != nil {
+		logger.SysError("error writing stream response: " + err.Error())
+		return
+	}
+	w.ResponseWriter.Flush()
+}
+
+// Finish completes the translated response once the adaptor has returned.
+// usage is the final usage computed by the relay, which takes precedence over
+// the usage seen in the stream.
+func (w *ResponsesWriter) Finish(usage *model.Usage) {
+	if usage == nil {
+		usage = w.usage
+	}
+	if w.isStream {
+		w.finishStream(usage)
+		return
+	}
+	w.ResponseWriter.Header().Del("Content-Length")
+	w.ResponseWriter.Header().Set("Content-Type", "application/json")
+	if w.statusCode != http.StatusOK {
+		w.ResponseWriter.WriteHeader(w.statusCode)
+		_, _ = w.ResponseWriter.Write(w.buffer.Bytes())
+		return
+	}
+	var textResponse TextResponse
+	err := json.Unmarshal(w.buffer.Bytes(), &textResponse)
+	if err != nil {
+		logger.SysError("error unmarshalling response: " + err.Error())
+		w.ResponseWriter.WriteHeader(w.statusCode)
+		_, _ = w.ResponseWriter.Write(w.buffer.Bytes())
+		return
+	}
+	if usage != nil {
+		textResponse.Usage = *usage
+	}
+	response := ResponsesResponseFromChat(&textResponse)
+	response.Model = w.modelName
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		logger.SysError("error marshalling response: " + err.Error())
+		return
+	}
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	_, _ = w.ResponseWriter.Write(jsonResponse)
+}
+
+func (w *ResponsesWriter) finishStream(usage *model.Usage) {
+	w.startResponse()
+	w.stopItem()
+	event := "response.completed"
+	if w.response.Status == "incomplete" {
+		event = "response.incomplete"
+	} else {
+		w.response.Status = "completed"
+	}
+	if usage != nil {
+		w.response.Usage = &ResponsesUsage{
+			InputTokens:  usage.PromptTokens,
+			OutputTokens: usage.CompletionTokens,
+			TotalTokens:  usage.PromptTokens + usage.CompletionTokens,
+		}
+	}
+	w.writeEvent(event, map[string]any{"response": w.response})
+}
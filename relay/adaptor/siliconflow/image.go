@@ -0,0 +1,54 @@
+package siliconflow
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://docs.siliconflow.cn/api-reference/images/images-generations
+
+type ImageRequest struct {
+	Model     string `json:"model"`
+	Prompt    string `json:"prompt"`
+	Image     string `json:"image"`
+	ImageSize string `json:"image_size,omitempty"`
+	BatchSize int    `json:"batch_size,omitempty"`
+}
+
+// ConvertImageEditRequest turns an image edit or variation into an
+// image-to-image generation, as SiliconFlow has no dedicated endpoints.
+func ConvertImageEditRequest(request *model.ImageRequest) (*ImageRequest, error) {
+	if request.Image == nil {
+		return nil, errors.New("image is required")
+	}
+	file, err := request.Image.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	mimeType := request.Image.Header.Get("Content-Type")
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		mimeType = http.DetectContentType(data)
+	}
+	return &ImageRequest{
+		Model:     request.Model,
+		Prompt:    request.Prompt,
+		Image:     fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(data)),
+		ImageSize: request.Size,
+		BatchSize: request.N,
+	}, nil
+}
+
+func GetImageEditRequestURL(meta *meta.Meta) (string, error) {
+	return fmt.Sprintf("%s/v1/images/generations", meta.BaseURL), nil
+}
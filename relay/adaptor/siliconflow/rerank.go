@@ -0,0 +1,14 @@
+package siliconflow
+
+import "github.com/songquanpeng/one-api/relay/model"
+
+// https://docs.siliconflow.cn/api-reference/rerank/create-rerank
+
+type RerankResponse struct {
+	Id      string               `json:"id"`
+	Results []model.RerankResult `json:"results"`
+	Tokens  struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"tokens"`
+}
@@ -10,12 +10,16 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/relay/adaptor"
 	channelhelper "github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/anthropic"
+	"github.com/songquanpeng/one-api/relay/adaptor/gemini"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
 )
 
 var _ adaptor.Adaptor = new(Adaptor)
+var _ anthropic.NativeAdaptor = new(Adaptor)
+var _ gemini.NativeAdaptor = new(Adaptor)
 
 const channelName = "vertexai"
 
@@ -50,6 +54,48 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Met
 	return adaptor.DoResponse(c, resp, meta)
 }
 
+func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, meta *meta.Meta, request *anthropic.Request) (any, error) {
+	adaptor, ok := GetAdaptor(request.Model).(anthropic.NativeAdaptor)
+	if !ok {
+		return nil, errors.New("adaptor not found")
+	}
+	return adaptor.ConvertClaudeRequest(c, meta, request)
+}
+
+func (a *Adaptor) DoClaudeResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	adaptor, ok := GetAdaptor(meta.ActualModelName).(anthropic.NativeAdaptor)
+	if !ok {
+		return nil, &relaymodel.ErrorWithStatusCode{
+			StatusCode: http.StatusInternalServerError,
+			Error: relaymodel.Error{
+				Message: "adaptor not found",
+			},
+		}
+	}
+	return adaptor.DoClaudeResponse(c, resp, meta)
+}
+
+func (a *Adaptor) ConvertGeminiRequest(c *gin.Context, meta *meta.Meta, request *gemini.ChatRequest) (any, error) {
+	adaptor, ok := GetAdaptor(meta.ActualModelName).(gemini.NativeAdaptor)
+	if !ok {
+		return nil, errors.New("adaptor not found")
+	}
+	return adaptor.ConvertGeminiRequest(c, meta, request)
+}
+
+func (a *Adaptor) DoGeminiResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	adaptor, ok := GetAdaptor(meta.ActualModelName).(gemini.NativeAdaptor)
+	if !ok {
+		return nil, &relaymodel.ErrorWithStatusCode{
+			StatusCode: http.StatusInternalServerError,
+			Error: relaymodel.Error{
+				Message: "adaptor not found",
+			},
+		}
+	}
+	return adaptor.DoGeminiResponse(c, resp, meta)
+}
+
 func (a *Adaptor) GetModelList() (models []string) {
 	models = modelList
 	return
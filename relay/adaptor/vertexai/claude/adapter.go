@@ -50,6 +50,38 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.G
 	return req, nil
 }
 
+func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, meta *meta.Meta, claudeReq *anthropic.Request) (any, error) {
+	if claudeReq == nil {
+		return nil, errors.New("request is nil")
+	}
+	req := Request{
+		AnthropicVersion: anthropicVersion,
+		Messages:         claudeReq.Messages,
+		System:           claudeReq.System,
+		MaxTokens:        claudeReq.MaxTokens,
+		StopSequences:    claudeReq.StopSequences,
+		Temperature:      claudeReq.Temperature,
+		TopP:             claudeReq.TopP,
+		TopK:             claudeReq.TopK,
+		Stream:           claudeReq.Stream,
+		Tools:            claudeReq.Tools,
+		ToolChoice:       claudeReq.ToolChoice,
+	}
+
+	c.Set(ctxkey.RequestModel, claudeReq.Model)
+	c.Set(ctxkey.ConvertedRequest, req)
+	return req, nil
+}
+
+func (a *Adaptor) DoClaudeResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	if meta.IsStream {
+		err, usage = anthropic.NativeStreamHandler(c, resp)
+	} else {
+		err, usage = anthropic.NativeHandler(c, resp)
+	}
+	return
+}
+
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
 	if meta.IsStream {
 		err, usage = anthropic.StreamHandler(c, resp)
@@ -0,0 +1,104 @@
+package ratio
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// Cache ratios are relative to the input price of the model: reading 1K cached
+// input tokens costs CacheReadRatio times as much as 1K uncached ones.
+
+var cacheRatioLock sync.RWMutex
+
+var CacheReadRatio = map[string]float64{}
+
+var CacheWriteRatio = map[string]float64{}
+
+func CacheReadRatio2JSONString() string {
+	cacheRatioLock.RLock()
+	defer cacheRatioLock.RUnlock()
+	jsonBytes, err := json.Marshal(CacheReadRatio)
+	if err != nil {
+		logger.SysError("error marshalling cache read ratio: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateCacheReadRatioByJSONString(jsonStr string) error {
+	cacheRatioLock.Lock()
+	defer cacheRatioLock.Unlock()
+	CacheReadRatio = make(map[string]float64)
+	return json.Unmarshal([]byte(jsonStr), &CacheReadRatio)
+}
+
+func CacheWriteRatio2JSONString() string {
+	cacheRatioLock.RLock()
+	defer cacheRatioLock.RUnlock()
+	jsonBytes, err := json.Marshal(CacheWriteRatio)
+	if err != nil {
+		logger.SysError("error marshalling cache write ratio: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateCacheWriteRatioByJSONString(jsonStr string) error {
+	cacheRatioLock.Lock()
+	defer cacheRatioLock.Unlock()
+	CacheWriteRatio = make(map[string]float64)
+	return json.Unmarshal([]byte(jsonStr), &CacheWriteRatio)
+}
+
+// GetCacheReadRatio returns the price of cached input tokens relative to
+// uncached ones.
+func GetCacheReadRatio(name string, channelType int) float64 {
+	cacheRatioLock.RLock()
+	defer cacheRatioLock.RUnlock()
+	if ratio, ok := CacheReadRatio[fmt.Sprintf("%s(%d)", name, channelType)]; ok {
+		return ratio
+	}
+	if ratio, ok := CacheReadRatio[name]; ok {
+		return ratio
+	}
+	// https://docs.anthropic.com/en/docs/build-with-claude/prompt-caching#pricing
+	if strings.HasPrefix(name, "claude-") || strings.Contains(name, "anthropic.claude") {
+		return 0.1
+	}
+	// https://api-docs.deepseek.com/quick_start/pricing
+	if strings.HasPrefix(name, "deepseek-") {
+		return 0.1
+	}
+	// https://ai.google.dev/gemini-api/docs/pricing
+	if strings.HasPrefix(name, "gemini-") {
+		return 0.25
+	}
+	// https://openai.com/api/pricing/
+	if strings.HasPrefix(name, "gpt-5") {
+		return 0.1
+	}
+	if strings.HasPrefix(name, "gpt-4.1") || strings.HasPrefix(name, "o3") || strings.HasPrefix(name, "o4") {
+		return 0.25
+	}
+	return 0.5
+}
+
+// GetCacheWriteRatio returns the price of input tokens written to the prompt
+// cache relative to uncached ones.
+func GetCacheWriteRatio(name string, channelType int) float64 {
+	cacheRatioLock.RLock()
+	defer cacheRatioLock.RUnlock()
+	if ratio, ok := CacheWriteRatio[fmt.Sprintf("%s(%d)", name, channelType)]; ok {
+		return ratio
+	}
+	if ratio, ok := CacheWriteRatio[name]; ok {
+		return ratio
+	}
+	// 5-minute cache writes
+	if strings.HasPrefix(name, "claude-") || strings.Contains(name, "anthropic.claude") {
+		return 1.25
+	}
+	return 1
+}
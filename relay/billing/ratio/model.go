@@ -99,6 +99,10 @@ var ModelRatio = map[string]float64{
 	"claude-3-5-sonnet-20241022": 3.0 / 1000 * USD,
 	"claude-3-5-sonnet-latest":   3.0 / 1000 * USD,
 	"claude-3-opus-20240229":     15.0 / 1000 * USD,
+	"claude-sonnet-4-0":          3.0 / 1000 * USD,
+	"claude-sonnet-4-20250514":   3.0 / 1000 * USD,
+	"claude-sonnet-4-5":          3.0 / 1000 * USD,
+	"claude-sonnet-4-5-20250929": 3.0 / 1000 * USD,
 	// https://cloud.baidu.com/doc/WENXINWORKSHOP/s/hlrk4akp7
 	"ERNIE-4.0-8K":       0.120 * RMB,
 	"ERNIE-3.5-8K":       0.012 * RMB,
@@ -334,6 +338,13 @@ var ModelRatio = map[string]float64{
 	"command-light-nightly": 0.5,
 	"command-r":             0.5 / 1000 * USD,
 	"command-r-plus":        3.0 / 1000 * USD,
+	// rerank models are billed per search of up to 100 documents
+	"rerank-v3.5":              2.0 / 1000 * USD, // $2 / 1K searches
+	"rerank-english-v3.0":      2.0 / 1000 * USD,
+	"rerank-multilingual-v3.0": 2.0 / 1000 * USD,
+	// https://jina.ai/reranker/
+	"jina-reranker-v2-base-multilingual": 0.02 * MILLI_USD,
+	"jina-reranker-m0":                   0.02 * MILLI_USD,
 	// https://platform.deepseek.com/api-docs/pricing/
 	"deepseek-chat":     0.14 * MILLI_USD,
 	"deepseek-reasoner": 0.55 * MILLI_USD,
@@ -770,7 +781,7 @@ func GetCompletionRatio(name string, channelType int) float64 {
 	if name == "chatgpt-4o-latest" {
 		return 3
 	}
-	if strings.HasPrefix(name, "claude-3") {
+	if strings.HasPrefix(name, "claude-3") || strings.HasPrefix(name, "claude-sonnet-4") {
 		return 5
 	}
 	if strings.HasPrefix(name, "claude-") {
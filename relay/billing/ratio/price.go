@@ -0,0 +1,45 @@
+package ratio
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// ModelFixedPrice holds the models billed per call rather than per token, in
+// USD per request, per image or per second of transcribed audio. The group
+// ratio still applies.
+var ModelFixedPrice = map[string]float64{}
+
+var modelFixedPriceLock sync.RWMutex
+
+func ModelFixedPrice2JSONString() string {
+	modelFixedPriceLock.RLock()
+	defer modelFixedPriceLock.RUnlock()
+	jsonBytes, err := json.Marshal(ModelFixedPrice)
+	if err != nil {
+		logger.SysError("error marshalling model fixed price: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelFixedPriceByJSONString(jsonStr string) error {
+	modelFixedPriceLock.Lock()
+	defer modelFixedPriceLock.Unlock()
+	ModelFixedPrice = make(map[string]float64)
+	return json.Unmarshal([]byte(jsonStr), &ModelFixedPrice)
+}
+
+// GetModelFixedPrice returns the price in USD per unit of the model, ok is
+// false if the model is billed per token.
+func GetModelFixedPrice(name string, channelType int) (price float64, ok bool) {
+	modelFixedPriceLock.RLock()
+	defer modelFixedPriceLock.RUnlock()
+	if price, ok := ModelFixedPrice[fmt.Sprintf("%s(%d)", name, channelType)]; ok {
+		return price, true
+	}
+	price, ok = ModelFixedPrice[name]
+	return price, ok
+}
@@ -0,0 +1,29 @@
+package ratio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+func TestGetModelFixedPrice(t *testing.T) {
+	require.NoError(t, UpdateModelFixedPriceByJSONString(`{"dall-e-3": 0.04, "dall-e-3(3)": 0.08, "whisper-1": 0.0001}`))
+	defer func() { _ = UpdateModelFixedPriceByJSONString(`{}`) }()
+
+	price, ok := GetModelFixedPrice("dall-e-3", channeltype.OpenAI)
+	assert.True(t, ok)
+	assert.Equal(t, 0.04, price)
+	// a per-channel-type price wins over the model one
+	price, ok = GetModelFixedPrice("dall-e-3", channeltype.Azure)
+	assert.True(t, ok)
+	assert.Equal(t, 0.08, price)
+	// models without a price are billed per token
+	_, ok = GetModelFixedPrice("gpt-4o", channeltype.OpenAI)
+	assert.False(t, ok)
+
+	assert.JSONEq(t, `{"dall-e-3": 0.04, "dall-e-3(3)": 0.08, "whisper-1": 0.0001}`, ModelFixedPrice2JSONString())
+	assert.Error(t, UpdateModelFixedPriceByJSONString(`{"dall-e-3": "0.04"}`))
+}
@@ -0,0 +1,75 @@
+package ratio
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// PriceTier replaces the ratios of a model once the prompt is longer than
+// PromptTokens.
+type PriceTier struct {
+	PromptTokens    int     `json:"prompt_tokens"`
+	ModelRatio      float64 `json:"model_ratio"`
+	CompletionRatio float64 `json:"completion_ratio,omitempty"` // 0 keeps the completion ratio of the model
+}
+
+var modelPriceTiersLock sync.RWMutex
+
+var DefaultModelPriceTiers = map[string][]PriceTier{
+	// https://ai.google.dev/gemini-api/docs/pricing
+	"gemini-1.5-pro":              {{PromptTokens: 128000, ModelRatio: 2.5 * MILLI_USD}},
+	"gemini-1.5-pro-001":          {{PromptTokens: 128000, ModelRatio: 2.5 * MILLI_USD}},
+	"gemini-1.5-pro-experimental": {{PromptTokens: 128000, ModelRatio: 2.5 * MILLI_USD}},
+	"gemini-1.5-flash":            {{PromptTokens: 128000, ModelRatio: 0.15 * MILLI_USD}},
+	"gemini-1.5-flash-001":        {{PromptTokens: 128000, ModelRatio: 0.15 * MILLI_USD}},
+	"gemini-1.5-flash-8b":         {{PromptTokens: 128000, ModelRatio: 0.075 * MILLI_USD}},
+	// https://docs.anthropic.com/en/docs/build-with-claude/context-windows#1m-token-context-window
+	// $6 input and $22.50 output per million tokens past 200K input tokens
+	"claude-sonnet-4-0":          {{PromptTokens: 200000, ModelRatio: 6 * MILLI_USD, CompletionRatio: 3.75}},
+	"claude-sonnet-4-20250514":   {{PromptTokens: 200000, ModelRatio: 6 * MILLI_USD, CompletionRatio: 3.75}},
+	"claude-sonnet-4-5":          {{PromptTokens: 200000, ModelRatio: 6 * MILLI_USD, CompletionRatio: 3.75}},
+	"claude-sonnet-4-5-20250929": {{PromptTokens: 200000, ModelRatio: 6 * MILLI_USD, CompletionRatio: 3.75}},
+}
+
+var ModelPriceTiers = map[string][]PriceTier{}
+
+func ModelPriceTiers2JSONString() string {
+	modelPriceTiersLock.RLock()
+	defer modelPriceTiersLock.RUnlock()
+	jsonBytes, err := json.Marshal(ModelPriceTiers)
+	if err != nil {
+		logger.SysError("error marshalling model price tiers: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelPriceTiersByJSONString(jsonStr string) error {
+	modelPriceTiersLock.Lock()
+	defer modelPriceTiersLock.Unlock()
+	ModelPriceTiers = make(map[string][]PriceTier)
+	return json.Unmarshal([]byte(jsonStr), &ModelPriceTiers)
+}
+
+// GetModelPriceTier returns the tier of the model that applies to a prompt of
+// promptTokens tokens, nil if the flat ratios apply.
+func GetModelPriceTier(name string, channelType int, promptTokens int) *PriceTier {
+	modelPriceTiersLock.RLock()
+	defer modelPriceTiersLock.RUnlock()
+	tiers, ok := ModelPriceTiers[fmt.Sprintf("%s(%d)", name, channelType)]
+	if !ok {
+		tiers, ok = ModelPriceTiers[name]
+	}
+	if !ok {
+		tiers = DefaultModelPriceTiers[name]
+	}
+	var tier *PriceTier
+	for i := range tiers {
+		if promptTokens > tiers[i].PromptTokens && (tier == nil || tiers[i].PromptTokens > tier.PromptTokens) {
+			tier = &tiers[i]
+		}
+	}
+	return tier
+}
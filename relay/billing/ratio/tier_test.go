@@ -0,0 +1,56 @@
+package ratio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+func TestGetModelPriceTier(t *testing.T) {
+	t.Run("default tiers apply past their prompt length", func(t *testing.T) {
+		cases := []struct {
+			model        string
+			promptTokens int
+			modelRatio   float64
+		}{
+			{"claude-sonnet-4-20250514", 200000, 0},
+			{"claude-sonnet-4-20250514", 200001, 6 * MILLI_USD},
+			{"claude-sonnet-4-5", 200001, 6 * MILLI_USD},
+			{"gemini-1.5-pro", 128000, 0},
+			{"gemini-1.5-pro", 128001, 2.5 * MILLI_USD},
+			{"claude-3-5-sonnet-20241022", 1000000, 0},
+		}
+		for _, tc := range cases {
+			tier := GetModelPriceTier(tc.model, channeltype.Anthropic, tc.promptTokens)
+			if tc.modelRatio == 0 {
+				assert.Nil(t, tier, "%s at %d tokens", tc.model, tc.promptTokens)
+				continue
+			}
+			require.NotNil(t, tier, "%s at %d tokens", tc.model, tc.promptTokens)
+			assert.Equal(t, tc.modelRatio, tier.ModelRatio)
+		}
+		tier := GetModelPriceTier("claude-sonnet-4-20250514", channeltype.Anthropic, 200001)
+		// $22.50 output against $6 input
+		assert.Equal(t, 3.75, tier.CompletionRatio)
+		assert.Equal(t, 3*MILLI_USD, GetModelRatio("claude-sonnet-4-20250514", channeltype.Anthropic))
+		assert.Equal(t, 5.0, GetCompletionRatio("claude-sonnet-4-20250514", channeltype.Anthropic))
+	})
+
+	t.Run("configured tiers replace the defaults and the highest reached applies", func(t *testing.T) {
+		require.NoError(t, UpdateModelPriceTiersByJSONString(`{
+			"claude-sonnet-4-20250514": [{"prompt_tokens": 500000, "model_ratio": 5}, {"prompt_tokens": 100000, "model_ratio": 4}],
+			"claude-sonnet-4-20250514(14)": [{"prompt_tokens": 1000, "model_ratio": 7}]
+		}`))
+		defer func() { _ = UpdateModelPriceTiersByJSONString(`{}`) }()
+
+		assert.Nil(t, GetModelPriceTier("claude-sonnet-4-20250514", channeltype.OpenAI, 100000))
+		assert.Equal(t, 4.0, GetModelPriceTier("claude-sonnet-4-20250514", channeltype.OpenAI, 100001).ModelRatio)
+		assert.Equal(t, 4.0, GetModelPriceTier("claude-sonnet-4-20250514", channeltype.OpenAI, 500000).ModelRatio)
+		assert.Equal(t, 5.0, GetModelPriceTier("claude-sonnet-4-20250514", channeltype.OpenAI, 500001).ModelRatio)
+		// a tier for the channel type wins over the one for the model
+		assert.Equal(t, 7.0, GetModelPriceTier("claude-sonnet-4-20250514", channeltype.Anthropic, 1001).ModelRatio)
+	})
+}
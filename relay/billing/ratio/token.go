@@ -0,0 +1,127 @@
+package ratio
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// Reasoning and audio output tokens are part of the completion tokens, their
+// ratios are relative to the completion price of the model. Audio input tokens
+// are part of the prompt tokens, their ratio is relative to the input price.
+
+var tokenRatioLock sync.RWMutex
+
+var ReasoningRatio = map[string]float64{}
+
+var AudioInputRatio = map[string]float64{}
+
+var AudioOutputRatio = map[string]float64{}
+
+type audioRatio struct {
+	prefix string
+	input  float64
+	output float64
+}
+
+// https://platform.openai.com/docs/pricing#audio-tokens
+// the more specific prefixes come first
+var defaultAudioRatios = []audioRatio{
+	{"gpt-4o-mini-audio", 10 / 0.15, 20 / 0.6},
+	{"gpt-4o-mini-realtime", 10 / 0.6, 20 / 2.4},
+	{"gpt-4o-audio", 40 / 2.5, 80 / 10},
+	{"gpt-4o-realtime", 40 / 5, 80 / 20},
+	{"gpt-realtime", 32 / 4, 64 / 16},
+	{"gpt-audio", 32 / 2.5, 64 / 10},
+}
+
+func tokenRatio2JSONString(ratios map[string]float64) string {
+	tokenRatioLock.RLock()
+	defer tokenRatioLock.RUnlock()
+	jsonBytes, err := json.Marshal(ratios)
+	if err != nil {
+		logger.SysError("error marshalling token ratio: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func updateTokenRatioByJSONString(ratios *map[string]float64, jsonStr string) error {
+	tokenRatioLock.Lock()
+	defer tokenRatioLock.Unlock()
+	*ratios = make(map[string]float64)
+	return json.Unmarshal([]byte(jsonStr), ratios)
+}
+
+func getTokenRatio(ratios map[string]float64, name string, channelType int) (float64, bool) {
+	tokenRatioLock.RLock()
+	defer tokenRatioLock.RUnlock()
+	if ratio, ok := ratios[fmt.Sprintf("%s(%d)", name, channelType)]; ok {
+		return ratio, true
+	}
+	ratio, ok := ratios[name]
+	return ratio, ok
+}
+
+func ReasoningRatio2JSONString() string {
+	return tokenRatio2JSONString(ReasoningRatio)
+}
+
+func UpdateReasoningRatioByJSONString(jsonStr string) error {
+	return updateTokenRatioByJSONString(&ReasoningRatio, jsonStr)
+}
+
+func AudioInputRatio2JSONString() string {
+	return tokenRatio2JSONString(AudioInputRatio)
+}
+
+func UpdateAudioInputRatioByJSONString(jsonStr string) error {
+	return updateTokenRatioByJSONString(&AudioInputRatio, jsonStr)
+}
+
+func AudioOutputRatio2JSONString() string {
+	return tokenRatio2JSONString(AudioOutputRatio)
+}
+
+func UpdateAudioOutputRatioByJSONString(jsonStr string) error {
+	return updateTokenRatioByJSONString(&AudioOutputRatio, jsonStr)
+}
+
+// GetReasoningRatio returns the price of reasoning tokens relative to the
+// other completion tokens. Upstreams bill them as output, hence the default.
+func GetReasoningRatio(name string, channelType int) float64 {
+	if ratio, ok := getTokenRatio(ReasoningRatio, name, channelType); ok {
+		return ratio
+	}
+	return 1
+}
+
+// GetAudioInputRatio returns the price of audio input tokens relative to text
+// input tokens.
+func GetAudioInputRatio(name string, channelType int) float64 {
+	if ratio, ok := getTokenRatio(AudioInputRatio, name, channelType); ok {
+		return ratio
+	}
+	for _, audioRatio := range defaultAudioRatios {
+		if strings.HasPrefix(name, audioRatio.prefix) {
+			return audioRatio.input
+		}
+	}
+	return 1
+}
+
+// GetAudioOutputRatio returns the price of audio output tokens relative to
+// text output tokens.
+func GetAudioOutputRatio(name string, channelType int) float64 {
+	if ratio, ok := getTokenRatio(AudioOutputRatio, name, channelType); ok {
+		return ratio
+	}
+	for _, audioRatio := range defaultAudioRatios {
+		if strings.HasPrefix(name, audioRatio.prefix) {
+			return audioRatio.output
+		}
+	}
+	return 1
+}
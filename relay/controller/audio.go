@@ -9,21 +9,23 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common"
-	"github.com/songquanpeng/one-api/common/client"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/billing"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/ratelimit"
 	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
@@ -57,14 +59,27 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	modelRatio := billingratio.GetModelRatio(audioModel, channelType)
 	groupRatio := billingratio.GetGroupRatio(group)
 	ratio := modelRatio * groupRatio
+	price, isFixedPrice := billingratio.GetModelFixedPrice(audioModel, channelType)
+	logContent := fmt.Sprintf("倍率：%.2f × %.2f", modelRatio, groupRatio)
 	var quota int64
 	var preConsumedQuota int64
+	// tokens is counted against the tokens-per-minute limit
+	var tokens int
 	switch relayMode {
 	case relaymode.AudioSpeech:
+		tokens = openai.CountTokenText(ttsRequest.Input, audioModel)
 		preConsumedQuota = int64(float64(len(ttsRequest.Input)) * ratio)
+		if isFixedPrice {
+			preConsumedQuota = getFixedPriceQuota(price, groupRatio, 1)
+			logContent = fmt.Sprintf("按次计费：$%g × %.2f", price, groupRatio)
+		}
 		quota = preConsumedQuota
 	default:
 		preConsumedQuota = int64(float64(config.PreConsumedQuota) * ratio)
+		if isFixedPrice {
+			// a minute of audio, the actual duration is only known from the response
+			preConsumedQuota = getFixedPriceQuota(price, groupRatio, 60)
+		}
 	}
 	userQuota, err := model.CacheGetUserQuota(ctx, userId)
 	if err != nil {
@@ -75,6 +90,10 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	if userQuota-preConsumedQuota < 0 {
 		return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
 	}
+	err = model.CheckBudget(tokenId, userId, preConsumedQuota)
+	if err != nil {
+		return openai.ErrorWrapper(err, "budget_exceeded", http.StatusForbidden)
+	}
 	err = model.CacheDecreaseUserQuota(userId, preConsumedQuota)
 	if err != nil {
 		return openai.ErrorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
@@ -85,7 +104,7 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		preConsumedQuota = 0
 	}
 	if preConsumedQuota > 0 {
-		err := model.PreConsumeTokenQuota(tokenId, preConsumedQuota)
+		err := model.PreConsumeTokenQuota(ctx, tokenId, preConsumedQuota)
 		if err != nil {
 			return openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
 		}
@@ -100,7 +119,7 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 			defer func(ctx context.Context) {
 				go func() {
 					// negative means add quota back for token & user
-					err := model.PostConsumeTokenQuota(tokenId, -preConsumedQuota)
+					err := model.PostConsumeTokenQuota(ctx, tokenId, -preConsumedQuota)
 					if err != nil {
 						logger.Error(ctx, fmt.Sprintf("error rollback pre-consumed quota: %s", err.Error()))
 					}
@@ -140,6 +159,16 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	}
 	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody.Bytes()))
 	responseFormat := c.DefaultPostForm("response_format", "json")
+	upstreamFormat := responseFormat
+	if isFixedPrice && relayMode != relaymode.AudioSpeech && (responseFormat == "json" || responseFormat == "text") {
+		// only verbose_json carries the duration that is billed by the second,
+		// the response is rendered back into the format of the client
+		requestBody, err = setMultipartField(c, "response_format", "verbose_json")
+		if err != nil {
+			return openai.ErrorWrapper(err, "set_response_format_failed", http.StatusInternalServerError)
+		}
+		upstreamFormat = "verbose_json"
+	}
 
 	req, err := http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
 	if err != nil {
@@ -151,27 +180,17 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		apiKey := c.Request.Header.Get("Authorization")
 		apiKey = strings.TrimPrefix(apiKey, "Bearer ")
 		req.Header.Set("api-key", apiKey)
-		req.ContentLength = c.Request.ContentLength
 	} else {
 		req.Header.Set("Authorization", c.Request.Header.Get("Authorization"))
 	}
 	req.Header.Set("Content-Type", c.Request.Header.Get("Content-Type"))
 	req.Header.Set("Accept", c.Request.Header.Get("Accept"))
 
-	resp, err := client.HTTPClient.Do(req)
+	resp, err := adaptor.DoRequest(c, req)
 	if err != nil {
 		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
 	}
 
-	err = req.Body.Close()
-	if err != nil {
-		return openai.ErrorWrapper(err, "close_request_body_failed", http.StatusInternalServerError)
-	}
-	err = c.Request.Body.Close()
-	if err != nil {
-		return openai.ErrorWrapper(err, "close_request_body_failed", http.StatusInternalServerError)
-	}
-
 	if relayMode != relaymode.AudioSpeech {
 		responseBody, err := io.ReadAll(resp.Body)
 		if err != nil {
@@ -190,7 +209,7 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		}
 
 		var text string
-		switch responseFormat {
+		switch upstreamFormat {
 		case "json":
 			text, err = getTextFromJSON(responseBody)
 		case "text":
@@ -207,7 +226,21 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		if err != nil {
 			return openai.ErrorWrapper(err, "get_text_from_body_err", http.StatusInternalServerError)
 		}
-		quota = int64(openai.CountTokenText(text, audioModel))
+		tokens = openai.CountTokenText(text, audioModel)
+		quota = int64(tokens)
+		if isFixedPrice {
+			seconds := getAudioDuration(responseBody, upstreamFormat)
+			quota = getFixedPriceQuota(price, groupRatio, seconds)
+			logContent = fmt.Sprintf("按秒计费：$%g × %.2f × %.1f 秒", price, groupRatio, seconds)
+		}
+		if upstreamFormat != responseFormat && resp.StatusCode == http.StatusOK {
+			responseBody, err = renderTranscription(text, responseFormat)
+			if err != nil {
+				return openai.ErrorWrapper(err, "render_response_body_failed", http.StatusInternalServerError)
+			}
+			resp.Header.Del("Content-Length")
+			resp.Header.Set("Content-Type", getTranscriptionContentType(responseFormat))
+		}
 		resp.Body = io.NopCloser(bytes.NewBuffer(responseBody))
 	}
 	if resp.StatusCode != http.StatusOK {
@@ -216,7 +249,8 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	succeed = true
 	quotaDelta := quota - preConsumedQuota
 	defer func(ctx context.Context) {
-		go billing.PostConsumeQuota(ctx, tokenId, quotaDelta, quota, userId, channelId, modelRatio, groupRatio, audioModel, tokenName)
+		ratelimit.ConsumeTokens(ctx, tokenId, c.GetInt(ctxkey.RateLimitTPM), tokens)
+		go billing.PostConsumeQuota(ctx, tokenId, quotaDelta, quota, userId, channelId, logContent, audioModel, tokenName)
 	}(c.Request.Context())
 
 	for k, v := range resp.Header {
@@ -235,6 +269,68 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	return nil
 }
 
+// getAudioDuration returns the duration in seconds of the transcribed audio.
+// Only verbose_json, srt and vtt responses carry timings, json and text
+// responses are requested as verbose_json when they are billed by the second.
+func getAudioDuration(body []byte, responseFormat string) float64 {
+	var duration float64
+	switch responseFormat {
+	case "verbose_json":
+		var whisperResponse openai.WhisperVerboseJSONResponse
+		if err := json.Unmarshal(body, &whisperResponse); err == nil {
+			duration = whisperResponse.Duration
+		}
+	case "srt", "vtt":
+		scanner := bufio.NewScanner(strings.NewReader(string(body)))
+		for scanner.Scan() {
+			_, end, found := strings.Cut(scanner.Text(), "-->")
+			if !found {
+				continue
+			}
+			if seconds, ok := parseSubtitleTimestamp(end); ok {
+				duration = seconds
+			}
+		}
+	}
+	if duration < 1 {
+		return 1
+	}
+	return duration
+}
+
+// renderTranscription renders the text of a verbose_json transcription in
+// the json or text response format.
+func renderTranscription(text string, responseFormat string) ([]byte, error) {
+	if responseFormat == "text" {
+		return []byte(text + "\n"), nil
+	}
+	return json.Marshal(gin.H{"text": text})
+}
+
+func getTranscriptionContentType(responseFormat string) string {
+	if responseFormat == "text" {
+		return "text/plain; charset=utf-8"
+	}
+	return "application/json"
+}
+
+// parseSubtitleTimestamp parses timestamps such as 00:01:02,500 or 01:02.500.
+func parseSubtitleTimestamp(timestamp string) (float64, bool) {
+	fields := strings.Fields(timestamp)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	seconds := 0.0
+	for _, part := range strings.Split(strings.Replace(fields[0], ",", ".", 1), ":") {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, false
+		}
+		seconds = seconds*60 + value
+	}
+	return seconds, true
+}
+
 func getTextFromVTT(body []byte) (string, error) {
 	return getTextFromSRT(body)
 }
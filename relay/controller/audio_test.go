@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAudioDuration(t *testing.T) {
+	cases := []struct {
+		responseFormat string
+		body           string
+		duration       float64
+	}{
+		{"verbose_json", `{"task":"transcribe","duration":12.5,"text":"hello"}`, 12.5},
+		{"srt", "1\n00:00:00,000 --> 00:00:02,000\nhello\n\n2\n00:00:02,000 --> 00:01:03,250\nworld\n", 63.25},
+		{"vtt", "WEBVTT\n\n00:00.000 --> 00:02.000\nhello\n\n00:02.000 --> 01:03.250\nworld\n", 63.25},
+		{"verbose_json", `{"duration":0.2,"text":"hi"}`, 1},
+		{"json", `{"text":"hello"}`, 1},
+		{"text", "hello\n", 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.responseFormat, func(t *testing.T) {
+			assert.Equal(t, tc.duration, getAudioDuration([]byte(tc.body), tc.responseFormat))
+		})
+	}
+}
+
+func TestRenderTranscription(t *testing.T) {
+	body, err := renderTranscription("hello", "json")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"text":"hello"}`, string(body))
+	assert.Equal(t, "application/json", getTranscriptionContentType("json"))
+
+	body, err = renderTranscription("", "json")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"text":""}`, string(body))
+
+	body, err = renderTranscription("hello", "text")
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", string(body))
+	assert.Equal(t, "text/plain; charset=utf-8", getTranscriptionContentType("text"))
+}
+
+func TestSetMultipartField(t *testing.T) {
+	requestBody := &bytes.Buffer{}
+	writer := multipart.NewWriter(requestBody)
+	require.NoError(t, writer.WriteField("model", "whisper-1"))
+	require.NoError(t, writer.WriteField("response_format", "json"))
+	part, err := writer.CreateFormFile("file", "speech.mp3")
+	require.NoError(t, err)
+	_, err = part.Write([]byte("audio"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/v1/audio/transcriptions", requestBody)
+	c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+
+	body, err := setMultipartField(c, "response_format", "verbose_json")
+	require.NoError(t, err)
+	assert.NotEqual(t, writer.FormDataContentType(), c.Request.Header.Get("Content-Type"))
+
+	request := httptest.NewRequest("POST", "/v1/audio/transcriptions", body)
+	request.Header.Set("Content-Type", c.Request.Header.Get("Content-Type"))
+	require.NoError(t, request.ParseMultipartForm(1<<20))
+	assert.Equal(t, []string{"verbose_json"}, request.MultipartForm.Value["response_format"])
+	assert.Equal(t, []string{"whisper-1"}, request.MultipartForm.Value["model"])
+	require.Len(t, request.MultipartForm.File["file"], 1)
+	assert.Equal(t, "speech.mp3", request.MultipartForm.File["file"][0].Filename)
+	file, err := request.MultipartForm.File["file"][0].Open()
+	require.NoError(t, err)
+	content, err := io.ReadAll(file)
+	require.NoError(t, err)
+	assert.Equal(t, "audio", string(content))
+}
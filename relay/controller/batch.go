@@ -0,0 +1,359 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/ratelimit"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// RelayBatchHelper proxies the OpenAI Files and Batch APIs to the channel
+// selected by the distributor, recording the owner of every created object.
+func RelayBatchHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	if meta.APIType != apitype.OpenAI {
+		return openai.ErrorWrapper(fmt.Errorf("channel type %d does not support the Files and Batch APIs", meta.ChannelType), "invalid_api_type", http.StatusBadRequest)
+	}
+	objectType := dbmodel.RelayObjectTypeFile
+	if relayMode == relaymode.Batches {
+		objectType = dbmodel.RelayObjectTypeBatch
+	}
+	objectId := c.Param("id")
+	isCreate := objectId == "" && c.Request.Method == http.MethodPost
+	if isCreate && objectType == dbmodel.RelayObjectTypeBatch {
+		// batches are billed once finished, so only make sure the user can pay
+		userQuota, err := dbmodel.CacheGetUserQuota(ctx, meta.UserId)
+		if err != nil {
+			return openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
+		}
+		if userQuota <= 0 {
+			return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+		}
+		err = dbmodel.CheckBudget(meta.TokenId, meta.UserId, 0)
+		if err != nil {
+			return openai.ErrorWrapper(err, "budget_exceeded", http.StatusForbidden)
+		}
+	}
+
+	adaptor := relay.GetAdaptor(meta.APIType)
+	if adaptor == nil {
+		return openai.ErrorWrapper(fmt.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptor.Init(meta)
+
+	resp, err := adaptor.DoRequest(c, meta, c.Request.Body)
+	if err != nil {
+		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if isErrorHappened(meta, resp) {
+		return RelayErrorHandler(resp)
+	}
+	defer resp.Body.Close()
+
+	if strings.HasSuffix(c.Request.URL.Path, "/content") {
+		c.Writer.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+		if disposition := resp.Header.Get("Content-Disposition"); disposition != "" {
+			c.Writer.Header().Set("Content-Disposition", disposition)
+		}
+		c.Writer.WriteHeader(resp.StatusCode)
+		_, err = io.Copy(c.Writer, resp.Body)
+		if err != nil {
+			logger.Errorf(ctx, "copy file content failed: %s", err.Error())
+		}
+		return nil
+	}
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	switch {
+	case isCreate:
+		var object struct {
+			Id string `json:"id"`
+		}
+		err = json.Unmarshal(responseBody, &object)
+		if err != nil || object.Id == "" {
+			return openai.ErrorWrapper(fmt.Errorf("upstream returned no object id"), "unmarshal_response_body_failed", http.StatusInternalServerError)
+		}
+		relayObject := &dbmodel.RelayObject{
+			ObjectId:   object.Id,
+			Type:       objectType,
+			UserId:     meta.UserId,
+			TokenId:    meta.TokenId,
+			TokenName:  meta.TokenName,
+			Group:      meta.Group,
+			ChannelId:  meta.ChannelId,
+			ChannelKey: c.GetString(ctxkey.ChannelKey),
+		}
+		if objectType == dbmodel.RelayObjectTypeBatch {
+			relayObject.Status = dbmodel.BatchStatusPending
+		}
+		err = relayObject.Insert()
+		if err != nil {
+			logger.Errorf(ctx, "failed to record %s: %s", object.Id, err.Error())
+			return openai.ErrorWrapper(err, "record_object_failed", http.StatusInternalServerError)
+		}
+	case objectId == "":
+		// upstream lists the objects of every user sharing the channel
+		responseBody, err = filterObjectList(responseBody, meta.UserId, objectType)
+		if err != nil {
+			return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+		}
+	case c.Request.Method == http.MethodDelete:
+		err = dbmodel.DeleteRelayObject(objectId, objectType)
+		if err != nil {
+			logger.Errorf(ctx, "failed to delete %s: %s", objectId, err.Error())
+		}
+	case objectType == dbmodel.RelayObjectTypeBatch:
+		var batch openai.Batch
+		if json.Unmarshal(responseBody, &batch) == nil && batch.IsFinished() {
+			object, err := dbmodel.GetUserRelayObject(objectId, objectType, meta.UserId)
+			if err == nil && object.Status == dbmodel.BatchStatusPending {
+				go settleBatch(context.Background(), object, &batch)
+			}
+		}
+	}
+	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), responseBody)
+	return nil
+}
+
+func filterObjectList(responseBody []byte, userId int, objectType int) ([]byte, error) {
+	var list openai.ObjectList
+	err := json.Unmarshal(responseBody, &list)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := dbmodel.GetUserRelayObjectIds(userId, objectType)
+	if err != nil {
+		return nil, err
+	}
+	owned := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		owned[id] = true
+	}
+	data := make([]map[string]any, 0, len(list.Data))
+	for _, object := range list.Data {
+		if id, ok := object["id"].(string); ok && owned[id] {
+			data = append(data, object)
+		}
+	}
+	list.Data = data
+	list.FirstId, list.LastId = "", ""
+	if len(data) > 0 {
+		list.FirstId, _ = data[0]["id"].(string)
+		list.LastId, _ = data[len(data)-1]["id"].(string)
+	}
+	return json.Marshal(list)
+}
+
+// SettlePendingBatches polls the upstream of every unsettled batch and bills
+// the ones that have finished, for clients that never retrieve them again.
+func SettlePendingBatches(ctx context.Context) {
+	objects, err := dbmodel.GetPendingBatches()
+	if err != nil {
+		logger.Errorf(ctx, "failed to get pending batches: %s", err.Error())
+		return
+	}
+	for _, object := range objects {
+		channel, err := dbmodel.GetChannelById(object.ChannelId, true)
+		if err != nil {
+			logger.Errorf(ctx, "batch %s: channel #%d not found", object.ObjectId, object.ChannelId)
+			continue
+		}
+		resp, err := doBatchChannelRequest(channel, object.ChannelKey, "/batches/"+object.ObjectId)
+		if err != nil {
+			logger.Errorf(ctx, "batch %s: %s", object.ObjectId, err.Error())
+			continue
+		}
+		var batch openai.Batch
+		err = json.NewDecoder(resp.Body).Decode(&batch)
+		_ = resp.Body.Close()
+		if err != nil {
+			logger.Errorf(ctx, "batch %s: %s", object.ObjectId, err.Error())
+			continue
+		}
+		if batch.IsFinished() {
+			settleBatch(ctx, object, &batch)
+		}
+	}
+}
+
+// settleBatch bills the results of a finished batch at BatchDiscountRatio.
+func settleBatch(ctx context.Context, object *dbmodel.RelayObject, batch *openai.Batch) {
+	channel, err := dbmodel.GetChannelById(object.ChannelId, true)
+	if err != nil {
+		logger.Errorf(ctx, "batch %s: channel #%d not found", object.ObjectId, object.ChannelId)
+		return
+	}
+	usages := make(map[string]*relaymodel.Usage)
+	if batch.OutputFileId != "" {
+		usages, err = getBatchUsages(channel, object.ChannelKey, batch.OutputFileId)
+		if err != nil {
+			logger.Errorf(ctx, "batch %s: failed to read output: %s", object.ObjectId, err.Error())
+			return
+		}
+	}
+	groupRatio := billingratio.GetGroupRatio(object.Group)
+	quotas := make(map[string]int64, len(usages))
+	var totalQuota int64
+	for modelName, usage := range usages {
+		modelRatio := billingratio.GetModelRatio(modelName, channel.Type)
+		completionRatio := billingratio.GetCompletionRatio(modelName, channel.Type)
+		ratio := modelRatio * groupRatio * config.BatchDiscountRatio
+		quota := int64(math.Ceil((float64(usage.PromptTokens) + float64(usage.CompletionTokens)*completionRatio) * ratio))
+		if ratio != 0 && quota <= 0 {
+			quota = 1
+		}
+		quotas[modelName] = quota
+		totalQuota += quota
+	}
+	settled, err := dbmodel.SettleBatch(object.Id, totalQuota)
+	if err != nil {
+		logger.Errorf(ctx, "batch %s: failed to settle: %s", object.ObjectId, err.Error())
+		return
+	}
+	if !settled {
+		return
+	}
+	consumeBatchTokens(ctx, object, usages)
+	if totalQuota > 0 {
+		err = dbmodel.PostConsumeTokenQuota(ctx, object.TokenId, totalQuota)
+		if err != nil {
+			logger.Error(ctx, "error consuming token remain quota: "+err.Error())
+		}
+		err = dbmodel.CacheUpdateUserQuota(ctx, object.UserId)
+		if err != nil {
+			logger.Error(ctx, "error update user quota cache: "+err.Error())
+		}
+	}
+	for modelName, usage := range usages {
+		quota := quotas[modelName]
+		modelRatio := billingratio.GetModelRatio(modelName, channel.Type)
+		completionRatio := billingratio.GetCompletionRatio(modelName, channel.Type)
+		logContent := fmt.Sprintf("批量任务 %s，倍率：%.2f × %.2f × %.2f × %.2f", object.ObjectId, modelRatio, groupRatio, completionRatio, config.BatchDiscountRatio)
+		dbmodel.RecordConsumeLog(ctx, &dbmodel.Log{
+			UserId:           object.UserId,
+			ChannelId:        object.ChannelId,
+			PromptTokens:     usage.PromptTokens,
+			CompletionTokens: usage.CompletionTokens,
+			ModelName:        modelName,
+			TokenName:        object.TokenName,
+			Quota:            int(quota),
+			Content:          logContent,
+		})
+		dbmodel.UpdateUserUsedQuotaAndRequestCount(object.UserId, quota)
+		dbmodel.UpdateChannelUsedQuota(object.ChannelId, quota)
+	}
+	logger.Infof(ctx, "batch %s settled, quota %d", object.ObjectId, totalQuota)
+}
+
+// consumeBatchTokens counts the tokens used by a batch against the
+// tokens-per-minute limit of its token.
+func consumeBatchTokens(ctx context.Context, object *dbmodel.RelayObject, usages map[string]*relaymodel.Usage) {
+	token, err := dbmodel.GetTokenById(object.TokenId)
+	if err != nil {
+		return
+	}
+	limit := ratelimit.GetRateLimit(object.Group, token.RPM, token.TPM)
+	var tokens int
+	for _, usage := range usages {
+		tokens += usage.PromptTokens + usage.CompletionTokens
+	}
+	ratelimit.ConsumeTokens(ctx, object.TokenId, limit.TPM, tokens)
+}
+
+// getBatchUsages sums the usage of every successful request in a batch
+// output file, per model.
+func getBatchUsages(channel *dbmodel.Channel, key string, outputFileId string) (map[string]*relaymodel.Usage, error) {
+	resp, err := doBatchChannelRequest(channel, key, "/files/"+outputFileId+"/content")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	usages := make(map[string]*relaymodel.Usage)
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		var output openai.BatchOutput
+		if json.Unmarshal(scanner.Bytes(), &output) != nil || output.Response == nil {
+			continue
+		}
+		if output.Response.StatusCode != http.StatusOK {
+			continue
+		}
+		body := output.Response.Body
+		usage, ok := usages[body.Model]
+		if !ok {
+			usage = &relaymodel.Usage{}
+			usages[body.Model] = usage
+		}
+		usage.PromptTokens += body.Usage.PromptTokens + body.Usage.InputTokens
+		usage.CompletionTokens += body.Usage.CompletionTokens + body.Usage.OutputTokens
+	}
+	return usages, scanner.Err()
+}
+
+// doBatchChannelRequest sends a GET request to the Files or Batch API of a
+// channel outside of any client request, with the key that created the object.
+func doBatchChannelRequest(channel *dbmodel.Channel, key string, path string) (*http.Response, error) {
+	baseURL := channel.GetBaseURL()
+	if baseURL == "" {
+		baseURL = channeltype.ChannelBaseURLs[channel.Type]
+	}
+	var fullRequestURL string
+	if channel.Type == channeltype.Azure {
+		cfg, _ := channel.LoadConfig()
+		if cfg.APIVersion == "" && channel.Other != nil {
+			cfg.APIVersion = *channel.Other
+		}
+		fullRequestURL = fmt.Sprintf("%s/openai%s?api-version=%s", baseURL, path, cfg.APIVersion)
+	} else {
+		fullRequestURL = openai.GetFullRequestURL(baseURL, "/v1"+path, channel.Type)
+	}
+	req, err := http.NewRequest(http.MethodGet, fullRequestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		key = dbmodel.PickChannelKey(channel)
+	}
+	if channel.Type == channeltype.Azure {
+		req.Header.Set("api-key", key)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("upstream returned status %d", resp.StatusCode)
+	}
+	return resp, nil
+}
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor/anthropic"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/billing"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// RelayClaudeMessagesHelper serves the native Anthropic Messages API (/v1/messages).
+// Channels that speak Claude natively receive the request as-is, any other
+// channel gets it converted to a chat completion and its response converted back.
+func RelayClaudeMessagesHelper(c *gin.Context) *model.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	claudeRequest, err := getAndValidateClaudeRequest(c)
+	if err != nil {
+		logger.Errorf(ctx, "getAndValidateClaudeRequest failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "invalid_request_error", http.StatusBadRequest)
+	}
+	meta.IsStream = claudeRequest.Stream
+
+	// map model name
+	meta.OriginModelName = claudeRequest.Model
+	claudeRequest.Model, _ = getMappedModelName(claudeRequest.Model, meta.ModelMapping)
+	meta.ActualModelName = claudeRequest.Model
+	if meta.ForcedSystemPrompt != "" {
+		claudeRequest.System = meta.ForcedSystemPrompt
+	}
+	textRequest := anthropic.ConvertRequestToOpenAI(claudeRequest)
+	systemPromptReset := meta.ForcedSystemPrompt != ""
+	// get model ratio & group ratio
+	modelRatio := billingratio.GetModelRatio(textRequest.Model, meta.ChannelType)
+	groupRatio := billingratio.GetGroupRatio(meta.Group)
+	ratio := modelRatio * groupRatio
+	// pre-consume quota
+	promptTokens := getPromptTokens(textRequest, relaymode.ChatCompletions)
+	meta.PromptTokens = promptTokens
+	preConsumedQuota, bizErr := preConsumeQuota(ctx, textRequest, promptTokens, ratio, meta)
+	if bizErr != nil {
+		logger.Warnf(ctx, "preConsumeQuota failed: %+v", *bizErr)
+		return bizErr
+	}
+
+	adaptor := relay.GetAdaptor(meta.APIType)
+	if adaptor == nil {
+		return openai.ErrorWrapper(fmt.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptor.Init(meta)
+
+	nativeAdaptor, isNative := adaptor.(anthropic.NativeAdaptor)
+	isNative = isNative && isClaudeNativeModel(meta)
+	var requestBody io.Reader
+	if isNative {
+		requestBody, err = getClaudeRequestBody(c, meta, claudeRequest, nativeAdaptor)
+	} else {
+		// the upstream only speaks chat completions from here on
+		meta.Mode = relaymode.ChatCompletions
+		meta.RequestURLPath = "/v1/chat/completions"
+		requestBody, err = getConvertedRequestBody(c, meta, textRequest, adaptor)
+	}
+	if err != nil {
+		return openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
+	}
+
+	// do request
+	resp, err := adaptor.DoRequest(c, meta, requestBody)
+	if err != nil {
+		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if isErrorHappened(meta, resp) {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return RelayErrorHandler(resp)
+	}
+
+	// do response
+	var usage *model.Usage
+	var respErr *model.ErrorWithStatusCode
+	if isNative {
+		usage, respErr = nativeAdaptor.DoClaudeResponse(c, resp, meta)
+	} else {
+		writer := anthropic.NewResponseWriter(c.Writer, meta.IsStream, meta.OriginModelName, promptTokens)
+		c.Writer = writer
+		usage, respErr = adaptor.DoResponse(c, resp, meta)
+		c.Writer = writer.ResponseWriter
+		if respErr == nil {
+			writer.Finish(usage)
+		}
+	}
+	if respErr != nil {
+		logger.Errorf(ctx, "respErr is not nil: %+v", respErr)
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return respErr
+	}
+	// post-consume quota
+	meta.ClientAborted = c.GetBool(ctxkey.ClientAborted)
+	go postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, systemPromptReset)
+	return nil
+}
+
+func getAndValidateClaudeRequest(c *gin.Context) (*anthropic.Request, error) {
+	claudeRequest := &anthropic.Request{}
+	err := common.UnmarshalBodyReusable(c, claudeRequest)
+	if err != nil {
+		return nil, err
+	}
+	if claudeRequest.Model == "" {
+		return nil, errors.New("model is required")
+	}
+	if claudeRequest.MaxTokens <= 0 {
+		return nil, errors.New("max_tokens must be greater than 0")
+	}
+	if len(claudeRequest.Messages) == 0 {
+		return nil, errors.New("messages is required")
+	}
+	return claudeRequest, nil
+}
+
+// isClaudeNativeModel reports whether the selected channel serves the model
+// through the Messages API itself.
+func isClaudeNativeModel(meta *meta.Meta) bool {
+	switch meta.APIType {
+	case apitype.Anthropic:
+		return true
+	case apitype.AwsClaude, apitype.VertexAI:
+		return strings.HasPrefix(meta.ActualModelName, "claude")
+	}
+	return false
+}
+
+func getClaudeRequestBody(c *gin.Context, meta *meta.Meta, claudeRequest *anthropic.Request, nativeAdaptor anthropic.NativeAdaptor) (io.Reader, error) {
+	convertedRequest, err := nativeAdaptor.ConvertClaudeRequest(c, meta, claudeRequest)
+	if err != nil {
+		logger.Debugf(c.Request.Context(), "converted request failed: %s\n", err.Error())
+		return nil, err
+	}
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		logger.Debugf(c.Request.Context(), "converted request json_marshal_failed: %s\n", err.Error())
+		return nil, err
+	}
+	logger.Debugf(c.Request.Context(), "converted request: \n%s", string(jsonData))
+	return bytes.NewBuffer(jsonData), nil
+}
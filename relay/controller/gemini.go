@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor/gemini"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/billing"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// RelayGeminiHelper serves the native Gemini generateContent and
+// streamGenerateContent APIs (/v1beta/models/{model}:{action}).
+// Channels that speak Gemini natively receive the request as-is, any other
+// channel gets it converted to a chat completion and its response converted back.
+func RelayGeminiHelper(c *gin.Context) *model.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	modelName, action := gemini.ParseModelAction(c.Param("action"))
+	switch action {
+	case "generateContent":
+	case "streamGenerateContent":
+		meta.IsStream = true
+	default:
+		return openai.ErrorWrapper(fmt.Errorf("unsupported action: %s", action), "invalid_request_error", http.StatusNotFound)
+	}
+	geminiRequest := &gemini.ChatRequest{}
+	err := common.UnmarshalBodyReusable(c, geminiRequest)
+	if err != nil {
+		logger.Errorf(ctx, "UnmarshalBodyReusable failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "invalid_request_error", http.StatusBadRequest)
+	}
+	if len(geminiRequest.Contents) == 0 {
+		return openai.ErrorWrapper(fmt.Errorf("contents is required"), "invalid_request_error", http.StatusBadRequest)
+	}
+
+	// map model name
+	meta.OriginModelName = modelName
+	meta.ActualModelName, _ = getMappedModelName(modelName, meta.ModelMapping)
+	textRequest := gemini.ConvertRequestToOpenAI(geminiRequest, meta.ActualModelName, meta.IsStream)
+	systemPromptReset := setSystemPrompt(ctx, textRequest, meta.ForcedSystemPrompt)
+	// get model ratio & group ratio
+	modelRatio := billingratio.GetModelRatio(textRequest.Model, meta.ChannelType)
+	groupRatio := billingratio.GetGroupRatio(meta.Group)
+	ratio := modelRatio * groupRatio
+	// pre-consume quota
+	promptTokens := getPromptTokens(textRequest, relaymode.ChatCompletions)
+	meta.PromptTokens = promptTokens
+	preConsumedQuota, bizErr := preConsumeQuota(ctx, textRequest, promptTokens, ratio, meta)
+	if bizErr != nil {
+		logger.Warnf(ctx, "preConsumeQuota failed: %+v", *bizErr)
+		return bizErr
+	}
+
+	adaptor := relay.GetAdaptor(meta.APIType)
+	if adaptor == nil {
+		return openai.ErrorWrapper(fmt.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptor.Init(meta)
+
+	nativeAdaptor, isNative := adaptor.(gemini.NativeAdaptor)
+	isNative = isNative && isGeminiNativeModel(meta)
+	var requestBody io.Reader
+	if isNative {
+		requestBody, err = getGeminiRequestBody(c, meta, geminiRequest, nativeAdaptor)
+	} else {
+		// the upstream only speaks chat completions from here on
+		meta.Mode = relaymode.ChatCompletions
+		meta.RequestURLPath = "/v1/chat/completions"
+		requestBody, err = getConvertedRequestBody(c, meta, textRequest, adaptor)
+	}
+	if err != nil {
+		return openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
+	}
+
+	// do request
+	resp, err := adaptor.DoRequest(c, meta, requestBody)
+	if err != nil {
+		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if isErrorHappened(meta, resp) {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return RelayErrorHandler(resp)
+	}
+
+	// do response
+	var usage *model.Usage
+	var respErr *model.ErrorWithStatusCode
+	if isNative {
+		usage, respErr = nativeAdaptor.DoGeminiResponse(c, resp, meta)
+	} else {
+		writer := gemini.NewResponseWriter(c.Writer, meta.IsStream, c.Query("alt") == "sse", meta.OriginModelName)
+		c.Writer = writer
+		usage, respErr = adaptor.DoResponse(c, resp, meta)
+		c.Writer = writer.ResponseWriter
+		if respErr == nil {
+			writer.Finish(usage)
+		}
+	}
+	if respErr != nil {
+		logger.Errorf(ctx, "respErr is not nil: %+v", respErr)
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return respErr
+	}
+	// post-consume quota
+	meta.ClientAborted = c.GetBool(ctxkey.ClientAborted)
+	go postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, systemPromptReset)
+	return nil
+}
+
+// isGeminiNativeModel reports whether the selected channel serves the model
+// through the generateContent API itself.
+func isGeminiNativeModel(meta *meta.Meta) bool {
+	switch meta.APIType {
+	case apitype.Gemini:
+		return true
+	case apitype.VertexAI:
+		return strings.HasPrefix(meta.ActualModelName, "gemini")
+	}
+	return false
+}
+
+func getGeminiRequestBody(c *gin.Context, meta *meta.Meta, geminiRequest *gemini.ChatRequest, nativeAdaptor gemini.NativeAdaptor) (io.Reader, error) {
+	convertedRequest, err := nativeAdaptor.ConvertGeminiRequest(c, meta, geminiRequest)
+	if err != nil {
+		logger.Debugf(c.Request.Context(), "converted request failed: %s\n", err.Error())
+		return nil, err
+	}
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		logger.Debugf(c.Request.Context(), "converted request json_marshal_failed: %s\n", err.Error())
+		return nil, err
+	}
+	logger.Debugf(c.Request.Context(), "converted request: \n%s", string(jsonData))
+	return bytes.NewBuffer(jsonData), nil
+}
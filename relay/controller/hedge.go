@@ -0,0 +1,226 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/middleware"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/hedge"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// upstreamAttempt is one of the requests sent upstream for a hedged request.
+type upstreamAttempt struct {
+	c       *gin.Context
+	meta    *meta.Meta
+	adaptor adaptor.Adaptor
+	body    io.Reader
+	resp    *http.Response
+	err     error
+	cancel  context.CancelFunc
+}
+
+// peekedBody is a response body whose first byte has already been read.
+type peekedBody struct {
+	*bufio.Reader
+	body   io.Closer
+	cancel context.CancelFunc
+}
+
+func (b *peekedBody) Close() error {
+	err := b.body.Close()
+	b.cancel()
+	return err
+}
+
+func (attempt *upstreamAttempt) do(results chan<- *upstreamAttempt) {
+	attempt.resp, attempt.err = attempt.adaptor.DoRequest(attempt.c, attempt.meta, attempt.body)
+	if attempt.resp == nil {
+		attempt.cancel()
+	} else {
+		// the context is released with the body; on success wait for the
+		// first byte, the headers alone say little about the latency
+		reader := bufio.NewReader(attempt.resp.Body)
+		if attempt.succeeded() {
+			_, _ = reader.Peek(1)
+		}
+		attempt.resp.Body = &peekedBody{Reader: reader, body: attempt.resp.Body, cancel: attempt.cancel}
+	}
+	results <- attempt
+}
+
+func (attempt *upstreamAttempt) succeeded() bool {
+	return attempt.err == nil && !isErrorHappened(attempt.meta, attempt.resp)
+}
+
+// abandon cancels an attempt that lost, whether it is still running or not.
+func (attempt *upstreamAttempt) abandon() {
+	attempt.cancel()
+	if attempt.resp != nil {
+		_ = attempt.resp.Body.Close()
+	}
+}
+
+// report feeds the error of a failed attempt that is not returned to the
+// relay to the channel monitor and circuit breaker.
+func (attempt *upstreamAttempt) report() {
+	var bizErr *model.ErrorWithStatusCode
+	if attempt.err != nil {
+		bizErr = openai.ErrorWrapper(attempt.err, "do_request_failed", http.StatusInternalServerError)
+	} else {
+		bizErr = RelayErrorHandler(attempt.resp)
+	}
+	go monitor.ProcessRelayError(attempt.c.Request.Context(), attempt.meta.UserId, attempt.meta.ChannelId, attempt.c.GetString(ctxkey.ChannelName), attempt.c.GetString(ctxkey.ChannelKey), 0, *bizErr)
+}
+
+// doRequestWithHedge sends the request upstream. For models with a hedge
+// delay, the request is also sent to another channel if the first one has not
+// answered within the delay; whichever answers first is kept and the other
+// one is cancelled, so that only the winner is billed. It returns the meta and
+// the adaptor of the winner, along with its response.
+func doRequestWithHedge(c *gin.Context, meta *meta.Meta, a adaptor.Adaptor, textRequest *model.GeneralOpenAIRequest, requestBody io.Reader) (*meta.Meta, adaptor.Adaptor, *http.Response, error) {
+	delay := hedge.GetModelHedgeDelay(meta.OriginModelName)
+	_, isSpecificChannel := c.Get(ctxkey.SpecificChannelId)
+	if delay == 0 || isSpecificChannel || (meta.Mode != relaymode.ChatCompletions && meta.Mode != relaymode.Completions) {
+		resp, err := a.DoRequest(c, meta, requestBody)
+		return meta, a, resp, err
+	}
+	ctx := c.Request.Context()
+	results := make(chan *upstreamAttempt, 2)
+	primary := &upstreamAttempt{c: c, meta: meta, adaptor: a, body: requestBody}
+	var upstreamCtx context.Context
+	upstreamCtx, primary.cancel = context.WithCancel(ctx)
+	c.Set(ctxkey.UpstreamContext, upstreamCtx)
+	// a retry of the relay must not reuse the context of this request
+	defer c.Set(ctxkey.UpstreamContext, nil)
+	go primary.do(results)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	var hedged *upstreamAttempt
+	select {
+	case attempt := <-results:
+		return attempt.meta, attempt.adaptor, attempt.resp, attempt.err
+	case <-timer.C:
+		hedged = newHedgedAttempt(c, meta, textRequest)
+		if hedged == nil {
+			attempt := <-results
+			return attempt.meta, attempt.adaptor, attempt.resp, attempt.err
+		}
+		logger.Infof(ctx, "no first byte from channel #%d after %s, hedging with channel #%d", meta.ChannelId, delay, hedged.meta.ChannelId)
+		go hedged.do(results)
+	}
+
+	first := <-results
+	if first.succeeded() {
+		other := hedged
+		if first == hedged {
+			other = primary
+		}
+		go func() {
+			// the loser may still be running, make sure its response is released
+			other.cancel()
+			<-results
+			other.abandon()
+		}()
+		return useAttempt(c, first)
+	}
+	second := <-results
+	if second.succeeded() {
+		first.report()
+		first.abandon()
+		return useAttempt(c, second)
+	}
+	// both failed, the relay reports the error of the channel that was
+	// selected first
+	hedged.report()
+	hedged.abandon()
+	return primary.meta, primary.adaptor, primary.resp, primary.err
+}
+
+// useAttempt makes the context reflect the channel of the winning attempt.
+func useAttempt(c *gin.Context, attempt *upstreamAttempt) (*meta.Meta, adaptor.Adaptor, *http.Response, error) {
+	if attempt.c != c {
+		logger.Infof(c.Request.Context(), "hedged request won by channel #%d", attempt.meta.ChannelId)
+		for key, value := range attempt.c.Keys {
+			c.Set(key, value)
+		}
+		if sessionKey := c.GetString(ctxkey.SessionKey); sessionKey != "" {
+			dbmodel.CacheSetSessionChannel(sessionKey, attempt.meta.ChannelId, c.GetString(ctxkey.ChannelKey))
+		}
+	}
+	return attempt.meta, attempt.adaptor, attempt.resp, attempt.err
+}
+
+// newHedgedAttempt prepares the request for another channel of the model,
+// nil if there is none.
+func newHedgedAttempt(c *gin.Context, primaryMeta *meta.Meta, textRequest *model.GeneralOpenAIRequest) *upstreamAttempt {
+	ctx := c.Request.Context()
+	var channel *dbmodel.Channel
+	for i := 0; i < 3; i++ {
+		candidate, err := dbmodel.CacheGetRandomSatisfiedChannel(primaryMeta.Group, primaryMeta.OriginModelName, false)
+		if err != nil {
+			return nil
+		}
+		if candidate.Id != primaryMeta.ChannelId {
+			channel = candidate
+			break
+		}
+	}
+	if channel == nil {
+		return nil
+	}
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil
+	}
+	hc := c.Copy()
+	hc.Request = c.Request.Clone(ctx)
+	hc.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	upstreamCtx, cancel := context.WithCancel(ctx)
+	hc.Set(ctxkey.UpstreamContext, upstreamCtx)
+	middleware.SetupContextForSelectedChannel(hc, channel, primaryMeta.OriginModelName)
+
+	hedgedMeta := meta.GetByContext(hc)
+	hedgedMeta.IsStream = primaryMeta.IsStream
+	hedgedMeta.OriginModelName = primaryMeta.OriginModelName
+	hedgedMeta.PromptTokens = primaryMeta.PromptTokens
+	hedgedRequest := *textRequest
+	hedgedRequest.Model, _ = getMappedModelName(primaryMeta.OriginModelName, hedgedMeta.ModelMapping)
+	hedgedMeta.ActualModelName = hedgedRequest.Model
+	hedgedAdaptor := relay.GetAdaptor(hedgedMeta.APIType)
+	if hedgedAdaptor == nil {
+		cancel()
+		return nil
+	}
+	hedgedAdaptor.Init(hedgedMeta)
+	hedgedBody, err := getRequestBody(hc, hedgedMeta, &hedgedRequest, hedgedAdaptor)
+	if err != nil {
+		logger.Errorf(ctx, "hedged request conversion failed: %s", err.Error())
+		cancel()
+		return nil
+	}
+	return &upstreamAttempt{
+		c:       hc,
+		meta:    hedgedMeta,
+		adaptor: hedgedAdaptor,
+		body:    hedgedBody,
+		cancel:  cancel,
+	}
+}
@@ -0,0 +1,198 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/middleware"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/hedge"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+const hedgeTestResponse = `{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}]}`
+
+type hedgeUpstream struct {
+	*httptest.Server
+	requests  int32
+	cancelled chan struct{}
+}
+
+// newHedgeUpstream answers with status after delay, unless the request is
+// cancelled first.
+func newHedgeUpstream(t *testing.T, delay time.Duration, status int) *hedgeUpstream {
+	upstream := &hedgeUpstream{cancelled: make(chan struct{}, 1)}
+	upstream.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstream.requests, 1)
+		// the server only notices a closed connection once the body is read
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			upstream.cancelled <- struct{}{}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			_, _ = w.Write([]byte(hedgeTestResponse))
+		} else {
+			_, _ = w.Write([]byte(`{"error":{"message":"upstream failed","type":"server_error"}}`))
+		}
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+func newHedgeChannel(id int, baseURL string) *dbmodel.Channel {
+	return &dbmodel.Channel{
+		Id:      id,
+		Type:    channeltype.OpenAI,
+		Key:     "sk-test",
+		Status:  dbmodel.ChannelStatusEnabled,
+		Name:    "hedge",
+		Group:   "default",
+		Models:  "gpt-4o",
+		BaseURL: &baseURL,
+	}
+}
+
+// setupHedge stores the channel that hedged requests go to, the primary
+// channel is only selected by the test.
+func setupHedge(t *testing.T, hedgedChannel *dbmodel.Channel) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	redisEnabled := common.RedisEnabled
+	common.RedisEnabled = false
+	dbmodel.DB = db
+	t.Cleanup(func() {
+		common.RedisEnabled = redisEnabled
+		dbmodel.DB = nil
+	})
+	require.NoError(t, db.AutoMigrate(&dbmodel.Channel{}, &dbmodel.Ability{}))
+	require.NoError(t, db.Create(hedgedChannel).Error)
+	require.NoError(t, db.Create(&dbmodel.Ability{Group: "default", Model: "gpt-4o", ChannelId: hedgedChannel.Id, Enabled: true}).Error)
+	require.NoError(t, hedge.UpdateModelHedgeDelayByJSONString(`{"gpt-4o": 50}`))
+	t.Cleanup(func() { _ = hedge.UpdateModelHedgeDelayByJSONString(`{}`) })
+}
+
+func doHedgedTestRequest(t *testing.T, primaryChannel *dbmodel.Channel) (*gin.Context, *meta.Meta, *http.Response, error) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set(ctxkey.Group, "default")
+	c.Set(ctxkey.RequestModel, "gpt-4o")
+	middleware.SetupContextForSelectedChannel(c, primaryChannel, "gpt-4o")
+	textRequest, err := getAndValidateTextRequest(c, relaymode.ChatCompletions)
+	require.NoError(t, err)
+	primaryMeta := meta.GetByContext(c)
+	primaryMeta.ActualModelName = "gpt-4o"
+	a := relay.GetAdaptor(primaryMeta.APIType)
+	a.Init(primaryMeta)
+	requestBody, err := getRequestBody(c, primaryMeta, textRequest, a)
+	require.NoError(t, err)
+	resultMeta, _, resp, err := doRequestWithHedge(c, primaryMeta, a, textRequest, requestBody)
+	// retries must start from a fresh upstream context
+	assert.Nil(t, c.Value(ctxkey.UpstreamContext))
+	return c, resultMeta, resp, err
+}
+
+func readHedgeResponse(t *testing.T, resp *http.Response) string {
+	require.NotNil(t, resp)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return string(body)
+}
+
+func TestDoRequestWithHedge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	client.Init()
+
+	t.Run("the primary answers within the delay", func(t *testing.T) {
+		primary := newHedgeUpstream(t, 0, http.StatusOK)
+		hedged := newHedgeUpstream(t, 0, http.StatusOK)
+		setupHedge(t, newHedgeChannel(2002, hedged.URL))
+
+		c, resultMeta, resp, err := doHedgedTestRequest(t, newHedgeChannel(2001, primary.URL))
+		require.NoError(t, err)
+		assert.Equal(t, 2001, resultMeta.ChannelId)
+		assert.Equal(t, 2001, c.GetInt(ctxkey.ChannelId))
+		assert.Equal(t, hedgeTestResponse, readHedgeResponse(t, resp))
+		assert.Zero(t, atomic.LoadInt32(&hedged.requests))
+	})
+
+	t.Run("a slow primary loses to the hedged channel", func(t *testing.T) {
+		primary := newHedgeUpstream(t, 5*time.Second, http.StatusOK)
+		hedged := newHedgeUpstream(t, 0, http.StatusOK)
+		setupHedge(t, newHedgeChannel(2004, hedged.URL))
+
+		c, resultMeta, resp, err := doHedgedTestRequest(t, newHedgeChannel(2003, primary.URL))
+		require.NoError(t, err)
+		assert.Equal(t, 2004, resultMeta.ChannelId)
+		// the relay credits the channel of the context
+		assert.Equal(t, 2004, c.GetInt(ctxkey.ChannelId))
+		assert.Equal(t, hedgeTestResponse, readHedgeResponse(t, resp))
+		select {
+		case <-primary.cancelled:
+		case <-time.After(2 * time.Second):
+			t.Fatal("the losing request was not cancelled")
+		}
+	})
+
+	t.Run("a failed primary is reported when the hedged channel wins", func(t *testing.T) {
+		primary := newHedgeUpstream(t, 100*time.Millisecond, http.StatusInternalServerError)
+		hedged := newHedgeUpstream(t, 300*time.Millisecond, http.StatusOK)
+		setupHedge(t, newHedgeChannel(2006, hedged.URL))
+
+		c, resultMeta, resp, err := doHedgedTestRequest(t, newHedgeChannel(2005, primary.URL))
+		require.NoError(t, err)
+		assert.Equal(t, 2006, resultMeta.ChannelId)
+		assert.Equal(t, 2006, c.GetInt(ctxkey.ChannelId))
+		assert.Equal(t, hedgeTestResponse, readHedgeResponse(t, resp))
+		assert.Eventually(t, func() bool {
+			_, successRate, ok := monitor.GetChannelStats(2005)
+			return ok && successRate < 1
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("when both fail the primary error is returned and the hedged one reported", func(t *testing.T) {
+		primary := newHedgeUpstream(t, 100*time.Millisecond, http.StatusInternalServerError)
+		hedged := newHedgeUpstream(t, 0, http.StatusInternalServerError)
+		setupHedge(t, newHedgeChannel(2008, hedged.URL))
+
+		c, resultMeta, resp, err := doHedgedTestRequest(t, newHedgeChannel(2007, primary.URL))
+		require.NoError(t, err)
+		assert.Equal(t, 2007, resultMeta.ChannelId)
+		assert.Equal(t, 2007, c.GetInt(ctxkey.ChannelId))
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		readHedgeResponse(t, resp)
+		assert.Eventually(t, func() bool {
+			_, successRate, ok := monitor.GetChannelStats(2008)
+			return ok && successRate < 1
+		}, time.Second, 10*time.Millisecond)
+		_, _, ok := monitor.GetChannelStats(2007)
+		assert.False(t, ok)
+	})
+}
@@ -1,10 +1,13 @@
 package controller
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"math"
+	"mime/multipart"
 	"net/http"
 	"strings"
 
@@ -23,6 +26,7 @@ import (
 	"github.com/songquanpeng/one-api/relay/controller/validator"
 	"github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/ratelimit"
 	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
@@ -67,6 +71,9 @@ func getPreConsumedQuota(textRequest *relaymodel.GeneralOpenAIRequest, promptTok
 
 func preConsumeQuota(ctx context.Context, textRequest *relaymodel.GeneralOpenAIRequest, promptTokens int, ratio float64, meta *meta.Meta) (int64, *relaymodel.ErrorWithStatusCode) {
 	preConsumedQuota := getPreConsumedQuota(textRequest, promptTokens, ratio)
+	if price, ok := billingratio.GetModelFixedPrice(textRequest.Model, meta.ChannelType); ok {
+		preConsumedQuota = getFixedPriceQuota(price, billingratio.GetGroupRatio(meta.Group), 1)
+	}
 
 	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
 	if err != nil {
@@ -75,6 +82,10 @@ func preConsumeQuota(ctx context.Context, textRequest *relaymodel.GeneralOpenAIR
 	if userQuota-preConsumedQuota < 0 {
 		return preConsumedQuota, openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
 	}
+	err = model.CheckBudget(meta.TokenId, meta.UserId, preConsumedQuota)
+	if err != nil {
+		return preConsumedQuota, openai.ErrorWrapper(err, "budget_exceeded", http.StatusForbidden)
+	}
 	err = model.CacheDecreaseUserQuota(meta.UserId, preConsumedQuota)
 	if err != nil {
 		return preConsumedQuota, openai.ErrorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
@@ -86,7 +97,7 @@ func preConsumeQuota(ctx context.Context, textRequest *relaymodel.GeneralOpenAIR
 		logger.Info(ctx, fmt.Sprintf("user %d has enough quota %d, trusted and no need to pre-consume", meta.UserId, userQuota))
 	}
 	if preConsumedQuota > 0 {
-		err := model.PreConsumeTokenQuota(meta.TokenId, preConsumedQuota)
+		err := model.PreConsumeTokenQuota(ctx, meta.TokenId, preConsumedQuota)
 		if err != nil {
 			return preConsumedQuota, openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
 		}
@@ -100,21 +111,16 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 		return
 	}
 	var quota int64
-	completionRatio := billingratio.GetCompletionRatio(textRequest.Model, meta.ChannelType)
-	promptTokens := usage.PromptTokens
-	completionTokens := usage.CompletionTokens
-	quota = int64(math.Ceil((float64(promptTokens) + float64(completionTokens)*completionRatio) * ratio))
-	if ratio != 0 && quota <= 0 {
-		quota = 1
-	}
-	totalTokens := promptTokens + completionTokens
-	if totalTokens == 0 {
-		// in this case, must be some error happened
-		// we cannot just return, because we may have to return the pre-consumed quota
-		quota = 0
+	var logContent string
+	if price, ok := billingratio.GetModelFixedPrice(textRequest.Model, meta.ChannelType); ok {
+		quota = getFixedPriceQuota(price, groupRatio, 1)
+		logContent = fmt.Sprintf("按次计费：$%g × %.2f", price, groupRatio)
+	} else {
+		quota, logContent = getTokenQuota(usage, meta, textRequest, ratio, modelRatio, groupRatio)
 	}
+	ratelimit.ConsumeTokens(ctx, meta.TokenId, meta.RateLimitTPM, usage.PromptTokens+usage.CompletionTokens)
 	quotaDelta := quota - preConsumedQuota
-	err := model.PostConsumeTokenQuota(meta.TokenId, quotaDelta)
+	err := model.PostConsumeTokenQuota(ctx, meta.TokenId, quotaDelta)
 	if err != nil {
 		logger.Error(ctx, "error consuming token remain quota: "+err.Error())
 	}
@@ -122,12 +128,17 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 	if err != nil {
 		logger.Error(ctx, "error update user quota cache: "+err.Error())
 	}
-	logContent := fmt.Sprintf("倍率：%.2f × %.2f × %.2f", modelRatio, groupRatio, completionRatio)
-	model.RecordConsumeLog(ctx, &model.Log{
+	if meta.FallbackFrom != "" {
+		logContent += fmt.Sprintf("，模型降级：%s → %s", meta.FallbackFrom, textRequest.Model)
+	}
+	if meta.ClientAborted {
+		logContent += "，客户端中断"
+	}
+	log := &model.Log{
 		UserId:            meta.UserId,
 		ChannelId:         meta.ChannelId,
-		PromptTokens:      promptTokens,
-		CompletionTokens:  completionTokens,
+		PromptTokens:      usage.PromptTokens,
+		CompletionTokens:  usage.CompletionTokens,
 		ModelName:         textRequest.Model,
 		TokenName:         meta.TokenName,
 		Quota:             int(quota),
@@ -135,11 +146,137 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 		IsStream:          meta.IsStream,
 		ElapsedTime:       helper.CalcElapsedTime(meta.StartTime),
 		SystemPromptReset: systemPromptReset,
-	})
+		ClientAborted:     meta.ClientAborted,
+	}
+	if usage.PromptTokensDetails != nil {
+		log.CachedTokens = usage.PromptTokensDetails.CachedTokens
+		log.AudioInputTokens = usage.PromptTokensDetails.AudioTokens
+	}
+	if usage.CompletionTokensDetails != nil {
+		log.ReasoningTokens = usage.CompletionTokensDetails.ReasoningTokens
+		log.AudioOutputTokens = usage.CompletionTokensDetails.AudioTokens
+	}
+	model.RecordConsumeLog(ctx, log)
 	model.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
 	model.UpdateChannelUsedQuota(meta.ChannelId, quota)
 }
 
+// getTokenQuota prices the usage per token and describes the ratios used.
+func getTokenQuota(usage *relaymodel.Usage, meta *meta.Meta, textRequest *relaymodel.GeneralOpenAIRequest, ratio float64, modelRatio float64, groupRatio float64) (int64, string) {
+	completionRatio := billingratio.GetCompletionRatio(textRequest.Model, meta.ChannelType)
+	promptTokens := usage.PromptTokens
+	completionTokens := usage.CompletionTokens
+	tier := billingratio.GetModelPriceTier(textRequest.Model, meta.ChannelType, promptTokens)
+	if tier != nil {
+		modelRatio = tier.ModelRatio
+		ratio = modelRatio * groupRatio
+		if tier.CompletionRatio != 0 {
+			completionRatio = tier.CompletionRatio
+		}
+	}
+	billedPromptTokens := float64(promptTokens)
+	billedCompletionTokens := float64(completionTokens)
+	var cachedTokens, cacheWriteTokens, audioInputTokens int
+	var cacheReadRatio, cacheWriteRatio, audioInputRatio float64
+	if usage.PromptTokensDetails != nil {
+		// cached, cache-write and audio tokens are part of the prompt tokens, but priced apart
+		cachedTokens = usage.PromptTokensDetails.CachedTokens
+		cacheWriteTokens = usage.PromptTokensDetails.CacheWriteTokens
+		audioInputTokens = usage.PromptTokensDetails.AudioTokens
+		cacheReadRatio = billingratio.GetCacheReadRatio(textRequest.Model, meta.ChannelType)
+		cacheWriteRatio = billingratio.GetCacheWriteRatio(textRequest.Model, meta.ChannelType)
+		audioInputRatio = billingratio.GetAudioInputRatio(textRequest.Model, meta.ChannelType)
+		billedPromptTokens += float64(cachedTokens)*(cacheReadRatio-1) + float64(cacheWriteTokens)*(cacheWriteRatio-1) + float64(audioInputTokens)*(audioInputRatio-1)
+	}
+	var reasoningTokens, audioOutputTokens int
+	var reasoningRatio, audioOutputRatio float64
+	if usage.CompletionTokensDetails != nil {
+		// likewise for the reasoning and audio tokens of the completion
+		reasoningTokens = usage.CompletionTokensDetails.ReasoningTokens
+		audioOutputTokens = usage.CompletionTokensDetails.AudioTokens
+		reasoningRatio = billingratio.GetReasoningRatio(textRequest.Model, meta.ChannelType)
+		audioOutputRatio = billingratio.GetAudioOutputRatio(textRequest.Model, meta.ChannelType)
+		billedCompletionTokens += float64(reasoningTokens)*(reasoningRatio-1) + float64(audioOutputTokens)*(audioOutputRatio-1)
+	}
+	quota := int64(math.Ceil((billedPromptTokens + billedCompletionTokens*completionRatio) * ratio))
+	if ratio != 0 && quota <= 0 {
+		quota = 1
+	}
+	if promptTokens+completionTokens == 0 {
+		// in this case, must be some error happened
+		// we cannot just return, because we may have to return the pre-consumed quota
+		quota = 0
+	}
+	logContent := fmt.Sprintf("倍率：%.2f × %.2f × %.2f", modelRatio, groupRatio, completionRatio)
+	if tier != nil {
+		logContent += fmt.Sprintf("，提示超过 %d tokens 阶梯计价", tier.PromptTokens)
+	}
+	if cachedTokens > 0 {
+		logContent += fmt.Sprintf("，缓存读取 %d tokens × %.2f", cachedTokens, cacheReadRatio)
+	}
+	if cacheWriteTokens > 0 {
+		logContent += fmt.Sprintf("，缓存写入 %d tokens × %.2f", cacheWriteTokens, cacheWriteRatio)
+	}
+	if audioInputTokens > 0 {
+		logContent += fmt.Sprintf("，音频输入 %d tokens × %.2f", audioInputTokens, audioInputRatio)
+	}
+	if reasoningTokens > 0 {
+		logContent += fmt.Sprintf("，推理 %d tokens × %.2f", reasoningTokens, reasoningRatio)
+	}
+	if audioOutputTokens > 0 {
+		logContent += fmt.Sprintf("，音频输出 %d tokens × %.2f", audioOutputTokens, audioOutputRatio)
+	}
+	return quota, logContent
+}
+
+// getFixedPriceQuota converts a price in USD per unit into quota.
+func getFixedPriceQuota(price float64, groupRatio float64, units float64) int64 {
+	return int64(math.Ceil(price * config.QuotaPerUnit * groupRatio * units))
+}
+
+// setMultipartField rebuilds the multipart form of the request with the
+// field set to value, and sets the content type of the new body.
+func setMultipartField(c *gin.Context, key string, value string) (*bytes.Buffer, error) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, err
+	}
+	requestBody := &bytes.Buffer{}
+	writer := multipart.NewWriter(requestBody)
+	for formKey, values := range form.Value {
+		if formKey == key {
+			continue
+		}
+		for _, formValue := range values {
+			_ = writer.WriteField(formKey, formValue)
+		}
+	}
+	_ = writer.WriteField(key, value)
+	for _, fileHeaders := range form.File {
+		for _, fileHeader := range fileHeaders {
+			part, err := writer.CreatePart(fileHeader.Header)
+			if err != nil {
+				return nil, err
+			}
+			file, err := fileHeader.Open()
+			if err != nil {
+				return nil, err
+			}
+			_, err = io.Copy(part, file)
+			_ = file.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+	c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+	return requestBody, nil
+}
+
 func getMappedModelName(modelName string, mapping map[string]string) (string, bool) {
 	if mapping == nil {
 		return modelName, false
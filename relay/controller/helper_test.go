@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/anthropic"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/ratelimit"
+)
+
+// setCompletionRatio sets the completion ratio of a test model.
+func setCompletionRatio(t *testing.T, modelName string, ratio float64) {
+	billingratio.CompletionRatio[modelName] = ratio
+	t.Cleanup(func() { delete(billingratio.CompletionRatio, modelName) })
+}
+
+func getTestTokenQuota(usage *relaymodel.Usage, modelName string, modelRatio float64) (int64, string) {
+	testMeta := &meta.Meta{ChannelType: channeltype.OpenAI}
+	textRequest := &relaymodel.GeneralOpenAIRequest{Model: modelName}
+	return getTokenQuota(usage, testMeta, textRequest, modelRatio, modelRatio, 1)
+}
+
+func TestGetTokenQuotaReasoning(t *testing.T) {
+	setCompletionRatio(t, "reasoning-test", 4)
+	usage := &relaymodel.Usage{
+		PromptTokens:            100,
+		CompletionTokens:        50,
+		CompletionTokensDetails: &relaymodel.CompletionTokensDetails{ReasoningTokens: 30},
+	}
+
+	// reasoning tokens are billed as completion tokens by default
+	quota, _ := getTestTokenQuota(usage, "reasoning-test", 0.5)
+	assert.Equal(t, int64((100+50*4)*0.5), quota)
+
+	require.NoError(t, billingratio.UpdateReasoningRatioByJSONString(`{"reasoning-test": 2}`))
+	defer func() { _ = billingratio.UpdateReasoningRatioByJSONString(`{}`) }()
+	quota, logContent := getTestTokenQuota(usage, "reasoning-test", 0.5)
+	// 20 text tokens and 30 reasoning tokens at twice the completion price
+	assert.Equal(t, int64((100+(20+30*2)*4)*0.5), quota)
+	assert.Contains(t, logContent, "推理 30 tokens × 2.00")
+}
+
+func TestGetTokenQuotaAudio(t *testing.T) {
+	setCompletionRatio(t, "audio-test", 2)
+	require.NoError(t, billingratio.UpdateAudioInputRatioByJSONString(`{"audio-test": 8}`))
+	require.NoError(t, billingratio.UpdateAudioOutputRatioByJSONString(`{"audio-test": 4}`))
+	defer func() {
+		_ = billingratio.UpdateAudioInputRatioByJSONString(`{}`)
+		_ = billingratio.UpdateAudioOutputRatioByJSONString(`{}`)
+	}()
+	usage := &relaymodel.Usage{
+		PromptTokens:            100,
+		CompletionTokens:        50,
+		PromptTokensDetails:     &relaymodel.PromptTokensDetails{AudioTokens: 40},
+		CompletionTokensDetails: &relaymodel.CompletionTokensDetails{AudioTokens: 20},
+	}
+	quota, logContent := getTestTokenQuota(usage, "audio-test", 1)
+	// audio input is priced against text input, audio output against text output
+	assert.Equal(t, int64((60+40*8)+(30+20*4)*2), quota)
+	assert.Contains(t, logContent, "音频输入 40 tokens × 8.00")
+	assert.Contains(t, logContent, "音频输出 20 tokens × 4.00")
+
+	// without a configured ratio, known audio models use the OpenAI prices
+	assert.InDelta(t, 40/2.5, billingratio.GetAudioInputRatio("gpt-4o-audio-preview", channeltype.OpenAI), 1e-9)
+	assert.InDelta(t, 80/10.0, billingratio.GetAudioOutputRatio("gpt-4o-audio-preview", channeltype.OpenAI), 1e-9)
+	assert.InDelta(t, 10/0.15, billingratio.GetAudioInputRatio("gpt-4o-mini-audio-preview", channeltype.OpenAI), 1e-9)
+	assert.Equal(t, 1.0, billingratio.GetAudioInputRatio("gpt-4o", channeltype.OpenAI))
+}
+
+func TestGetTokenQuotaTier(t *testing.T) {
+	usage := &relaymodel.Usage{PromptTokens: 200000, CompletionTokens: 1000}
+	modelRatio := billingratio.GetModelRatio("claude-sonnet-4-20250514", channeltype.Anthropic)
+	testMeta := &meta.Meta{ChannelType: channeltype.Anthropic}
+	textRequest := &relaymodel.GeneralOpenAIRequest{Model: "claude-sonnet-4-20250514"}
+
+	// up to the boundary the flat ratios apply
+	quota, _ := getTokenQuota(usage, testMeta, textRequest, modelRatio, modelRatio, 1)
+	assert.Equal(t, int64((200000+1000*5)*modelRatio), quota)
+
+	// past it the whole request is billed at the long-context price
+	usage.PromptTokens = 200001
+	quota, _ = getTokenQuota(usage, testMeta, textRequest, modelRatio, modelRatio, 1)
+	assert.Equal(t, int64((200001+1000*3.75)*6*billingratio.MILLI_USD), quota)
+}
+
+func TestGetTokenQuotaCache(t *testing.T) {
+	setCompletionRatio(t, "cache-test", 2)
+	require.NoError(t, billingratio.UpdateCacheReadRatioByJSONString(`{"cache-test": 0.1}`))
+	require.NoError(t, billingratio.UpdateCacheWriteRatioByJSONString(`{"cache-test": 1.25}`))
+	defer func() {
+		_ = billingratio.UpdateCacheReadRatioByJSONString(`{}`)
+		_ = billingratio.UpdateCacheWriteRatioByJSONString(`{}`)
+	}()
+	usage := &relaymodel.Usage{
+		PromptTokens:        1000,
+		CompletionTokens:    100,
+		PromptTokensDetails: &relaymodel.PromptTokensDetails{CachedTokens: 600, CacheWriteTokens: 200},
+	}
+	quota, logContent := getTestTokenQuota(usage, "cache-test", 1)
+	// 200 uncached, 600 read at a tenth and 200 written at 1.25 times the input price
+	assert.Equal(t, int64(200+600*0.1+200*1.25+100*2), quota)
+	assert.Contains(t, logContent, "缓存读取 600 tokens × 0.10")
+	assert.Contains(t, logContent, "缓存写入 200 tokens × 1.25")
+
+	// without cache details the whole prompt is billed at the input price
+	quota, logContent = getTestTokenQuota(&relaymodel.Usage{PromptTokens: 1000, CompletionTokens: 100}, "cache-test", 1)
+	assert.Equal(t, int64(1000+100*2), quota)
+	assert.NotContains(t, logContent, "缓存")
+
+	// without a configured ratio, the upstream prices apply
+	assert.Equal(t, 0.1, billingratio.GetCacheReadRatio("claude-sonnet-4-20250514", channeltype.Anthropic))
+	assert.Equal(t, 1.25, billingratio.GetCacheWriteRatio("claude-sonnet-4-20250514", channeltype.Anthropic))
+	assert.Equal(t, 0.25, billingratio.GetCacheReadRatio("gemini-2.5-pro", channeltype.Gemini))
+	assert.Equal(t, 0.5, billingratio.GetCacheReadRatio("gpt-4o", channeltype.OpenAI))
+	assert.Equal(t, 1.0, billingratio.GetCacheWriteRatio("gpt-4o", channeltype.OpenAI))
+
+	// a per-channel-type ratio wins over the model one
+	require.NoError(t, billingratio.UpdateCacheReadRatioByJSONString(`{"cache-test": 0.1, "cache-test(1)": 0.5}`))
+	assert.Equal(t, 0.5, billingratio.GetCacheReadRatio("cache-test", channeltype.OpenAI))
+	assert.Equal(t, 0.1, billingratio.GetCacheReadRatio("cache-test", channeltype.Anthropic))
+}
+
+func TestGetFixedPriceQuota(t *testing.T) {
+	// $0.04 per image
+	assert.Equal(t, int64(0.04*config.QuotaPerUnit), getFixedPriceQuota(0.04, 1, 1))
+	assert.Equal(t, int64(0.04*config.QuotaPerUnit*2*1.5), getFixedPriceQuota(0.04, 1.5, 2))
+	// $0.0001 per second, a partial quota unit is rounded up
+	assert.Equal(t, int64(0.0001*config.QuotaPerUnit*12.5), getFixedPriceQuota(0.0001, 1, 12.5))
+	assert.Equal(t, int64(1), getFixedPriceQuota(0.0000001, 1, 1))
+	assert.Equal(t, int64(0), getFixedPriceQuota(0.04, 0, 1))
+}
+
+func TestPostConsumeQuotaStreamTokens(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	redisEnabled := common.RedisEnabled
+	common.RedisEnabled = false
+	dbmodel.DB = db
+	dbmodel.LOG_DB = db
+	t.Cleanup(func() {
+		common.RedisEnabled = redisEnabled
+		dbmodel.DB = nil
+		dbmodel.LOG_DB = nil
+	})
+	require.NoError(t, db.AutoMigrate(&dbmodel.User{}, &dbmodel.Token{}, &dbmodel.Channel{}, &dbmodel.Log{}, &dbmodel.LedgerEntry{}))
+	require.NoError(t, db.Create(&dbmodel.User{Id: 1, Username: "user", Quota: 1000000}).Error)
+	require.NoError(t, db.Create(&dbmodel.Token{Id: 9001, UserId: 1, Key: "stream-test", RemainQuota: 1000000}).Error)
+
+	// Claude reports the output tokens in the last event of the stream only
+	stream := "event: message_start\n" +
+		`data: {"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4-20250514","content":[],"usage":{"input_tokens":100,"output_tokens":1}}}` + "\n\n" +
+		"event: message_delta\n" +
+		`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":5000}}` + "\n\n"
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(stream))}
+	bizErr, usage := anthropic.StreamHandler(c, resp)
+	require.Nil(t, bizErr)
+	assert.Equal(t, 5100, usage.TotalTokens)
+
+	limit := ratelimit.RateLimit{TPM: 100000}
+	testMeta := &meta.Meta{TokenId: 9001, UserId: 1, ChannelType: channeltype.Anthropic, RateLimitTPM: limit.TPM, IsStream: true}
+	textRequest := &relaymodel.GeneralOpenAIRequest{Model: "claude-sonnet-4-20250514"}
+	postConsumeQuota(context.Background(), usage, testMeta, textRequest, 1, 0, 1, 1, false)
+	result, err := ratelimit.Take(context.Background(), testMeta.TokenId, limit)
+	require.NoError(t, err)
+	assert.InDelta(t, 100000-5100, result.Tokens.Tokens, 50)
+}
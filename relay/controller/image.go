@@ -16,16 +16,25 @@ import (
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/ratelimit"
+	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
-func getImageRequest(c *gin.Context, _ int) (*relaymodel.ImageRequest, error) {
+func getImageRequest(c *gin.Context, relayMode int) (*relaymodel.ImageRequest, error) {
 	imageRequest := &relaymodel.ImageRequest{}
-	err := common.UnmarshalBodyReusable(c, imageRequest)
+	var err error
+	if isImageEditMode(relayMode) {
+		err = getImageEditRequest(c, imageRequest)
+	} else {
+		err = common.UnmarshalBodyReusable(c, imageRequest)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -41,6 +50,19 @@ func getImageRequest(c *gin.Context, _ int) (*relaymodel.ImageRequest, error) {
 	return imageRequest, nil
 }
 
+// getImageEditRequest binds the multipart form of an image edit or variation,
+// keeping the body readable for the upstream request.
+func getImageEditRequest(c *gin.Context, imageRequest *relaymodel.ImageRequest) error {
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	err = c.ShouldBind(imageRequest)
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	return err
+}
+
 func isValidImageSize(model string, size string) bool {
 	if model == "cogview-3" || billingratio.ImageSizeRatios[model] == nil {
 		return true
@@ -66,9 +88,14 @@ func getImageSizeRatio(model string, size string) float64 {
 	return 1
 }
 
-func validateImageRequest(imageRequest *relaymodel.ImageRequest, _ *meta.Meta) *relaymodel.ErrorWithStatusCode {
+func validateImageRequest(imageRequest *relaymodel.ImageRequest, meta *meta.Meta) *relaymodel.ErrorWithStatusCode {
+	// edits and variations work on an uploaded image
+	if isImageEditMode(meta.Mode) && imageRequest.Image == nil {
+		return openai.ErrorWrapper(errors.New("image is required"), "image_missing", http.StatusBadRequest)
+	}
+
 	// check prompt length
-	if imageRequest.Prompt == "" {
+	if imageRequest.Prompt == "" && meta.Mode != relaymode.ImagesVariations {
 		return openai.ErrorWrapper(errors.New("prompt is required"), "prompt_missing", http.StatusBadRequest)
 	}
 
@@ -88,6 +115,36 @@ func validateImageRequest(imageRequest *relaymodel.ImageRequest, _ *meta.Meta) *
 	return nil
 }
 
+func isImageEditMode(relayMode int) bool {
+	return relayMode == relaymode.ImagesEdits || relayMode == relaymode.ImagesVariations
+}
+
+// getImageEditRequestBody builds the body of an image edit or variation.
+// The multipart form of the client is forwarded, unless the adaptor converts
+// the request into another format.
+func getImageEditRequestBody(c *gin.Context, meta *meta.Meta, imageRequest *relaymodel.ImageRequest, adaptor adaptor.Adaptor) (io.Reader, error) {
+	if meta.APIType != apitype.OpenAI {
+		return nil, fmt.Errorf("channel type %d does not support image edits and variations", meta.ChannelType)
+	}
+	convertedRequest, err := adaptor.ConvertImageRequest(imageRequest)
+	if err != nil {
+		return nil, err
+	}
+	if convertedRequest != any(imageRequest) {
+		jsonStr, err := json.Marshal(convertedRequest)
+		if err != nil {
+			return nil, err
+		}
+		c.Request.Header.Set("Content-Type", "application/json")
+		return bytes.NewBuffer(jsonStr), nil
+	}
+	if imageRequest.Model == meta.OriginModelName {
+		return c.Request.Body, nil
+	}
+	// the model is mapped, so rewrite it in the form
+	return setMultipartField(c, "model", imageRequest.Model)
+}
+
 func getImageCostRatio(imageRequest *relaymodel.ImageRequest) (float64, error) {
 	if imageRequest == nil {
 		return 0, errors.New("imageRequest is nil")
@@ -135,7 +192,10 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	c.Set("response_format", imageRequest.ResponseFormat)
 
 	var requestBody io.Reader
-	if isModelMapped || meta.ChannelType == channeltype.Azure { // make Azure channel request body
+	if isImageEditMode(meta.Mode) {
+		// multipart bodies are built once the adaptor is known
+		requestBody = c.Request.Body
+	} else if isModelMapped || meta.ChannelType == channeltype.Azure { // make Azure channel request body
 		jsonStr, err := json.Marshal(imageRequest)
 		if err != nil {
 			return openai.ErrorWrapper(err, "marshal_image_request_failed", http.StatusInternalServerError)
@@ -151,6 +211,13 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	}
 	adaptor.Init(meta)
 
+	if isImageEditMode(meta.Mode) {
+		requestBody, err = getImageEditRequestBody(c, meta, imageRequest, adaptor)
+		if err != nil {
+			return openai.ErrorWrapper(err, "convert_image_request_failed", http.StatusBadRequest)
+		}
+	}
+
 	// these adaptors need to convert the request
 	switch meta.ChannelType {
 	case channeltype.Zhipu,
@@ -174,17 +241,26 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
 
 	var quota int64
-	switch meta.ChannelType {
-	case channeltype.Replicate:
+	logContent := fmt.Sprintf("倍率：%.2f × %.2f", modelRatio, groupRatio)
+	imageCount := imageRequest.N
+	if meta.ChannelType == channeltype.Replicate {
 		// replicate always return 1 image
-		quota = int64(ratio * imageCostRatio * 1000)
-	default:
-		quota = int64(ratio*imageCostRatio*1000) * int64(imageRequest.N)
+		imageCount = 1
+	}
+	if price, ok := billingratio.GetModelFixedPrice(imageModel, meta.ChannelType); ok {
+		quota = getFixedPriceQuota(price, groupRatio, float64(imageCount))
+		logContent = fmt.Sprintf("按张计费：$%g × %.2f × %d 张", price, groupRatio, imageCount)
+	} else {
+		quota = int64(ratio*imageCostRatio*1000) * int64(imageCount)
 	}
 
 	if userQuota-quota < 0 {
 		return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
 	}
+	err = model.CheckBudget(meta.TokenId, meta.UserId, quota)
+	if err != nil {
+		return openai.ErrorWrapper(err, "budget_exceeded", http.StatusForbidden)
+	}
 
 	// do request
 	resp, err := adaptor.DoRequest(c, meta, requestBody)
@@ -193,14 +269,18 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
 	}
 
+	var usage *relaymodel.Usage
 	defer func(ctx context.Context) {
 		if resp != nil &&
 			resp.StatusCode != http.StatusCreated && // replicate returns 201
 			resp.StatusCode != http.StatusOK {
 			return
 		}
+		if usage != nil {
+			ratelimit.ConsumeTokens(ctx, meta.TokenId, meta.RateLimitTPM, usage.PromptTokens+usage.CompletionTokens)
+		}
 
-		err := model.PostConsumeTokenQuota(meta.TokenId, quota)
+		err := model.PostConsumeTokenQuota(ctx, meta.TokenId, quota)
 		if err != nil {
 			logger.SysError("error consuming token remain quota: " + err.Error())
 		}
@@ -210,7 +290,6 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		}
 		if quota != 0 {
 			tokenName := c.GetString(ctxkey.TokenName)
-			logContent := fmt.Sprintf("倍率：%.2f × %.2f", modelRatio, groupRatio)
 			model.RecordConsumeLog(ctx, &model.Log{
 				UserId:           meta.UserId,
 				ChannelId:        meta.ChannelId,
@@ -228,7 +307,7 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	}(c.Request.Context())
 
 	// do response
-	_, respErr := adaptor.DoResponse(c, resp, meta)
+	usage, respErr := adaptor.DoResponse(c, resp, meta)
 	if respErr != nil {
 		logger.Errorf(ctx, "respErr is not nil: %+v", respErr)
 		return respErr
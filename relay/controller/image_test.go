@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+var testPNG = []byte("\x89PNG\r\n\x1a\n0000")
+
+func newImageEditContext(t *testing.T, withImage bool) *gin.Context {
+	requestBody := &bytes.Buffer{}
+	writer := multipart.NewWriter(requestBody)
+	require.NoError(t, writer.WriteField("model", "dall-e-2"))
+	require.NoError(t, writer.WriteField("prompt", "add a hat"))
+	require.NoError(t, writer.WriteField("n", "2"))
+	if withImage {
+		part, err := writer.CreateFormFile("image", "cat.png")
+		require.NoError(t, err)
+		_, err = part.Write(testPNG)
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/images/edits", requestBody)
+	c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+	return c
+}
+
+func parseImageEditBody(t *testing.T, c *gin.Context, body io.Reader) *multipart.Form {
+	request := httptest.NewRequest(http.MethodPost, "/v1/images/edits", body)
+	request.Header.Set("Content-Type", c.Request.Header.Get("Content-Type"))
+	require.NoError(t, request.ParseMultipartForm(1<<20))
+	return request.MultipartForm
+}
+
+func TestImageEditRequestBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("the form is forwarded as is", func(t *testing.T) {
+		c := newImageEditContext(t, true)
+		imageRequest, err := getImageRequest(c, relaymode.ImagesEdits)
+		require.NoError(t, err)
+		assert.Equal(t, "dall-e-2", imageRequest.Model)
+		assert.Equal(t, "add a hat", imageRequest.Prompt)
+		assert.Equal(t, 2, imageRequest.N)
+		require.NotNil(t, imageRequest.Image)
+		assert.Equal(t, "cat.png", imageRequest.Image.Filename)
+
+		testMeta := &meta.Meta{Mode: relaymode.ImagesEdits, APIType: apitype.OpenAI, ChannelType: channeltype.OpenAI, OriginModelName: "dall-e-2"}
+		a := &openai.Adaptor{}
+		a.Init(testMeta)
+		body, err := getImageEditRequestBody(c, testMeta, imageRequest, a)
+		require.NoError(t, err)
+		form := parseImageEditBody(t, c, body)
+		assert.Equal(t, []string{"dall-e-2"}, form.Value["model"])
+		assert.Equal(t, []string{"add a hat"}, form.Value["prompt"])
+	})
+
+	t.Run("a mapped model is rewritten in the form", func(t *testing.T) {
+		c := newImageEditContext(t, true)
+		imageRequest, err := getImageRequest(c, relaymode.ImagesEdits)
+		require.NoError(t, err)
+		imageRequest.Model = "gpt-image-1"
+
+		testMeta := &meta.Meta{Mode: relaymode.ImagesEdits, APIType: apitype.OpenAI, ChannelType: channeltype.OpenAI, OriginModelName: "dall-e-2"}
+		a := &openai.Adaptor{}
+		a.Init(testMeta)
+		body, err := getImageEditRequestBody(c, testMeta, imageRequest, a)
+		require.NoError(t, err)
+		form := parseImageEditBody(t, c, body)
+		assert.Equal(t, []string{"gpt-image-1"}, form.Value["model"])
+		assert.Equal(t, []string{"2"}, form.Value["n"])
+		require.Len(t, form.File["image"], 1)
+		file, err := form.File["image"][0].Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(file)
+		require.NoError(t, err)
+		assert.Equal(t, testPNG, content)
+	})
+
+	t.Run("SiliconFlow gets an image-to-image generation", func(t *testing.T) {
+		c := newImageEditContext(t, true)
+		imageRequest, err := getImageRequest(c, relaymode.ImagesEdits)
+		require.NoError(t, err)
+
+		testMeta := &meta.Meta{Mode: relaymode.ImagesEdits, APIType: apitype.OpenAI, ChannelType: channeltype.SiliconFlow, OriginModelName: "dall-e-2"}
+		a := &openai.Adaptor{}
+		a.Init(testMeta)
+		body, err := getImageEditRequestBody(c, testMeta, imageRequest, a)
+		require.NoError(t, err)
+		assert.Equal(t, "application/json", c.Request.Header.Get("Content-Type"))
+		var request map[string]any
+		require.NoError(t, json.NewDecoder(body).Decode(&request))
+		assert.Equal(t, "add a hat", request["prompt"])
+		assert.Equal(t, 2.0, request["batch_size"])
+		assert.Contains(t, request["image"], "data:image/png;base64,")
+	})
+
+	t.Run("other adaptors are refused", func(t *testing.T) {
+		c := newImageEditContext(t, true)
+		imageRequest, err := getImageRequest(c, relaymode.ImagesEdits)
+		require.NoError(t, err)
+		testMeta := &meta.Meta{Mode: relaymode.ImagesEdits, APIType: apitype.Anthropic, ChannelType: channeltype.Anthropic, OriginModelName: "dall-e-2"}
+		_, err = getImageEditRequestBody(c, testMeta, imageRequest, &openai.Adaptor{})
+		assert.Error(t, err)
+	})
+
+	t.Run("edits need an image", func(t *testing.T) {
+		c := newImageEditContext(t, false)
+		imageRequest, err := getImageRequest(c, relaymode.ImagesEdits)
+		require.NoError(t, err)
+		bizErr := validateImageRequest(imageRequest, &meta.Meta{Mode: relaymode.ImagesEdits})
+		require.NotNil(t, bizErr)
+		assert.Equal(t, "image_missing", bizErr.Error.Code)
+	})
+}
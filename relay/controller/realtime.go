@@ -0,0 +1,193 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+var realtimeUpgrader = websocket.Upgrader{
+	// browsers connect from any origin, the key is checked by TokenAuth
+	CheckOrigin:  func(r *http.Request) bool { return true },
+	Subprotocols: []string{"realtime"},
+}
+
+// RelayRealtimeHelper proxies a Realtime API WebSocket session (/v1/realtime)
+// and bills every response as soon as its response.done event arrives.
+func RelayRealtimeHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	meta.IsStream = true
+	if !websocket.IsWebSocketUpgrade(c.Request) {
+		return openai.ErrorWrapper(errors.New("websocket upgrade required"), "invalid_request_error", http.StatusBadRequest)
+	}
+	if meta.APIType != apitype.OpenAI {
+		return openai.ErrorWrapper(fmt.Errorf("channel type %d does not support the Realtime API", meta.ChannelType), "invalid_api_type", http.StatusBadRequest)
+	}
+
+	// map model name
+	meta.OriginModelName = c.Query("model")
+	meta.ActualModelName, _ = getMappedModelName(meta.OriginModelName, meta.ModelMapping)
+	modelRatio := billingratio.GetModelRatio(meta.ActualModelName, meta.ChannelType)
+	groupRatio := billingratio.GetGroupRatio(meta.Group)
+	ratio := modelRatio * groupRatio
+	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	if err != nil {
+		return openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
+	}
+	if userQuota <= 0 {
+		return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	}
+	err = model.CheckBudget(meta.TokenId, meta.UserId, 0)
+	if err != nil {
+		return openai.ErrorWrapper(err, "budget_exceeded", http.StatusForbidden)
+	}
+
+	upstream, bizErr := dialRealtimeUpstream(c, meta)
+	if bizErr != nil {
+		return bizErr
+	}
+	defer upstream.Close()
+	conn, upgradeErr := realtimeUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if upgradeErr != nil {
+		// the upgrader has already replied to the client
+		logger.Errorf(ctx, "realtime upgrade failed: %s", upgradeErr.Error())
+		return nil
+	}
+	defer conn.Close()
+
+	textRequest := &relaymodel.GeneralOpenAIRequest{Model: meta.ActualModelName}
+	var once sync.Once
+	done := make(chan struct{})
+	closeSession := func() {
+		once.Do(func() { close(done) })
+	}
+	// client -> upstream
+	go func() {
+		defer closeSession()
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			err = upstream.WriteMessage(messageType, message)
+			if err != nil {
+				logger.Errorf(ctx, "realtime write upstream failed: %s", err.Error())
+				return
+			}
+		}
+	}()
+	// upstream -> client
+	go func() {
+		defer closeSession()
+		for {
+			messageType, message, err := upstream.ReadMessage()
+			if err != nil {
+				return
+			}
+			err = conn.WriteMessage(messageType, message)
+			if err != nil {
+				logger.Errorf(ctx, "realtime write client failed: %s", err.Error())
+				return
+			}
+			if messageType != websocket.TextMessage {
+				continue
+			}
+			var event openai.RealtimeEvent
+			if json.Unmarshal(message, &event) != nil || event.Type != "response.done" {
+				continue
+			}
+			if event.Response == nil || event.Response.Usage == nil {
+				continue
+			}
+			usage := event.Response.Usage.ToUsage()
+			postConsumeQuota(ctx, usage, meta, textRequest, ratio, 0, modelRatio, groupRatio, false)
+			meta.StartTime = time.Now()
+			userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+			if err == nil && userQuota <= 0 {
+				writeRealtimeError(conn, "insufficient_user_quota", "user quota is not enough")
+				return
+			}
+			token, err := model.GetTokenById(meta.TokenId)
+			if err == nil && !token.UnlimitedQuota && token.RemainQuota <= 0 {
+				writeRealtimeError(conn, "insufficient_token_quota", "token quota is not enough")
+				return
+			}
+			if err := model.CheckBudget(meta.TokenId, meta.UserId, 0); err != nil {
+				writeRealtimeError(conn, "budget_exceeded", err.Error())
+				return
+			}
+		}
+	}()
+	<-done
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	return nil
+}
+
+func dialRealtimeUpstream(c *gin.Context, meta *meta.Meta) (*websocket.Conn, *relaymodel.ErrorWithStatusCode) {
+	header := http.Header{}
+	if meta.ChannelType == channeltype.Azure {
+		header.Set("api-key", meta.APIKey)
+	} else {
+		header.Set("Authorization", "Bearer "+meta.APIKey)
+	}
+	openAIBeta := c.Request.Header.Get("OpenAI-Beta")
+	for _, protocol := range websocket.Subprotocols(c.Request) {
+		// browsers can only pass headers as subprotocols
+		if strings.HasPrefix(protocol, "openai-beta.") {
+			openAIBeta = strings.TrimPrefix(protocol, "openai-beta.")
+		}
+	}
+	if openAIBeta != "" {
+		header.Set("OpenAI-Beta", openAIBeta)
+	}
+	dialer := websocket.Dialer{
+		HandshakeTimeout: 30 * time.Second,
+		Proxy:            http.ProxyFromEnvironment,
+	}
+	if config.RelayProxy != "" {
+		proxyURL, err := url.Parse(config.RelayProxy)
+		if err == nil {
+			dialer.Proxy = http.ProxyURL(proxyURL)
+		}
+	}
+	upstream, resp, err := dialer.DialContext(context.Background(), openai.GetRealtimeURL(meta), header)
+	if err != nil {
+		logger.Errorf(c.Request.Context(), "realtime dial failed: %s", err.Error())
+		if resp != nil {
+			return nil, RelayErrorHandler(resp)
+		}
+		return nil, openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	return upstream, nil
+}
+
+func writeRealtimeError(conn *websocket.Conn, code string, message string) {
+	_ = conn.WriteJSON(map[string]any{
+		"type": "error",
+		"error": map[string]any{
+			"type":    "one_api_error",
+			"code":    code,
+			"message": message,
+		},
+	})
+}
@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/billing"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// documentsPerSearch is the number of documents billed as one search unit
+// by upstreams that do not report token usage, e.g. Cohere.
+const documentsPerSearch = 100
+
+// RelayRerankHelper relays /v1/rerank. Jina and other Jina-compatible
+// upstreams are served by OpenAI-compatible or custom channels.
+func RelayRerankHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	rerankRequest, err := getAndValidateRerankRequest(c)
+	if err != nil {
+		logger.Errorf(ctx, "getAndValidateRerankRequest failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "invalid_rerank_request", http.StatusBadRequest)
+	}
+
+	// map model name
+	meta.OriginModelName = rerankRequest.Model
+	rerankRequest.Model, _ = getMappedModelName(rerankRequest.Model, meta.ModelMapping)
+	meta.ActualModelName = rerankRequest.Model
+	// get model ratio & group ratio
+	modelRatio := billingratio.GetModelRatio(rerankRequest.Model, meta.ChannelType)
+	groupRatio := billingratio.GetGroupRatio(meta.Group)
+	ratio := modelRatio * groupRatio
+	// pre-consume quota
+	textRequest := &relaymodel.GeneralOpenAIRequest{Model: rerankRequest.Model}
+	promptTokens := openai.CountTokenText(rerankRequest.Query+strings.Join(rerankRequest.DocumentTexts(), ""), rerankRequest.Model)
+	meta.PromptTokens = promptTokens
+	preConsumedQuota, bizErr := preConsumeQuota(ctx, textRequest, promptTokens, ratio, meta)
+	if bizErr != nil {
+		logger.Warnf(ctx, "preConsumeQuota failed: %+v", *bizErr)
+		return bizErr
+	}
+
+	a := relay.GetAdaptor(meta.APIType)
+	if a == nil {
+		return openai.ErrorWrapper(fmt.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
+	}
+	rerankAdaptor, ok := a.(adaptor.RerankAdaptor)
+	if !ok {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return openai.ErrorWrapper(fmt.Errorf("channel type %d does not support rerank", meta.ChannelType), "invalid_api_type", http.StatusBadRequest)
+	}
+	a.Init(meta)
+
+	// get request body
+	convertedRequest, err := rerankAdaptor.ConvertRerankRequest(c, rerankRequest)
+	if err != nil {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
+	}
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return openai.ErrorWrapper(err, "marshal_request_failed", http.StatusInternalServerError)
+	}
+	logger.Debugf(ctx, "converted request: \n%s", string(jsonData))
+
+	// do request
+	resp, err := a.DoRequest(c, meta, bytes.NewBuffer(jsonData))
+	if err != nil {
+		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if isErrorHappened(meta, resp) {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return RelayErrorHandler(resp)
+	}
+
+	// do response
+	usage, respErr := a.DoResponse(c, resp, meta)
+	if respErr != nil {
+		logger.Errorf(ctx, "respErr is not nil: %+v", respErr)
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return respErr
+	}
+	// post-consume quota
+	go func() {
+		if usage != nil && usage.PromptTokens > 0 {
+			postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, false)
+			return
+		}
+		searchUnits := getRerankSearchUnits(len(rerankRequest.Documents))
+		postConsumeRerankSearchQuota(ctx, meta, rerankRequest.Model, searchUnits, preConsumedQuota, modelRatio, groupRatio)
+	}()
+	return nil
+}
+
+func getAndValidateRerankRequest(c *gin.Context) (*relaymodel.RerankRequest, error) {
+	rerankRequest := &relaymodel.RerankRequest{}
+	err := common.UnmarshalBodyReusable(c, rerankRequest)
+	if err != nil {
+		return nil, err
+	}
+	if rerankRequest.Model == "" {
+		return nil, errors.New("model is required")
+	}
+	if rerankRequest.Query == "" {
+		return nil, errors.New("field query is required")
+	}
+	if len(rerankRequest.Documents) == 0 {
+		return nil, errors.New("field documents is required")
+	}
+	return rerankRequest, nil
+}
+
+// getRerankSearchUnits is the number of searches billed for a request with
+// the given number of documents.
+func getRerankSearchUnits(documents int) int64 {
+	return int64(math.Ceil(float64(documents) / documentsPerSearch))
+}
+
+// getRerankSearchQuota prices searches like images: a model ratio of 1 costs
+// 1000 quota per search.
+func getRerankSearchQuota(searchUnits int64, modelRatio float64, groupRatio float64) int64 {
+	return int64(modelRatio*groupRatio*1000) * searchUnits
+}
+
+// postConsumeRerankSearchQuota bills upstreams without token usage per
+// search, the same way images are billed per picture.
+func postConsumeRerankSearchQuota(ctx context.Context, meta *meta.Meta, modelName string, searchUnits int64, preConsumedQuota int64, modelRatio float64, groupRatio float64) {
+	quota := getRerankSearchQuota(searchUnits, modelRatio, groupRatio)
+	err := model.PostConsumeTokenQuota(ctx, meta.TokenId, quota-preConsumedQuota)
+	if err != nil {
+		logger.Error(ctx, "error consuming token remain quota: "+err.Error())
+	}
+	err = model.CacheUpdateUserQuota(ctx, meta.UserId)
+	if err != nil {
+		logger.Error(ctx, "error update user quota cache: "+err.Error())
+	}
+	logContent := fmt.Sprintf("倍率：%.2f × %.2f，搜索次数：%d", modelRatio, groupRatio, searchUnits)
+	model.RecordConsumeLog(ctx, &model.Log{
+		UserId:      meta.UserId,
+		ChannelId:   meta.ChannelId,
+		ModelName:   modelName,
+		TokenName:   meta.TokenName,
+		Quota:       int(quota),
+		Content:     logContent,
+		ElapsedTime: helper.CalcElapsedTime(meta.StartTime),
+	})
+	model.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
+	model.UpdateChannelUsedQuota(meta.ChannelId, quota)
+}
@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/config"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+func TestGetRerankSearchQuota(t *testing.T) {
+	assert.Equal(t, int64(1), getRerankSearchUnits(1))
+	assert.Equal(t, int64(1), getRerankSearchUnits(100))
+	assert.Equal(t, int64(2), getRerankSearchUnits(101))
+	assert.Equal(t, int64(3), getRerankSearchUnits(250))
+
+	// Cohere charges $2 per 1K searches
+	modelRatio := billingratio.GetModelRatio("rerank-v3.5", channeltype.Cohere)
+	quota := getRerankSearchQuota(getRerankSearchUnits(150), modelRatio, 1)
+	assert.InDelta(t, 2*2.0/1000, float64(quota)/config.QuotaPerUnit, 1e-9)
+	assert.Equal(t, 2*quota, getRerankSearchQuota(getRerankSearchUnits(150), modelRatio, 2))
+}
+
+func TestGetAndValidateRerankRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newContext := func(body string) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/rerank", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		return c
+	}
+
+	rerankRequest, err := getAndValidateRerankRequest(newContext(`{"model":"rerank-v3.5","query":"q","documents":["a",{"text":"b"},{"title":"c"}]}`))
+	require.NoError(t, err)
+	assert.Len(t, rerankRequest.Documents, 3)
+	// only the texts count as prompt tokens
+	assert.Equal(t, []string{"a", "b"}, rerankRequest.DocumentTexts())
+
+	_, err = getAndValidateRerankRequest(newContext(`{"query":"q","documents":["a"]}`))
+	assert.Error(t, err)
+	_, err = getAndValidateRerankRequest(newContext(`{"model":"rerank-v3.5","documents":["a"]}`))
+	assert.Error(t, err)
+	_, err = getAndValidateRerankRequest(newContext(`{"model":"rerank-v3.5","query":"q","documents":[]}`))
+	assert.Error(t, err)
+}
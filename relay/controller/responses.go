@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/billing"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// RelayResponsesHelper serves the OpenAI Responses API (/v1/responses).
+// OpenAI and Azure channels receive the request as-is, any other channel gets
+// it converted to a chat completion and its response converted back.
+func RelayResponsesHelper(c *gin.Context) *model.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	responsesRequest, err := getAndValidateResponsesRequest(c)
+	if err != nil {
+		logger.Errorf(ctx, "getAndValidateResponsesRequest failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "invalid_request_error", http.StatusBadRequest)
+	}
+	meta.IsStream = responsesRequest.Stream
+
+	// map model name
+	meta.OriginModelName = responsesRequest.Model
+	responsesRequest.Model, _ = getMappedModelName(responsesRequest.Model, meta.ModelMapping)
+	meta.ActualModelName = responsesRequest.Model
+	if meta.ForcedSystemPrompt != "" {
+		responsesRequest.Instructions = meta.ForcedSystemPrompt
+	}
+	isNative := isResponsesNativeChannel(meta)
+	if isNative {
+		// the native upstream gets the original body with previous_response_id,
+		// it is only cleared here so the conversion for prompt counting accepts it
+		responsesRequest.PreviousResponseId = ""
+	}
+	textRequest, err := openai.ConvertResponsesRequest(responsesRequest)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_request_error", http.StatusBadRequest)
+	}
+	systemPromptReset := meta.ForcedSystemPrompt != ""
+	// get model ratio & group ratio
+	modelRatio := billingratio.GetModelRatio(textRequest.Model, meta.ChannelType)
+	groupRatio := billingratio.GetGroupRatio(meta.Group)
+	ratio := modelRatio * groupRatio
+	// pre-consume quota
+	promptTokens := getPromptTokens(textRequest, relaymode.ChatCompletions)
+	meta.PromptTokens = promptTokens
+	preConsumedQuota, bizErr := preConsumeQuota(ctx, textRequest, promptTokens, ratio, meta)
+	if bizErr != nil {
+		logger.Warnf(ctx, "preConsumeQuota failed: %+v", *bizErr)
+		return bizErr
+	}
+
+	adaptor := relay.GetAdaptor(meta.APIType)
+	if adaptor == nil {
+		return openai.ErrorWrapper(fmt.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptor.Init(meta)
+
+	var requestBody io.Reader
+	if isNative {
+		requestBody, err = getResponsesRequestBody(c, meta)
+	} else {
+		// the upstream only speaks chat completions from here on
+		meta.Mode = relaymode.ChatCompletions
+		meta.RequestURLPath = "/v1/chat/completions"
+		requestBody, err = getConvertedRequestBody(c, meta, textRequest, adaptor)
+	}
+	if err != nil {
+		return openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
+	}
+
+	// do request
+	resp, err := adaptor.DoRequest(c, meta, requestBody)
+	if err != nil {
+		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if isErrorHappened(meta, resp) {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return RelayErrorHandler(resp)
+	}
+
+	// do response
+	var usage *model.Usage
+	var respErr *model.ErrorWithStatusCode
+	if isNative {
+		usage, respErr = adaptor.DoResponse(c, resp, meta)
+	} else {
+		writer := openai.NewResponsesWriter(c.Writer, meta.IsStream, meta.OriginModelName)
+		c.Writer = writer
+		usage, respErr = adaptor.DoResponse(c, resp, meta)
+		c.Writer = writer.ResponseWriter
+		if respErr == nil {
+			writer.Finish(usage)
+		}
+	}
+	if respErr != nil {
+		logger.Errorf(ctx, "respErr is not nil: %+v", respErr)
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return respErr
+	}
+	// post-consume quota
+	meta.ClientAborted = c.GetBool(ctxkey.ClientAborted)
+	go postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, systemPromptReset)
+	return nil
+}
+
+func getAndValidateResponsesRequest(c *gin.Context) (*openai.ResponsesRequest, error) {
+	responsesRequest := &openai.ResponsesRequest{}
+	err := common.UnmarshalBodyReusable(c, responsesRequest)
+	if err != nil {
+		return nil, err
+	}
+	if responsesRequest.Model == "" {
+		return nil, errors.New("model is required")
+	}
+	if responsesRequest.Input == nil && responsesRequest.PreviousResponseId == "" {
+		return nil, errors.New("input is required")
+	}
+	return responsesRequest, nil
+}
+
+// isResponsesNativeChannel reports whether the selected channel serves the
+// Responses API itself.
+func isResponsesNativeChannel(meta *meta.Meta) bool {
+	if meta.APIType != apitype.OpenAI {
+		return false
+	}
+	return meta.ChannelType == channeltype.OpenAI || meta.ChannelType == channeltype.Azure
+}
+
+func getResponsesRequestBody(c *gin.Context, meta *meta.Meta) (io.Reader, error) {
+	convertedRequest, err := openai.ConvertResponsesNativeRequest(c, meta)
+	if err != nil {
+		logger.Debugf(c.Request.Context(), "converted request failed: %s\n", err.Error())
+		return nil, err
+	}
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		logger.Debugf(c.Request.Context(), "converted request json_marshal_failed: %s\n", err.Error())
+		return nil, err
+	}
+	logger.Debugf(c.Request.Context(), "converted request: \n%s", string(jsonData))
+	return bytes.NewBuffer(jsonData), nil
+}
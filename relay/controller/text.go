@@ -10,6 +10,7 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/relay"
 	"github.com/songquanpeng/one-api/relay/adaptor"
@@ -65,7 +66,14 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 	}
 
 	// do request
-	resp, err := adaptor.DoRequest(c, meta, requestBody)
+	hedgedMeta, adaptor, resp, err := doRequestWithHedge(c, meta, adaptor, textRequest, requestBody)
+	if hedgedMeta != meta {
+		// another channel answered first, bill at its ratio
+		meta = hedgedMeta
+		textRequest.Model = meta.ActualModelName
+		modelRatio = billingratio.GetModelRatio(textRequest.Model, meta.ChannelType)
+		ratio = modelRatio * groupRatio
+	}
 	if err != nil {
 		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
 		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
@@ -83,6 +91,7 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 		return respErr
 	}
 	// post-consume quota
+	meta.ClientAborted = c.GetBool(ctxkey.ClientAborted)
 	go postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, systemPromptReset)
 	return nil
 }
@@ -97,8 +106,10 @@ func getRequestBody(c *gin.Context, meta *meta.Meta, textRequest *model.GeneralO
 		return c.Request.Body, nil
 	}
 
-	// get request body
-	var requestBody io.Reader
+	return getConvertedRequestBody(c, meta, textRequest, adaptor)
+}
+
+func getConvertedRequestBody(c *gin.Context, meta *meta.Meta, textRequest *model.GeneralOpenAIRequest, adaptor adaptor.Adaptor) (io.Reader, error) {
 	convertedRequest, err := adaptor.ConvertRequest(c, meta.Mode, textRequest)
 	if err != nil {
 		logger.Debugf(c.Request.Context(), "converted request failed: %s\n", err.Error())
@@ -110,6 +121,5 @@ func getRequestBody(c *gin.Context, meta *meta.Meta, textRequest *model.GeneralO
 		return nil, err
 	}
 	logger.Debugf(c.Request.Context(), "converted request: \n%s", string(jsonData))
-	requestBody = bytes.NewBuffer(jsonData)
-	return requestBody, nil
+	return bytes.NewBuffer(jsonData), nil
 }
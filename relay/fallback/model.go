@@ -0,0 +1,48 @@
+package fallback
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+var modelFallbackLock sync.RWMutex
+
+// ModelFallback maps a model to the models tried, in order, once every
+// channel of the model has failed, e.g. {"gpt-4o": ["claude-3-5-sonnet-20241022", "deepseek-chat"]}
+var ModelFallback = map[string][]string{}
+
+func ModelFallback2JSONString() string {
+	modelFallbackLock.RLock()
+	defer modelFallbackLock.RUnlock()
+	jsonBytes, err := json.Marshal(ModelFallback)
+	if err != nil {
+		logger.SysError("error marshalling model fallback: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelFallbackByJSONString(jsonStr string) error {
+	modelFallbackLock.Lock()
+	defer modelFallbackLock.Unlock()
+	ModelFallback = make(map[string][]string)
+	return json.Unmarshal([]byte(jsonStr), &ModelFallback)
+}
+
+// GetModelFallbacks returns the fallback chain of a model, without the model
+// itself and without duplicates.
+func GetModelFallbacks(name string) []string {
+	modelFallbackLock.RLock()
+	defer modelFallbackLock.RUnlock()
+	seen := map[string]bool{name: true}
+	fallbacks := make([]string, 0, len(ModelFallback[name]))
+	for _, fallback := range ModelFallback[name] {
+		if fallback == "" || seen[fallback] {
+			continue
+		}
+		seen[fallback] = true
+		fallbacks = append(fallbacks, fallback)
+	}
+	return fallbacks
+}
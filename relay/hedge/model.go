@@ -0,0 +1,44 @@
+package hedge
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+var modelHedgeDelayLock sync.RWMutex
+
+// ModelHedgeDelay enables hedged requests for a model: if the upstream has not
+// sent the first byte after this many milliseconds, the request is also sent
+// to another channel, e.g. {"gpt-4o": 1500}
+var ModelHedgeDelay = map[string]int{}
+
+func ModelHedgeDelay2JSONString() string {
+	modelHedgeDelayLock.RLock()
+	defer modelHedgeDelayLock.RUnlock()
+	jsonBytes, err := json.Marshal(ModelHedgeDelay)
+	if err != nil {
+		logger.SysError("error marshalling model hedge delay: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelHedgeDelayByJSONString(jsonStr string) error {
+	modelHedgeDelayLock.Lock()
+	defer modelHedgeDelayLock.Unlock()
+	ModelHedgeDelay = make(map[string]int)
+	return json.Unmarshal([]byte(jsonStr), &ModelHedgeDelay)
+}
+
+// GetModelHedgeDelay returns the hedge delay of a model, 0 if hedging is disabled.
+func GetModelHedgeDelay(name string) time.Duration {
+	modelHedgeDelayLock.RLock()
+	defer modelHedgeDelayLock.RUnlock()
+	delay, ok := ModelHedgeDelay[name]
+	if !ok || delay <= 0 {
+		return 0
+	}
+	return time.Duration(delay) * time.Millisecond
+}
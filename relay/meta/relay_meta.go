@@ -35,6 +35,12 @@ type Meta struct {
 	PromptTokens       int // only for DoResponse
 	ForcedSystemPrompt string
 	StartTime          time.Time
+	// FallbackFrom is the model the user requested when a fallback model is used
+	FallbackFrom string
+	// ClientAborted is set when the client went away before the stream ended
+	ClientAborted bool
+	// RateLimitTPM is the tokens-per-minute limit the usage is counted against
+	RateLimitTPM int
 }
 
 func GetByContext(c *gin.Context) *Meta {
@@ -53,6 +59,8 @@ func GetByContext(c *gin.Context) *Meta {
 		RequestURLPath:     c.Request.URL.String(),
 		ForcedSystemPrompt: c.GetString(ctxkey.SystemPrompt),
 		StartTime:          time.Now(),
+		FallbackFrom:       c.GetString(ctxkey.FallbackFrom),
+		RateLimitTPM:       c.GetInt(ctxkey.RateLimitTPM),
 	}
 	cfg, ok := c.Get(ctxkey.Config)
 	if ok {
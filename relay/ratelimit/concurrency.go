@@ -0,0 +1,39 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+var groupConcurrencyLock sync.RWMutex
+
+// GroupConcurrency is the number of requests the users of a group may have
+// in flight together, e.g. {"default": 20}
+var GroupConcurrency = map[string]int{}
+
+func GroupConcurrency2JSONString() string {
+	groupConcurrencyLock.RLock()
+	defer groupConcurrencyLock.RUnlock()
+	jsonBytes, err := json.Marshal(GroupConcurrency)
+	if err != nil {
+		logger.SysError("error marshalling group concurrency: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateGroupConcurrencyByJSONString(jsonStr string) error {
+	groupConcurrencyLock.Lock()
+	defer groupConcurrencyLock.Unlock()
+	GroupConcurrency = make(map[string]int)
+	return json.Unmarshal([]byte(jsonStr), &GroupConcurrency)
+}
+
+// GetGroupConcurrency returns the concurrency limit of a group, 0 means no
+// limit.
+func GetGroupConcurrency(group string) int {
+	groupConcurrencyLock.RLock()
+	defer groupConcurrencyLock.RUnlock()
+	return GroupConcurrency[group]
+}
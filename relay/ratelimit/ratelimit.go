@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// RateLimit is a requests-per-minute and tokens-per-minute limit, 0 means no
+// limit.
+type RateLimit struct {
+	RPM int `json:"rpm"`
+	TPM int `json:"tpm"`
+}
+
+var groupRateLimitLock sync.RWMutex
+
+// GroupRateLimit is the rate limit of each token of the users in a group,
+// e.g. {"default": {"rpm": 60, "tpm": 100000}}
+var GroupRateLimit = map[string]RateLimit{}
+
+func GroupRateLimit2JSONString() string {
+	groupRateLimitLock.RLock()
+	defer groupRateLimitLock.RUnlock()
+	jsonBytes, err := json.Marshal(GroupRateLimit)
+	if err != nil {
+		logger.SysError("error marshalling group rate limit: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateGroupRateLimitByJSONString(jsonStr string) error {
+	groupRateLimitLock.Lock()
+	defer groupRateLimitLock.Unlock()
+	GroupRateLimit = make(map[string]RateLimit)
+	return json.Unmarshal([]byte(jsonStr), &GroupRateLimit)
+}
+
+func stricter(a int, b int) int {
+	if a <= 0 {
+		return b
+	}
+	if b <= 0 || a < b {
+		return a
+	}
+	return b
+}
+
+// GetRateLimit returns the rate limit of a token: the limits set on the token
+// can only tighten those of the group of its user.
+func GetRateLimit(group string, tokenRPM int, tokenTPM int) RateLimit {
+	groupRateLimitLock.RLock()
+	defer groupRateLimitLock.RUnlock()
+	groupLimit := GroupRateLimit[group]
+	return RateLimit{
+		RPM: stricter(tokenRPM, groupLimit.RPM),
+		TPM: stricter(tokenTPM, groupLimit.TPM),
+	}
+}
+
+func requestsKey(tokenId int) string {
+	return fmt.Sprintf("rateLimit:rpm:%d", tokenId)
+}
+
+func tokensKey(tokenId int) string {
+	return fmt.Sprintf("rateLimit:tpm:%d", tokenId)
+}
+
+// Result is the state of the buckets of a token after a request, nil for a
+// bucket without limit.
+type Result struct {
+	Requests *common.TokenBucketResult
+	Tokens   *common.TokenBucketResult
+}
+
+// Take admits a request of a token: it takes one from the requests bucket and
+// requires the tokens bucket not to be in debt. The tokens are only taken
+// once the usage is known, see ConsumeTokens.
+func Take(ctx context.Context, tokenId int, limit RateLimit) (*Result, error) {
+	result := &Result{}
+	var err error
+	if limit.TPM > 0 {
+		result.Tokens, err = common.TakeTokenBucket(ctx, tokensKey(tokenId), int64(limit.TPM), 1, 0)
+		if err != nil || !result.Tokens.Allowed {
+			return result, err
+		}
+	}
+	if limit.RPM > 0 {
+		result.Requests, err = common.TakeTokenBucket(ctx, requestsKey(tokenId), int64(limit.RPM), 1, 1)
+	}
+	return result, err
+}
+
+// ConsumeTokens takes the tokens used by a request from the tokens bucket of
+// a token, putting it in debt if it does not hold that many.
+func ConsumeTokens(ctx context.Context, tokenId int, tpm int, tokens int) {
+	if tpm <= 0 || tokens <= 0 {
+		return
+	}
+	_, err := common.TakeTokenBucket(ctx, tokensKey(tokenId), int64(tpm), 0, int64(tokens))
+	if err != nil {
+		logger.Error(ctx, "error consuming rate limit tokens: "+err.Error())
+	}
+}
@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/common"
+)
+
+func TestGetRateLimit(t *testing.T) {
+	GroupRateLimit = map[string]RateLimit{"default": {RPM: 60, TPM: 1000}}
+	defer func() { GroupRateLimit = map[string]RateLimit{} }()
+
+	assert.Equal(t, RateLimit{RPM: 60, TPM: 1000}, GetRateLimit("default", 0, 0))
+	assert.Equal(t, RateLimit{RPM: 10, TPM: 1000}, GetRateLimit("default", 10, 5000))
+	assert.Equal(t, RateLimit{RPM: 10, TPM: 0}, GetRateLimit("vip", 10, 0))
+}
+
+func TestTake(t *testing.T) {
+	common.RedisEnabled = false
+	ctx := context.Background()
+
+	limit := RateLimit{RPM: 2}
+	for i := 0; i < 2; i++ {
+		result, err := Take(ctx, 1, limit)
+		assert.NoError(t, err)
+		assert.True(t, result.Requests.Allowed)
+	}
+	result, err := Take(ctx, 1, limit)
+	assert.NoError(t, err)
+	assert.False(t, result.Requests.Allowed)
+	assert.InDelta(t, 30, result.Requests.RetryAfter(2, 1).Seconds(), 1)
+
+	limit = RateLimit{TPM: 100}
+	result, err = Take(ctx, 2, limit)
+	assert.NoError(t, err)
+	assert.True(t, result.Tokens.Allowed)
+	assert.Nil(t, result.Requests)
+	ConsumeTokens(ctx, 2, limit.TPM, 150)
+	result, err = Take(ctx, 2, limit)
+	assert.NoError(t, err)
+	assert.False(t, result.Tokens.Allowed)
+	assert.Equal(t, int64(0), result.Tokens.Remaining())
+}
@@ -13,4 +13,18 @@ const (
 	AudioTranslation
 	// Proxy is a special relay mode for proxying requests to custom upstream
 	Proxy
+	// ClaudeMessages is the native Anthropic Messages API
+	ClaudeMessages
+	// GeminiGenerateContent is the native Gemini generateContent API
+	GeminiGenerateContent
+	// Responses is the OpenAI Responses API
+	Responses
+	// Files and Batches are the OpenAI Files and Batch APIs
+	Files
+	Batches
+	ImagesEdits
+	ImagesVariations
+	// Realtime is the OpenAI Realtime API over WebSocket
+	Realtime
+	Rerank
 )
@@ -26,6 +26,24 @@ func GetByPath(path string) int {
 		relayMode = AudioTranslation
 	} else if strings.HasPrefix(path, "/v1/oneapi/proxy") {
 		relayMode = Proxy
+	} else if strings.HasPrefix(path, "/v1/messages") {
+		relayMode = ClaudeMessages
+	} else if strings.HasPrefix(path, "/v1beta/models/") {
+		relayMode = GeminiGenerateContent
+	} else if strings.HasPrefix(path, "/v1/responses") {
+		relayMode = Responses
+	} else if strings.HasPrefix(path, "/v1/files") {
+		relayMode = Files
+	} else if strings.HasPrefix(path, "/v1/batches") {
+		relayMode = Batches
+	} else if strings.HasPrefix(path, "/v1/images/edits") {
+		relayMode = ImagesEdits
+	} else if strings.HasPrefix(path, "/v1/images/variations") {
+		relayMode = ImagesVariations
+	} else if strings.HasPrefix(path, "/v1/realtime") {
+		relayMode = Realtime
+	} else if strings.HasPrefix(path, "/v1/rerank") {
+		relayMode = Rerank
 	}
 	return relayMode
 }